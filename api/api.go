@@ -1,24 +1,243 @@
 package api
 
+import "time"
+
+type ErrorResponse struct {
+	Status  int    `json:"status"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
 type AccountPasswordRequest struct {
+	Password        string `json:"password"`
+	CurrentPassword string `json:"currentPassword,omitempty"`
+}
+
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
 	Password string `json:"password"`
 }
 
 type PostRequest struct {
-	Data string `json:"data"`
+	Data         string           `json:"data"`
+	DataEncoding string           `json:"dataEncoding,omitempty"`
+	Type         string           `json:"type,omitempty"`
+	NoHeader     bool             `json:"noHeader,omitempty"`
+	Columns      []string         `json:"columns,omitempty"`
+	Overwrite    bool             `json:"overwrite,omitempty"`
+	Metadata     *DatasetMetadata `json:"metadata,omitempty"`
+	Source       string           `json:"source,omitempty"`
 }
 
 type PostResponse struct {
-	Url string `json:"url"`
+	Url       string   `json:"url"`
+	Ark       string   `json:"ark,omitempty"`
+	Type      string   `json:"type,omitempty"`
+	Delimiter string   `json:"delimiter,omitempty"`
+	Encoding  string   `json:"encoding,omitempty"`
+	Columns   []string `json:"columns,omitempty"`
+}
+
+type UploadRequest struct {
+	Name      string           `json:"name"`
+	Size      int64            `json:"size"`
+	Checksum  string           `json:"checksum"`
+	Type      string           `json:"type,omitempty"`
+	NoHeader  bool             `json:"noHeader,omitempty"`
+	Columns   []string         `json:"columns,omitempty"`
+	Overwrite bool             `json:"overwrite,omitempty"`
+	Metadata  *DatasetMetadata `json:"metadata,omitempty"`
+}
+
+type UploadStatus struct {
+	Id      string    `json:"id"`
+	Url     string    `json:"url"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Offset  int64     `json:"offset"`
+	Expires time.Time `json:"expires"`
+}
+
+type AppendRequest struct {
+	Data         string `json:"data"`
+	DataEncoding string `json:"dataEncoding,omitempty"`
+	Type         string `json:"type,omitempty"`
+	NoHeader     bool   `json:"noHeader,omitempty"`
+	Key          string `json:"key,omitempty"`
+}
+
+type AppendResponse struct {
+	Url     string `json:"url"`
+	Ark     string `json:"ark,omitempty"`
+	Rows    int    `json:"rows"`
+	Skipped int    `json:"skipped"`
+}
+
+type DatasetList struct {
+	User     string        `json:"user"`
+	Datasets []DatasetInfo `json:"datasets"`
+}
+
+type DatasetInfo struct {
+	Name        string           `json:"name"`
+	Url         string           `json:"url"`
+	Ark         string           `json:"ark,omitempty"`
+	Size        int64            `json:"size"`
+	Rows        int64            `json:"rows"`
+	Columns     []ColumnInfo     `json:"columns"`
+	Modified    time.Time        `json:"modified"`
+	Hash        string           `json:"hash,omitempty"`
+	Metadata    *DatasetMetadata `json:"metadata,omitempty"`
+	DerivedFrom *Derivation      `json:"derivedFrom,omitempty"`
+}
+
+type ColumnInfo struct {
+	Name     string             `json:"name"`
+	Type     string             `json:"type,omitempty"`
+	Metadata *AttributeMetadata `json:"metadata,omitempty"`
+}
+
+type DatasetMetadata struct {
+	Title    string            `json:"title,omitempty"`
+	Abstract string            `json:"abstract,omitempty"`
+	License  string            `json:"license,omitempty"`
+	Creators []Creator         `json:"creators,omitempty"`
+	Funders  []string          `json:"funders,omitempty"`
+	Keywords []string          `json:"keywords,omitempty"`
+	Temporal *TemporalCoverage `json:"temporal,omitempty"`
+	Spatial  *SpatialCoverage  `json:"spatial,omitempty"`
+}
+
+type Creator struct {
+	Name        string `json:"name"`
+	Id          string `json:"id,omitempty"`
+	Affiliation string `json:"affiliation,omitempty"`
+}
+
+type TemporalCoverage struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type SpatialCoverage struct {
+	Place string    `json:"place,omitempty"`
+	Bbox  []float64 `json:"bbox,omitempty"`
+}
+
+type ArkInfo struct {
+	Ark         string `json:"ark"`
+	Who         string `json:"who"`
+	What        string `json:"what"`
+	When        string `json:"when"`
+	Where       string `json:"where"`
+	Status      string `json:"status,omitempty"`
+	Latest      string `json:"latest,omitempty"`
+	Url         string `json:"url,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	License     string `json:"license,omitempty"`
+	Persistence string `json:"persistence,omitempty"`
+}
+
+type Derivation struct {
+	Ark       string    `json:"ark"`
+	Source    string    `json:"source"`
+	SourceArk string    `json:"sourceArk,omitempty"`
+	Command   string    `json:"command"`
+	Agent     string    `json:"agent"`
+	Started   time.Time `json:"started"`
+	Ended     time.Time `json:"ended"`
+}
+
+type Term struct {
+	Id         string `json:"id"`
+	Uri        string `json:"uri"`
+	Label      string `json:"label,omitempty"`
+	Definition string `json:"definition,omitempty"`
+}
+
+type TermList struct {
+	Prefixes map[string]string `json:"prefixes,omitempty"`
+	Terms    []Term            `json:"terms"`
+}
+
+type AttributeMetadata struct {
+	Term        string `json:"term,omitempty"`
+	Label       string `json:"label,omitempty"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Datatype    string `json:"datatype,omitempty"`
+	Missing     string `json:"missing,omitempty"`
 }
 
 type MetadataRequest struct {
-	Metadata string `json:"metadata"`
+	Metadata string            `json:"metadata,omitempty"`
+	Set      map[string]string `json:"set,omitempty"`
+}
+
+type DataDictionary struct {
+	Dataset    string             `json:"dataset"`
+	Rows       int                `json:"rows"`
+	Attributes []AttributeSummary `json:"attributes"`
+}
+
+type AttributeSummary struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type,omitempty"`
+	Term        string   `json:"term,omitempty"`
+	Unit        string   `json:"unit,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Nulls       int      `json:"nulls"`
+	Distinct    int      `json:"distinct"`
+	Min         string   `json:"min,omitempty"`
+	Max         string   `json:"max,omitempty"`
+	Examples    []string `json:"examples"`
+}
+
+type SearchResult struct {
+	Query   string                  `json:"query"`
+	Total   int                     `json:"total"`
+	Results []SearchHit             `json:"results"`
+	Facets  map[string][]FacetCount `json:"facets"`
+}
+
+type SearchHit struct {
+	Dataset  string            `json:"dataset"`
+	Url      string            `json:"url"`
+	Ark      string            `json:"ark,omitempty"`
+	Title    string            `json:"title,omitempty"`
+	Abstract string            `json:"abstract,omitempty"`
+	License  string            `json:"license,omitempty"`
+	Keywords []string          `json:"keywords,omitempty"`
+	Terms    []string          `json:"terms,omitempty"`
+	Temporal *TemporalCoverage `json:"temporal,omitempty"`
+	Modified time.Time         `json:"modified"`
+	Score    float64           `json:"score"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type MetadataBatchRequest struct {
+	Attributes map[string]map[string]string `json:"attributes"`
 }
 
 type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	SessionId string `json:"sessionId"`
+	SessionId string    `json:"sessionId"`
+	Expires   time.Time `json:"expires"`
+}
+
+type AuditEvent struct {
+	Id      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	IP      string    `json:"ip"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target"`
+	Outcome string    `json:"outcome"`
+	Detail  string    `json:"detail,omitempty"`
 }
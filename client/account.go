@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// Login authenticates with the user's password, even if Token is set, and
+// returns a new session token.  The token can be used by setting Token.
+func (c *Client) Login(ctx context.Context) (*api.LoginResponse, error) {
+	if c.User == "" {
+		return nil, errNoUser
+	}
+	var resp api.LoginResponse
+	err := c.doJSON(ctx, &request{
+		method: http.MethodPost,
+		path:   "login",
+		body:   &api.LoginRequest{},
+		basic:  true,
+	}, &resp, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Logout revokes the session token in Token on the server.  It does not
+// clear Token.
+func (c *Client) Logout(ctx context.Context) error {
+	if c.Token == "" {
+		return errNoToken
+	}
+	return c.doJSON(ctx, &request{
+		method: http.MethodPost,
+		path:   "logout",
+	}, nil, http.StatusNoContent)
+}
+
+// ChangePassword changes the user's password on the server, given the
+// current password.  The server revokes all of the user's session tokens,
+// including Token.  It does not change c.Password.
+func (c *Client) ChangePassword(ctx context.Context, current,
+	password string) error {
+	if c.User == "" {
+		return errNoUser
+	}
+	return c.doJSON(ctx, &request{
+		method: http.MethodPost,
+		path:   "account/password",
+		body: &api.AccountPasswordRequest{
+			Password:        password,
+			CurrentPassword: current,
+		},
+	}, nil, http.StatusCreated)
+}
+
+// ResetPassword sets a new password using a reset token issued by the
+// server administrator.  No other credentials are needed.
+func (c *Client) ResetPassword(ctx context.Context, token,
+	password string) error {
+	return c.doJSON(ctx, &request{
+		method: http.MethodPost,
+		path:   "account/password/reset",
+		body: &api.PasswordResetRequest{
+			Token:    token,
+			Password: password,
+		},
+		anonymous: true,
+	}, nil, http.StatusCreated)
+}
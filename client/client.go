@@ -0,0 +1,248 @@
+// Package client implements a client for the Glint HTTP API, for use by
+// the glint command and by Go programs that work with a Glint server.
+//
+// A Client is created with New and the credentials of a user:
+//
+//	c := client.New("https://glintcore.net")
+//	c.User = "izzy"
+//	c.Password = "..."
+//	resp, err := c.Post(ctx, "ocean", data, nil)
+//
+// Methods that fail because of an unsuccessful response return an *Error,
+// which includes the HTTP status.  Requests that are safe to repeat are
+// retried if the server is temporarily unavailable.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default retry settings.
+const (
+	DefaultMaxRetries   = 3
+	DefaultRetryWait    = 500 * time.Millisecond
+	DefaultMaxRetryWait = 30 * time.Second
+)
+
+// Client sends requests to a Glint server.  A Client is safe for concurrent
+// use if its fields are not changed while requests are in progress.
+type Client struct {
+	// BaseURL is the URL of the server, e.g. "https://glintcore.net".
+	BaseURL string
+
+	// User is the user name.  Data sets that are posted, deleted, or
+	// described belong to User.
+	User string
+
+	// Password is the user's password.  It is not needed if Token is
+	// set, except by Login.
+	Password string
+
+	// Token is a session token returned by Login.  If it is set, it is
+	// sent instead of the password.
+	Token string
+
+	// HTTPClient is used to send requests.  If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+
+	// MaxRetries is the number of times that a request is repeated after
+	// a network error or a response indicating that the server is
+	// temporarily unavailable.  Only requests that are safe to repeat
+	// (GET, HEAD, PUT, and DELETE, but not a PUT that creates a data set)
+	// are retried.
+	MaxRetries int
+
+	// RetryWait is the delay before the first retry; it doubles for each
+	// subsequent retry, unless the server sends a Retry-After header.
+	RetryWait time.Duration
+
+	// MaxRetryWait limits the total delay before retries of a request.
+	// A retry that would exceed it, such as one after a login lockout, is
+	// not made.  If zero, the delay is not limited.
+	MaxRetryWait time.Duration
+}
+
+// New returns a client for the server at baseURL with the default retry
+// settings.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		MaxRetries:   DefaultMaxRetries,
+		RetryWait:    DefaultRetryWait,
+		MaxRetryWait: DefaultMaxRetryWait,
+	}
+}
+
+// errNoUser is returned by methods that need a user name when User is empty.
+var errNoUser = errors.New("User not specified")
+
+// errNoToken is returned by methods that need a session token when Token is
+// empty.
+var errNoToken = errors.New("Not logged in")
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// url returns the URL of path on the server.
+func (c *Client) url(path string) string {
+	return strings.TrimRight(c.BaseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// request describes a request to be sent by do.
+type request struct {
+	method string
+	path   string
+	body   interface{}
+	accept string
+	// basic sends the password even if a token is set.
+	basic bool
+	// anonymous sends no credentials.
+	anonymous bool
+	// once sends the request only once, even if the method is retryable.
+	once bool
+}
+
+// retryable reports whether a request with the method can be repeated.
+func retryable(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// temporary reports whether a response status indicates that the request
+// may succeed if it is repeated.
+func temporary(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends a request, retrying if appropriate, and returns the response if
+// its status is one of ok.  Otherwise the response is closed and an *Error
+// is returned.
+func (c *Client) do(ctx context.Context, r *request, ok ...int) (*http.Response,
+	error) {
+	var body []byte
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return nil, err
+		}
+	}
+	u := c.url(r.path)
+	wait := c.RetryWait
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		httpreq, err := http.NewRequest(r.method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpreq = httpreq.WithContext(ctx)
+		if r.body != nil {
+			httpreq.Header.Set("Content-Type", "application/json")
+		}
+		if r.accept != "" {
+			httpreq.Header.Set("Accept", r.accept)
+		}
+		c.setAuth(httpreq, r)
+
+		resp, err := c.httpClient().Do(httpreq)
+		var retryAfter time.Duration
+		if err == nil {
+			for _, s := range ok {
+				if resp.StatusCode == s {
+					return resp, nil
+				}
+			}
+			if !temporary(resp.StatusCode) {
+				defer resp.Body.Close()
+				return nil, responseError(c.BaseURL, resp)
+			}
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		if attempt >= c.MaxRetries || !retryable(r.method) || r.once ||
+			(c.MaxRetryWait > 0 && waited+wait > c.MaxRetryWait) {
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			return nil, responseError(c.BaseURL, resp)
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		waited += wait
+		wait *= 2
+	}
+}
+
+// doJSON sends a request and decodes the JSON response into v.
+func (c *Client) doJSON(ctx context.Context, r *request, v interface{},
+	ok ...int) error {
+	if r.accept == "" {
+		r.accept = "application/json"
+	}
+	resp, err := c.do(ctx, r, ok...)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) setAuth(req *http.Request, r *request) {
+	switch {
+	case r.anonymous:
+	case c.Token != "" && !r.basic:
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.User != "" && c.Password != "":
+		req.SetBasicAuth(c.User, c.Password)
+	}
+}
+
+// parseRetryAfter returns the delay in a Retry-After header given in
+// seconds, or 0.
+func parseRetryAfter(s string) time.Duration {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// flakyServer responds to the first fail requests with status, and
+// afterwards with 201 Created.  It returns the number of requests received.
+func flakyServer(t *testing.T, fail int, status int,
+	retryAfter string) (*Client, *int) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			n++
+			if n <= fail {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				w.WriteHeader(status)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("{}"))
+		}))
+	t.Cleanup(ts.Close)
+	c := New(ts.URL)
+	c.User = "alice"
+	c.Password = "secret"
+	c.RetryWait = time.Millisecond
+	return c, &n
+}
+
+func TestPostRetry(t *testing.T) {
+	ctx := context.Background()
+	// Overwriting is repeatable.
+	c, n := flakyServer(t, 2, http.StatusServiceUnavailable, "")
+	_, err := c.Post(ctx, "ocean", []byte("a\n1\n"),
+		&api.PostRequest{Overwrite: true})
+	if err != nil || *n != 3 {
+		t.Errorf("overwrite: %d requests, err = %v", *n, err)
+	}
+	// Creating is not.
+	c, n = flakyServer(t, 2, http.StatusServiceUnavailable, "")
+	_, err = c.Post(ctx, "ocean", []byte("a\n1\n"), nil)
+	if err == nil || *n != 1 {
+		t.Errorf("create: %d requests, err = %v", *n, err)
+	}
+}
+
+func TestRetryWaitLimit(t *testing.T) {
+	ctx := context.Background()
+	// A lockout is reported rather than waited out.
+	c, n := flakyServer(t, 1, http.StatusTooManyRequests, "900")
+	err := c.UpdateMetadata(ctx, "ocean", "t", nil)
+	if statusCode(err) != http.StatusTooManyRequests || *n != 1 {
+		t.Errorf("lockout: %d requests, err = %v", *n, err)
+	}
+	// Short waits are within the limit.
+	c, n = flakyServer(t, 3, http.StatusTooManyRequests, "")
+	c.MaxRetryWait = 5 * time.Millisecond
+	err = c.UpdateMetadata(ctx, "ocean", "t", nil)
+	if statusCode(err) != http.StatusTooManyRequests || *n != 3 {
+		t.Errorf("limit: %d requests, err = %v", *n, err)
+	}
+}
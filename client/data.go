@@ -0,0 +1,218 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// Data is the content of a data set retrieved from the server.  The caller
+// must close it.
+type Data struct {
+	io.ReadCloser
+
+	// ContentType is the media type of the data, e.g. "text/csv".
+	ContentType string
+
+	// Size is the length of the data in bytes, or -1 if it is not known.
+	Size int64
+}
+
+// Get retrieves the data set name belonging to user, in CSV format.
+func (c *Client) Get(ctx context.Context, user, name string) (*Data, error) {
+	return c.Query(ctx, user, name, nil)
+}
+
+// Query retrieves the attributes and rows of the data set name belonging
+// to user that are selected by q.
+func (c *Client) Query(ctx context.Context, user, name string,
+	q *Query) (*Data, error) {
+	thump, err := q.encode()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   user + "/" + name + thump,
+		accept: "text/csv, application/json",
+	}, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &Data{
+		ReadCloser:  resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+	}, nil
+}
+
+// List returns the data sets belonging to user.
+func (c *Client) List(ctx context.Context, user string) (*api.DatasetList,
+	error) {
+	var list api.DatasetList
+	err := c.doJSON(ctx, &request{
+		method: http.MethodGet,
+		path:   user,
+	}, &list, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Info describes the data set name belonging to user.
+func (c *Client) Info(ctx context.Context, user, name string) (*api.DatasetInfo,
+	error) {
+	var info api.DatasetInfo
+	err := c.doJSON(ctx, &request{
+		method: http.MethodGet,
+		path:   user + "/" + name + "?info()",
+	}, &info, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Post posts data as the data set name, using the options in opts, which
+// may be nil.  The Data and DataEncoding fields of opts are ignored.  If
+// opts.Overwrite is false, the data set must not already exist, and the
+// request is not retried, because a repeated request would fail if the
+// first one created the data set.
+func (c *Client) Post(ctx context.Context, name string, data []byte,
+	opts *api.PostRequest) (*api.PostResponse, error) {
+	if c.User == "" {
+		return nil, errNoUser
+	}
+	var req api.PostRequest
+	if opts != nil {
+		req = *opts
+	}
+	req.Data = base64.StdEncoding.EncodeToString(data)
+	req.DataEncoding = "base64"
+	var resp api.PostResponse
+	err := c.doJSON(ctx, &request{
+		method: http.MethodPut,
+		path:   c.User + "/" + name,
+		body:   &req,
+		once:   !req.Overwrite,
+	}, &resp, http.StatusCreated, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Save stores the result of a query as the data set name, recording the
+// query as its provenance.  The source is a data set and query in the form
+// "user/dataset?where(...)show(...)".  The options in opts, which may be
+// nil, are used as in Post, except that the data options are ignored.  As
+// in Post, the request is retried only if opts.Overwrite is true.
+func (c *Client) Save(ctx context.Context, name, source string,
+	opts *api.PostRequest) (*api.PostResponse, error) {
+	if c.User == "" {
+		return nil, errNoUser
+	}
+	var req api.PostRequest
+	if opts != nil {
+		req = *opts
+	}
+	req.Data = ""
+	req.DataEncoding = ""
+	req.Source = source
+	var resp api.PostResponse
+	err := c.doJSON(ctx, &request{
+		method: http.MethodPut,
+		path:   c.User + "/" + name,
+		body:   &req,
+		once:   !req.Overwrite,
+	}, &resp, http.StatusCreated, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Append adds the rows in data to the data set name, using the options in
+// opts, which may be nil.  The Data and DataEncoding fields of opts are
+// ignored.  Append is not retried, because repeating it could add the rows
+// twice.
+func (c *Client) Append(ctx context.Context, name string, data []byte,
+	opts *api.AppendRequest) (*api.AppendResponse, error) {
+	if c.User == "" {
+		return nil, errNoUser
+	}
+	var req api.AppendRequest
+	if opts != nil {
+		req = *opts
+	}
+	req.Data = base64.StdEncoding.EncodeToString(data)
+	req.DataEncoding = "base64"
+	var resp api.AppendResponse
+	err := c.doJSON(ctx, &request{
+		method: http.MethodPost,
+		path:   c.User + "/" + name,
+		body:   &req,
+	}, &resp, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Delete deletes the data set name.
+func (c *Client) Delete(ctx context.Context, name string) error {
+	if c.User == "" {
+		return errNoUser
+	}
+	resp, err := c.do(ctx, &request{
+		method: http.MethodDelete,
+		path:   c.User + "/" + name,
+	}, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// SetMetadata sets the vocabulary term, e.g. "dc:date", of the attribute
+// attr of the data set name.
+func (c *Client) SetMetadata(ctx context.Context, name, attr,
+	term string) error {
+	return c.UpdateMetadata(ctx, name, attr, map[string]string{"term": term})
+}
+
+// UpdateMetadata changes fields of the metadata of the attribute attr of
+// the data set name.  The keys of set are "term", "label", "description",
+// "unit", "datatype", and "missing"; fields that are not in set are kept,
+// and a field set to "" is removed.
+func (c *Client) UpdateMetadata(ctx context.Context, name, attr string,
+	set map[string]string) error {
+	if c.User == "" {
+		return errNoUser
+	}
+	return c.doJSON(ctx, &request{
+		method: http.MethodPut,
+		path:   c.User + "/" + name + "." + attr,
+		body:   &api.MetadataRequest{Set: set},
+	}, nil, http.StatusOK)
+}
+
+// UpdateMetadataBatch changes the metadata of several attributes of the
+// data set name at once, with the fields of each attribute in attrs
+// changed as in UpdateMetadata.  If any attribute does not exist or any
+// value is invalid, nothing is changed.
+func (c *Client) UpdateMetadataBatch(ctx context.Context, name string,
+	attrs map[string]map[string]string) error {
+	if c.User == "" {
+		return errNoUser
+	}
+	return c.doJSON(ctx, &request{
+		method: http.MethodPut,
+		path:   c.User + "/" + name + "?md()",
+		body:   &api.MetadataBatchRequest{Attributes: attrs},
+	}, nil, http.StatusOK)
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// Error is returned when the server responds with an unsuccessful status.
+type Error struct {
+	// StatusCode is the HTTP status code, e.g. 404.
+	StatusCode int
+
+	// Status is the HTTP status, e.g. "404 Not Found".
+	Status string
+
+	// Message is the message from the server's error response.
+	Message string
+
+	// RetryAfter is the Retry-After header of the response, if any.
+	RetryAfter string
+
+	// Remote is the base URL of the server.
+	Remote string
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = e.Status
+	}
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Sprintf("Server at '%s' did not accept the "+
+			"username/password: %s", e.Remote, message)
+	case http.StatusForbidden:
+		return "Permission denied: " + message
+	case http.StatusTooManyRequests:
+		if e.RetryAfter != "" {
+			return fmt.Sprintf("%s (retry after %s seconds)",
+				message, e.RetryAfter)
+		}
+	}
+	return message
+}
+
+// IsNotFound reports whether err is an *Error for a resource that does not
+// exist.
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsAuth reports whether err is an *Error for a request that was not
+// authenticated or not permitted.
+func IsAuth(err error) bool {
+	s := statusCode(err)
+	return s == http.StatusUnauthorized || s == http.StatusForbidden
+}
+
+// IsBadRequest reports whether err is an *Error for a request that the
+// server could not parse.
+func IsBadRequest(err error) bool {
+	return statusCode(err) == http.StatusBadRequest
+}
+
+func statusCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// responseError returns an *Error describing an unsuccessful response from
+// the server at remote.  The message is taken from the JSON error body if
+// there is one.
+func responseError(remote string, resp *http.Response) error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: resp.Header.Get("Retry-After"),
+		Remote:     remote,
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		e.Message = fmt.Sprintf("%s [%v]", resp.Status, err)
+		return e
+	}
+	var r api.ErrorResponse
+	e.Message = strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &r) == nil && r.Message != "" {
+		e.Message = r.Message
+	}
+	return e
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Query selects the attributes and rows of a data set to retrieve, and the
+// format of the data.  It is sent as THUMP commands appended to the data set
+// URL.
+type Query struct {
+	// Show lists the attributes to retrieve.  If empty, all attributes
+	// are retrieved.
+	Show []string
+
+	// Where lists conditions that rows must all satisfy, such as
+	// "wind_dir>10".
+	Where []string
+
+	// As is the format: "csv" (the default), "tsv", or "json".
+	As string
+
+	// Dict requests a data dictionary of the selected data, with one row
+	// per attribute, instead of the data.
+	Dict bool
+}
+
+// thumpEscape escapes a THUMP argument so that commas, parentheses, and
+// other reserved characters are not interpreted by the server.
+func thumpEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// thumpList escapes and joins a list of arguments.
+func thumpList(args []string) string {
+	var a []string
+	for _, s := range args {
+		a = append(a, thumpEscape(strings.TrimSpace(s)))
+	}
+	return strings.Join(a, ",")
+}
+
+// encode returns the query as THUMP commands, including the leading "?",
+// or "" if the query is empty.
+func (q *Query) encode() (string, error) {
+	if q == nil {
+		return "", nil
+	}
+	var cmds []string
+	if len(q.Where) > 0 {
+		cmds = append(cmds, "where("+thumpList(q.Where)+")")
+	}
+	if len(q.Show) > 0 {
+		cmds = append(cmds, "show("+thumpList(q.Show)+")")
+	}
+	if q.Dict {
+		cmds = append(cmds, "dict()")
+	}
+	switch q.As {
+	case "", "csv":
+	case "tsv", "json":
+		cmds = append(cmds, "as("+q.As+")")
+	default:
+		return "", fmt.Errorf("Unknown output format: %s", q.As)
+	}
+	if len(cmds) == 0 {
+		return "", nil
+	}
+	return "?" + strings.Join(cmds, ""), nil
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// Search finds data sets whose names or metadata contain the words in q.
+// The parameters in params, which may be nil, restrict the search to facet
+// values ("owner", "license", "term", "from", and "to") or select a page of
+// results ("limit" and "offset").
+func (c *Client) Search(ctx context.Context, q string,
+	params url.Values) (*api.SearchResult, error) {
+	v := url.Values{}
+	for k, s := range params {
+		v[k] = s
+	}
+	v.Set("q", q)
+	var result api.SearchResult
+	err := c.doJSON(ctx, &request{
+		method:    http.MethodGet,
+		path:      "search?" + v.Encode(),
+		anonymous: true,
+	}, &result, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// Terms returns up to limit metadata terms that begin with q or whose
+// labels contain q, for autocompletion.  If limit is 0, the server's
+// default is used.
+func (c *Client) Terms(ctx context.Context, q string,
+	limit int) (*api.TermList, error) {
+	v := url.Values{"q": {q}}
+	if limit > 0 {
+		v.Set("limit", strconv.Itoa(limit))
+	}
+	var list api.TermList
+	err := c.doJSON(ctx, &request{
+		method:    http.MethodGet,
+		path:      "terms?" + v.Encode(),
+		anonymous: true,
+	}, &list, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Prefixes returns the vocabulary prefixes known to the server and their
+// namespaces.
+func (c *Client) Prefixes(ctx context.Context) (map[string]string, error) {
+	var list api.TermList
+	err := c.doJSON(ctx, &request{
+		method:    http.MethodGet,
+		path:      "terms",
+		anonymous: true,
+	}, &list, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return list.Prefixes, nil
+}
+
+// Term returns a metadata term given as a prefixed name, e.g. "dc:date",
+// or as a URI.
+func (c *Client) Term(ctx context.Context, id string) (*api.Term, error) {
+	var t api.Term
+	err := c.doJSON(ctx, &request{
+		method:    http.MethodGet,
+		path:      "terms/" + url.PathEscape(id),
+		anonymous: true,
+	}, &t, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
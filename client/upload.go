@@ -0,0 +1,274 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// DefaultChunkSize is the size of the chunks sent by Upload if ChunkSize is
+// not set.
+const DefaultChunkSize = 4 << 20
+
+// maxChunkFailures is the number of consecutive failed chunks after which
+// Upload gives up.
+const maxChunkFailures = 5
+
+// Upload describes a file to be posted in chunks with an upload session,
+// which can be resumed if it is interrupted.
+type Upload struct {
+	// Name is the name of the data set.
+	Name string
+
+	// Reader provides the Size bytes of the file.
+	Reader io.ReaderAt
+	Size   int64
+
+	// Checksum is the SHA-256 hash of the file, in the form
+	// "sha256:<hex>".  The server verifies it before storing the data.
+	Checksum string
+
+	// Options are the options for posting the data, which may be nil.
+	// The Data and DataEncoding fields are ignored.
+	Options *api.PostRequest
+
+	// ChunkSize is the number of bytes sent in each request.  If it is 0,
+	// DefaultChunkSize is used.
+	ChunkSize int
+
+	// Id is the id of an existing session to resume, or "" to create a
+	// new one.  Upload sets it to the id of the session it uses.
+	Id string
+
+	// Started is called, if not nil, with the session id after a session
+	// has been created, so that the caller can save it for resuming.
+	Started func(id string)
+
+	// Progress is called, if not nil, with the number of bytes that the
+	// server has received.
+	Progress func(offset int64)
+}
+
+// CreateUpload creates an upload session.
+func (c *Client) CreateUpload(ctx context.Context,
+	req *api.UploadRequest) (*api.UploadStatus, error) {
+	var status api.UploadStatus
+	err := c.doJSON(ctx, &request{
+		method: http.MethodPost,
+		path:   "uploads",
+		body:   req,
+	}, &status, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// UploadStatus returns the state of an upload session, including the
+// number of bytes received.
+func (c *Client) UploadStatus(ctx context.Context,
+	id string) (*api.UploadStatus, error) {
+	var status api.UploadStatus
+	err := c.doJSON(ctx, &request{
+		method: http.MethodGet,
+		path:   "uploads/" + id,
+	}, &status, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// UploadChunk sends a chunk of an upload, which must begin at the number of
+// bytes that the server has received.  It returns the new offset.
+func (c *Client) UploadChunk(ctx context.Context, id string, offset int64,
+	chunk []byte) (int64, error) {
+	httpreq, err := http.NewRequest(http.MethodPut, c.url("uploads/"+id),
+		bytes.NewReader(chunk))
+	if err != nil {
+		return 0, err
+	}
+	httpreq = httpreq.WithContext(ctx)
+	httpreq.Header.Set("Content-Type", "application/offset+octet-stream")
+	httpreq.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.setAuth(httpreq, &request{})
+	resp, err := c.httpClient().Do(httpreq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, responseError(c.BaseURL, resp)
+	}
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// FinalizeUpload asks the server to verify a complete upload and store it
+// as a data set.
+func (c *Client) FinalizeUpload(ctx context.Context,
+	id string) (*api.PostResponse, error) {
+	var resp api.PostResponse
+	err := c.doJSON(ctx, &request{
+		method: http.MethodPost,
+		path:   "uploads/" + id,
+	}, &resp, http.StatusCreated, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelUpload abandons an upload session.
+func (c *Client) CancelUpload(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodDelete,
+		path:   "uploads/" + id,
+	}, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Upload posts a file in chunks.  If u.Id refers to a session that can
+// still be resumed, the upload continues from the number of bytes that the
+// server has received; otherwise a new session is created.  After a failed
+// chunk, the offset is read from the server and the upload continues,
+// until several chunks in a row have failed.
+func (c *Client) Upload(ctx context.Context, u *Upload) (*api.PostResponse,
+	error) {
+	var offset int64
+	if u.Id != "" {
+		status, err := c.UploadStatus(ctx, u.Id)
+		switch {
+		case err == nil && status.Size == u.Size:
+			offset = status.Offset
+		case err == nil || IsNotFound(err):
+			u.Id = ""
+		default:
+			return nil, err
+		}
+	}
+	if u.Id == "" {
+		req := api.UploadRequest{
+			Name:     u.Name,
+			Size:     u.Size,
+			Checksum: u.Checksum,
+		}
+		if u.Options != nil {
+			req.Type = u.Options.Type
+			req.NoHeader = u.Options.NoHeader
+			req.Columns = u.Options.Columns
+			req.Overwrite = u.Options.Overwrite
+			req.Metadata = u.Options.Metadata
+		}
+		status, err := c.CreateUpload(ctx, &req)
+		if err != nil {
+			return nil, err
+		}
+		u.Id = status.Id
+		if u.Started != nil {
+			u.Started(u.Id)
+		}
+	}
+
+	size := u.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	chunk := make([]byte, size)
+	wait := c.RetryWait
+	failures := 0
+	for offset < u.Size {
+		if u.Progress != nil {
+			u.Progress(offset)
+		}
+		n, err := u.Reader.ReadAt(chunk, offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if int64(n) > u.Size-offset {
+			n = int(u.Size - offset)
+		}
+		if n == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		next, err := c.UploadChunk(ctx, u.Id, offset, chunk[:n])
+		if err == nil {
+			offset = next
+			failures = 0
+			wait = c.RetryWait
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if e, ok := err.(*Error); ok && e.StatusCode != http.StatusConflict &&
+			!temporary(e.StatusCode) {
+			return nil, err
+		}
+		failures++
+		if failures >= maxChunkFailures {
+			return nil, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		wait *= 2
+		// Continue from the offset that the server has.
+		if status, serr := c.UploadStatus(ctx, u.Id); serr == nil {
+			offset = status.Offset
+		}
+	}
+	if u.Progress != nil {
+		u.Progress(offset)
+	}
+	return c.finalizeUpload(ctx, u)
+}
+
+// finalizeUpload finalizes the session of u, repeating the request after a
+// network error or a temporary failure.  If a repeated request finds the
+// session gone, an earlier request whose response was lost has stored the
+// data set; this is confirmed by comparing its hash with u.Checksum.
+func (c *Client) finalizeUpload(ctx context.Context,
+	u *Upload) (*api.PostResponse, error) {
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		resp, err := c.FinalizeUpload(ctx, u.Id)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt > 0 && IsNotFound(err) {
+			info, ierr := c.Info(ctx, c.User, u.Name)
+			if ierr == nil && info.Hash != "" &&
+				info.Hash == strings.ToLower(u.Checksum) {
+				return &api.PostResponse{Url: info.Url,
+					Ark: info.Ark}, nil
+			}
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if e, ok := err.(*Error); ok && !temporary(e.StatusCode) {
+			return nil, err
+		}
+		if attempt >= c.MaxRetries {
+			return nil, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		wait *= 2
+	}
+}
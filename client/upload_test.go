@@ -0,0 +1,67 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+func TestUploadLostFinalize(t *testing.T) {
+	data := []byte("a,b\n1,2\n")
+	sum := sha256.Sum256(data)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+	var stored bool
+	var finalized int
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/uploads/u1":
+				json.NewEncoder(w).Encode(&api.UploadStatus{
+					Id: "u1", Size: 8})
+			case r.Method == "PUT":
+				w.Header().Set("Upload-Offset", "8")
+				w.WriteHeader(http.StatusNoContent)
+			case r.Method == "POST" && r.URL.Path == "/uploads/u1":
+				finalized++
+				if stored {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				// The data set is stored but the response is lost.
+				stored = true
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+			case r.URL.Path == "/alice/ocean" && stored:
+				json.NewEncoder(w).Encode(&api.DatasetInfo{
+					Name: "ocean", Url: "u", Hash: checksum})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer ts.Close()
+	c := New(ts.URL)
+	c.User = "alice"
+	c.Password = "secret"
+	c.RetryWait = time.Millisecond
+	resp, err := c.Upload(context.Background(), &Upload{
+		Name:     "ocean",
+		Reader:   bytes.NewReader(data),
+		Size:     int64(len(data)),
+		Checksum: checksum,
+		Id:       "u1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Url != "u" || finalized != 2 {
+		t.Errorf("url %q after %d requests", resp.Url, finalized)
+	}
+}
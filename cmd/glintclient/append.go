@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/glintdb/glintweb/api"
+	"github.com/urfave/cli"
+)
+
+func cliAppend(c *cli.Context) error {
+	gc, err := newClient(true)
+	if err != nil {
+		return err
+	}
+
+	dataFile := c.Args().Get(0)
+	if dataFile == "" {
+		return errors.New("Data file not specified")
+	}
+	name := c.Args().Get(1)
+	if name == "" {
+		name = removeExtension(filepath.Base(dataFile))
+	}
+
+	data, err := ioutil.ReadFile(dataFile)
+	if err != nil {
+		return err
+	}
+	var req api.AppendRequest
+	req.Type = c.String("type")
+	if req.Type == "" {
+		req.Type = typeFromExtension(dataFile)
+	}
+	req.NoHeader = c.Bool("no-header")
+	req.Key = c.String("key")
+
+	resp, err := gc.Append(context.Background(), name, data, &req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\n", resp.Url)
+	if resp.Skipped > 0 {
+		fmt.Printf("Appended %d rows (%d duplicates skipped)\n",
+			resp.Rows, resp.Skipped)
+	} else {
+		fmt.Printf("Appended %d rows\n", resp.Rows)
+	}
+
+	return nil
+}
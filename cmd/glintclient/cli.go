@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/nassibnassar/goconfig/ini"
@@ -45,6 +48,21 @@ func inputPassword(prompt string, confirm bool) (string, error) {
 	return string(p), nil
 }
 
+// confirm prints a question and returns true if the user answers "y" or
+// "yes".
+func confirm(prompt string) (bool, error) {
+	fmt.Print(prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
 // readConfig reads the specified configuration file and returns its contents
 // as a Config, or exits with an error message.
 func readConfig(file string) *ini.Config {
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Passwords and session tokens are kept out of the configuration file.
+// They are stored in the operating system's keyring (the macOS Keychain, or
+// the Secret Service on Linux) if it is available, and otherwise in a file
+// encrypted with a passphrase.  The remote section of the configuration
+// file records which store holds its credentials.
+
+// keyringService is the service name under which credentials are stored in
+// the keyring.
+const keyringService = "glint"
+
+// Credential stores.
+const (
+	storeKeyring = "keyring"
+	storeFile    = "file"
+)
+
+// credentialKey identifies a credential of the given kind ("password" or
+// "token") for the remote in a configuration file section.  The key does
+// not depend on the URL or user, so that they can be set in any order.
+func credentialKey(section, kind string) string {
+	return section + "." + kind
+}
+
+type credentialStore interface {
+	// get returns "" if there is no credential for key.
+	get(key string) (string, error)
+	set(key, value string) error
+	delete(key string) error
+}
+
+// openCredentialStore returns the store named by name, or if name is empty,
+// the store selected by core.credentials, or the keyring if it is
+// available.
+func openCredentialStore(name string) (credentialStore, string, error) {
+	if name == "" {
+		name = glintconfig.Get("core", "credentials")
+	}
+	if name == "" {
+		name = storeFile
+		if keyringAvailable() {
+			name = storeKeyring
+		}
+	}
+	switch name {
+	case storeKeyring:
+		return keyringStore{}, name, nil
+	case storeFile:
+		return credentialFile, name, nil
+	}
+	return nil, "", fmt.Errorf("Unknown credential store: %s", name)
+}
+
+// loadCredential returns a credential for the remote in section, or "" if
+// none has been saved.
+func loadCredential(section, kind string) (string, error) {
+	var name = glintconfig.Get(section, "credentials")
+	if name == "" {
+		return "", nil
+	}
+	var store, _, err = openCredentialStore(name)
+	if err != nil {
+		return "", err
+	}
+	return store.get(credentialKey(section, kind))
+}
+
+// saveCredential saves a credential for the remote in section, or deletes
+// it if value is empty.  Any plaintext copy in the configuration file is
+// removed.  The caller must write the configuration file.
+func saveCredential(section, kind, value string) error {
+	var store, name, err = openCredentialStore(
+		glintconfig.Get(section, "credentials"))
+	if err != nil {
+		return err
+	}
+	var key = credentialKey(section, kind)
+	if value == "" {
+		err = store.delete(key)
+	} else {
+		err = store.set(key, value)
+	}
+	if err != nil {
+		return err
+	}
+	glintconfig.Set(section, kind, "")
+	glintconfig.Set(section, "credentials", name)
+	return nil
+}
+
+// migrateCredentials moves a plaintext password or token in section of the
+// configuration file to the credential store.
+func migrateCredentials(section string) error {
+	var migrated bool
+	for _, kind := range []string{"password", "token"} {
+		var value = glintconfig.Get(section, kind)
+		if value == "" {
+			continue
+		}
+		if err := saveCredential(section, kind, value); err != nil {
+			return err
+		}
+		migrated = true
+	}
+	if !migrated {
+		return nil
+	}
+	if err := writeConfigFile(glintconfigfilename); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Moved credentials from %s to the %s "+
+		"credential store\n", glintconfigfilename,
+		glintconfig.Get(section, "credentials"))
+	return nil
+}
+
+// keyringStore stores credentials in the operating system's keyring.
+type keyringStore struct{}
+
+func keyringAvailable() bool {
+	var _, err = keyring.Get(keyringService, "probe")
+	return err == nil || err == keyring.ErrNotFound
+}
+
+func (keyringStore) get(key string) (string, error) {
+	var value, err = keyring.Get(keyringService, key)
+	if err == keyring.ErrNotFound {
+		return "", nil
+	}
+	return value, err
+}
+
+func (keyringStore) set(key, value string) error {
+	return keyring.Set(keyringService, key, value)
+}
+
+func (keyringStore) delete(key string) error {
+	var err = keyring.Delete(keyringService, key)
+	if err == keyring.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// fileStore stores credentials in a file encrypted with AES-256-GCM, using
+// a key derived from a passphrase with scrypt.  The passphrase is read from
+// GLINT_PASSPHRASE or from the terminal when the file is first used.
+type fileStore struct {
+	filename   string
+	passphrase string
+	salt       []byte
+	secrets    map[string]string
+}
+
+var credentialFile = &fileStore{}
+
+// encryptedFile is the format of the credential file.
+type encryptedFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// scrypt parameters recommended for interactive logins.
+const (
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+)
+
+func (f *fileStore) aead() (cipher.AEAD, error) {
+	var key, err = scrypt.Key([]byte(f.passphrase), f.salt, scryptN, scryptR,
+		scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	var block cipher.Block
+	block, err = aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (f *fileStore) readPassphrase(confirm bool) error {
+	if f.passphrase != "" {
+		return nil
+	}
+	f.passphrase = os.Getenv("GLINT_PASSPHRASE")
+	if f.passphrase != "" {
+		return nil
+	}
+	var err error
+	f.passphrase, err = inputPassword(
+		"Enter passphrase for "+f.filename+": ", confirm)
+	if err != nil {
+		return err
+	}
+	if f.passphrase == "" {
+		return errors.New("No passphrase specified")
+	}
+	return nil
+}
+
+// load reads and decrypts the file, or starts an empty store if the file
+// does not exist.
+func (f *fileStore) load() error {
+	if f.secrets != nil {
+		return nil
+	}
+	f.filename = credentialsfilename
+	var b, err = ioutil.ReadFile(f.filename)
+	if os.IsNotExist(err) {
+		if err = f.readPassphrase(true); err != nil {
+			return err
+		}
+		f.salt = make([]byte, 16)
+		if _, err = rand.Read(f.salt); err != nil {
+			return err
+		}
+		f.secrets = make(map[string]string)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ef encryptedFile
+	if err = json.Unmarshal(b, &ef); err != nil {
+		return fmt.Errorf("Error reading %s: %v", f.filename, err)
+	}
+	if err = f.readPassphrase(false); err != nil {
+		return err
+	}
+	f.salt = ef.Salt
+	var aead cipher.AEAD
+	aead, err = f.aead()
+	if err != nil {
+		return err
+	}
+	var plain []byte
+	plain, err = aead.Open(nil, ef.Nonce, ef.Data, nil)
+	if err != nil {
+		f.passphrase = ""
+		return fmt.Errorf("Unable to decrypt %s: incorrect passphrase",
+			f.filename)
+	}
+	var secrets map[string]string
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return fmt.Errorf("Error reading %s: %v", f.filename, err)
+	}
+	f.secrets = secrets
+	return nil
+}
+
+// save encrypts and writes the file.
+func (f *fileStore) save() error {
+	var aead, err = f.aead()
+	if err != nil {
+		return err
+	}
+	var plain []byte
+	plain, err = json.Marshal(f.secrets)
+	if err != nil {
+		return err
+	}
+	var ef = encryptedFile{Salt: f.salt, Nonce: make([]byte, aead.NonceSize())}
+	if _, err = rand.Read(ef.Nonce); err != nil {
+		return err
+	}
+	ef.Data = aead.Seal(nil, ef.Nonce, plain, nil)
+	var b []byte
+	b, err = json.Marshal(ef)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it, so that the store is not
+	// lost if writing fails.
+	var tmp = f.filename + ".tmp"
+	_ = os.Remove(tmp)
+	if err = ioutil.WriteFile(tmp, b, fileModeRW); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.filename)
+}
+
+func (f *fileStore) get(key string) (string, error) {
+	if err := f.load(); err != nil {
+		return "", err
+	}
+	return f.secrets[key], nil
+}
+
+func (f *fileStore) set(key, value string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	f.secrets[key] = value
+	return f.save()
+}
+
+func (f *fileStore) delete(key string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	if _, ok := f.secrets[key]; !ok {
+		return nil
+	}
+	delete(f.secrets, key)
+	return f.save()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupCredentialFile points the credential file at a temporary directory
+// and sets the passphrase read by fileStore.
+func setupCredentialFile(t *testing.T, passphrase string) string {
+	saved := credentialsfilename
+	credentialsfilename = filepath.Join(t.TempDir(), ".glintcredentials")
+	t.Cleanup(func() { credentialsfilename = saved })
+	t.Setenv("GLINT_PASSPHRASE", passphrase)
+	return credentialsfilename
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	filename := setupCredentialFile(t, "correct horse")
+	f := &fileStore{}
+	if err := f.set("origin.token", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.set("origin.password", "pw"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s3cret") {
+		t.Errorf("credential stored in plain text")
+	}
+
+	g := &fileStore{}
+	for key, want := range map[string]string{
+		"origin.token":    "s3cret",
+		"origin.password": "pw",
+		"other.token":     "",
+	} {
+		got, err := g.get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if err := g.delete("origin.token"); err != nil {
+		t.Fatal(err)
+	}
+	h := &fileStore{}
+	if v, err := h.get("origin.token"); err != nil || v != "" {
+		t.Errorf("deleted token = %q, %v", v, err)
+	}
+	if v, err := h.get("origin.password"); err != nil || v != "pw" {
+		t.Errorf("password = %q, %v", v, err)
+	}
+}
+
+func TestFileStoreWrongPassphrase(t *testing.T) {
+	setupCredentialFile(t, "correct horse")
+	if err := (&fileStore{}).set("origin.token", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GLINT_PASSPHRASE", "battery staple")
+	f := &fileStore{}
+	v, err := f.get("origin.token")
+	if err == nil || !strings.Contains(err.Error(), "incorrect passphrase") {
+		t.Errorf("get with wrong passphrase = %q, %v", v, err)
+	}
+	if f.secrets != nil || f.passphrase != "" {
+		t.Errorf("wrong passphrase kept")
+	}
+}
+
+func TestFileStoreTampered(t *testing.T) {
+	filename := setupCredentialFile(t, "correct horse")
+	if err := (&fileStore{}).set("origin.token", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ef encryptedFile
+	if err = json.Unmarshal(b, &ef); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []*[]byte{&ef.Data, &ef.Nonce, &ef.Salt} {
+		(*field)[0] ^= 1
+		b, err = json.Marshal(&ef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filename, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := (&fileStore{}).get("origin.token"); err == nil {
+			t.Errorf("tampered file read: %q", v)
+		}
+		(*field)[0] ^= 1
+	}
+	if err = ioutil.WriteFile(filename, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&fileStore{}).get("origin.token"); err == nil {
+		t.Errorf("corrupt file read")
+	}
+}
+
+func TestFileStoreMode(t *testing.T) {
+	filename := setupCredentialFile(t, "correct horse")
+	if err := (&fileStore{}).set("origin.token", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("mode %o, want 600", mode)
+	}
+	if _, err = os.Stat(filename + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+}
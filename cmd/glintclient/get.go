@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/client"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Exit codes returned by commands that read data.
+const (
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitAuth     = 4
+)
+
+// exitWith returns err as a cli.ExitCoder with the given code.
+func exitWith(err error, code int) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(cli.ExitCoder); ok {
+		return err
+	}
+	return cli.NewExitError(err, code)
+}
+
+// datasetPath returns "user/dataset" for an argument that is either of that
+// form or a dataset name belonging to the configured user.
+func datasetPath(arg string) (string, error) {
+	arg = strings.Trim(arg, "/")
+	if arg == "" {
+		return "", exitWith(errors.New("Data set not specified"),
+			exitUsage)
+	}
+	if strings.Contains(arg, "/") {
+		return arg, nil
+	}
+	user := glintremote.User
+	if user == "" {
+		return "", exitWith(errors.New("User not specified"), exitUsage)
+	}
+	return user + "/" + arg, nil
+}
+
+// splitPath splits "user/dataset" as returned by datasetPath.
+func splitPath(path string) (string, string) {
+	i := strings.IndexByte(path, '/')
+	return path[:i], path[i+1:]
+}
+
+func cliGet(c *cli.Context) error {
+	path, err := datasetPath(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	return download(path, nil, c.String("output"))
+}
+
+func cliQuery(c *cli.Context) error {
+	path, err := datasetPath(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	q := &client.Query{
+		Where: c.StringSlice("where"),
+		As:    c.String("as"),
+	}
+	if show := c.String("show"); show != "" {
+		q.Show = strings.Split(show, ",")
+	}
+	switch q.As {
+	case "", "csv", "tsv", "json":
+	default:
+		return exitWith(fmt.Errorf("Unknown output format: %s", q.As),
+			exitUsage)
+	}
+	return download(path, q, c.String("output"))
+}
+
+// cliDict retrieves a data dictionary describing each attribute of a data
+// set.
+func cliDict(c *cli.Context) error {
+	path, err := datasetPath(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	q := &client.Query{
+		Where: c.StringSlice("where"),
+		As:    c.String("as"),
+		Dict:  true,
+	}
+	switch q.As {
+	case "", "csv", "tsv", "json":
+	default:
+		return exitWith(fmt.Errorf("Unknown output format: %s", q.As),
+			exitUsage)
+	}
+	return download(path, q, c.String("output"))
+}
+
+// clientExitError returns an error from the client with an exit code
+// corresponding to the response status.
+func clientExitError(err error) error {
+	switch {
+	case client.IsNotFound(err):
+		return exitWith(err, exitNotFound)
+	case client.IsAuth(err):
+		return exitWith(err, exitAuth)
+	case client.IsBadRequest(err):
+		return exitWith(err, exitUsage)
+	}
+	return exitWith(err, exitError)
+}
+
+// download retrieves the data set at path ("user/dataset") selected by q,
+// which may be nil, and writes it to the file output, or to standard output
+// if output is "" or "-".  A progress indicator is written to standard
+// error if it is a terminal.
+func download(path string, q *client.Query, output string) error {
+	gc, err := newClient(false)
+	if err != nil {
+		return exitWith(err, exitError)
+	}
+	user, name := splitPath(path)
+	data, err := gc.Query(context.Background(), user, name, q)
+	if err != nil {
+		return clientExitError(err)
+	}
+	defer data.Close()
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if output != "" && output != "-" {
+		f, err = os.Create(output)
+		if err != nil {
+			return exitWith(err, exitError)
+		}
+		w = f
+	}
+	var body io.Reader = data
+	var p *progress
+	if terminal.IsTerminal(int(os.Stderr.Fd())) {
+		p = &progress{r: data, total: data.Size, updated: time.Now()}
+		body = p
+	}
+	_, err = io.Copy(w, body)
+	if p != nil {
+		p.finish()
+	}
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(output)
+		}
+	}
+	return exitWith(err, exitError)
+}
+
+// progress wraps a reader and reports the number of bytes read on standard
+// error, at most a few times per second.  Nothing is reported for transfers
+// that finish quickly.
+type progress struct {
+	r       io.Reader
+	total   int64
+	n       int64
+	updated time.Time
+	shown   bool
+}
+
+func (p *progress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if time.Since(p.updated) > 200*time.Millisecond {
+		p.updated = time.Now()
+		p.show()
+	}
+	return n, err
+}
+
+// set reports that n bytes have been transferred.
+func (p *progress) set(n int64) {
+	p.n = n
+	if time.Since(p.updated) > 200*time.Millisecond {
+		p.updated = time.Now()
+		p.show()
+	}
+}
+
+func (p *progress) show() {
+	p.shown = true
+	if p.total > 0 {
+		fmt.Fprintf(os.Stderr, "\r%s / %s (%d%%)", formatBytes(p.n),
+			formatBytes(p.total), p.n*100/p.total)
+	} else {
+		fmt.Fprintf(os.Stderr, "\r%s", formatBytes(p.n))
+	}
+}
+
+func (p *progress) finish() {
+	if p.shown {
+		p.show()
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+}
+
+// formatBytes formats a size in bytes using binary prefixes.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div),
+		"KMGTPE"[exp])
+}
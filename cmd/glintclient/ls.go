@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// printJSON writes v as indented JSON.
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", b)
+	return err
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func cliLs(c *cli.Context) error {
+	user := strings.Trim(c.Args().Get(0), "/")
+	if user == "" {
+		user = glintremote.User
+	}
+	if user == "" {
+		return exitWith(errors.New("User not specified"), exitUsage)
+	}
+	gc, err := newClient(false)
+	if err != nil {
+		return err
+	}
+
+	list, err := gc.List(context.Background(), user)
+	if err != nil {
+		return clientExitError(err)
+	}
+	if c.Bool("json") {
+		return printJSON(list)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tSIZE\tROWS\tCOLUMNS\tMODIFIED\n")
+	for _, d := range list.Datasets {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", d.Name,
+			formatBytes(d.Size), d.Rows, len(d.Columns),
+			formatTime(d.Modified))
+	}
+	return w.Flush()
+}
+
+func cliInfo(c *cli.Context) error {
+	path, err := datasetPath(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	gc, err := newClient(false)
+	if err != nil {
+		return err
+	}
+
+	user, name := splitPath(path)
+	info, err := gc.Info(context.Background(), user, name)
+	if err != nil {
+		return clientExitError(err)
+	}
+	if c.Bool("json") {
+		return printJSON(info)
+	}
+
+	fmt.Printf("Name:      %s\n", path)
+	fmt.Printf("URL:       %s\n", info.Url)
+	if info.Ark != "" {
+		fmt.Printf("ARK:       %s\n", info.Ark)
+	}
+	fmt.Printf("Size:      %s\n", formatBytes(info.Size))
+	fmt.Printf("Rows:      %d\n", info.Rows)
+	fmt.Printf("Modified:  %s\n", formatTime(info.Modified))
+	if md := info.Metadata; md != nil {
+		if md.Title != "" {
+			fmt.Printf("Title:     %s\n", md.Title)
+		}
+		if md.License != "" {
+			fmt.Printf("License:   %s\n", md.License)
+		}
+	}
+	if d := info.DerivedFrom; d != nil {
+		var source = d.Source
+		if d.Command != "" {
+			source += "?" + d.Command
+		}
+		fmt.Printf("Derived:   %s\n", source)
+	}
+	fmt.Printf("\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "COLUMN\tTYPE\tMETADATA\n")
+	for _, col := range info.Columns {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", col.Name, col.Type,
+			formatMetadata(col.Metadata))
+	}
+	return w.Flush()
+}
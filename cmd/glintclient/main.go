@@ -1,23 +1,22 @@
 package main
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"strings"
 
 	"github.com/glintdb/glintweb/api"
+	"github.com/glintdb/glintweb/client"
 	"github.com/nassibnassar/goconfig/ini"
 	"github.com/urfave/cli"
 )
 
 var glintconfig *ini.Config
 var glintconfigfilename string
+var credentialsfilename string
 
 // fileModeRW is the umask "-rw-------".
 const fileModeRW = 0600
@@ -26,25 +25,21 @@ func trimSlash(s string) string {
 	return strings.TrimRight(s, "/")
 }
 
-func responseBody(resp *http.Response) (string, error) {
-	b, err := ioutil.ReadAll(resp.Body)
-	return string(b), err
-}
-
-func responseBodyError(resp *http.Response) error {
-	body, err := responseBody(resp)
-	if err != nil {
-		return errors.New(body + " [" + err.Error() + "]")
-	}
-	return errors.New(body)
-}
-
+// getUserPassword returns the user and password for the selected remote,
+// prompting for the password if it is not configured.  If a session token
+// is configured, no password is needed and it is returned empty.
 func getUserPassword() (string, string, error) {
-	user := glintconfig.Get("remote", "user")
+	user := glintremote.User
 	if user == "" {
 		return "", "", errors.New("User not specified")
 	}
-	password := glintconfig.Get("remote", "password")
+	if err := loadRemoteCredentials(); err != nil {
+		return "", "", err
+	}
+	if glintremote.Token != "" {
+		return user, "", nil
+	}
+	password := glintremote.Password
 	if password == "" {
 		var err error
 		password, err = inputPassword(
@@ -64,80 +59,8 @@ func removeExtension(s string) string {
 	return s[0:i]
 }
 
-func cliMd(c *cli.Context) error {
-	user, password, err := getUserPassword()
-	if err != nil {
-		return err
-	}
-
-	fileAttr := c.Args().Get(0)
-	if fileAttr == "" {
-		return errors.New("Attribute not specified")
-	}
-
-	metadata := c.Args().Get(1)
-	if metadata == "" {
-		return errors.New("Metadata not specified")
-	}
-
-	var req api.MetadataRequest
-	req.Metadata = metadata
-
-	reqbody, err := json.Marshal(req)
-	if err != nil {
-		return err
-	}
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-	//client := &http.Client{}
-	remote := trimSlash(glintconfig.Get("remote", "url"))
-	url := remote + "/" + user + "/" + fileAttr
-	httpreq, err := http.NewRequest(http.MethodPut, url,
-		bytes.NewBuffer(reqbody))
-	if err != nil {
-		return err
-	}
-	httpreq.SetBasicAuth(user, password)
-	httpreq.Header.Set("Content-Type", "application/json")
-
-	httpresp, err := client.Do(httpreq)
-	if err != nil {
-		return err
-	}
-
-	if httpresp.StatusCode != http.StatusOK {
-		if httpresp.StatusCode == http.StatusUnauthorized {
-			fmt.Println("Server at '" + remote +
-				"' did not accept the username/password")
-		}
-		fmt.Println(httpresp.StatusCode)
-		fmt.Println("(1)")
-		return responseBodyError(httpresp)
-	}
-
-	// respbody, err := ioutil.ReadAll(httpresp.Body)
-	// if err != nil {
-	// 	fmt.Println("(2)")
-	// 	return err
-	// }
-
-	// var resp api.PostResponse
-	// err = json.Unmarshal(respbody, &resp)
-	// if err != nil {
-	// 	fmt.Println("(3)")
-	// 	return err
-	// }
-
-	// fmt.Printf("%s\n", resp.Url)
-
-	return nil
-}
-
 func cliPost(c *cli.Context) error {
-	user, password, err := getUserPassword()
+	gc, err := newClient(true)
 	if err != nil {
 		return err
 	}
@@ -152,68 +75,93 @@ func cliPost(c *cli.Context) error {
 		return err
 	}
 
-	// TODO Read line by line for conversion.
-	data, err := ioutil.ReadFile(dataFile)
-	if err != nil {
-		return err
+	req.Type = c.String("type")
+	req.NoHeader = c.Bool("no-header")
+	if columns := c.String("columns"); columns != "" {
+		for _, col := range strings.Split(columns, ",") {
+			req.Columns = append(req.Columns, strings.TrimSpace(col))
+		}
 	}
-	req.Data = strings.Replace(string(data), "\n", "\\n", -1)
-
-	reqbody, err := json.Marshal(req)
-	if err != nil {
-		return err
+	req.Overwrite = c.Bool("overwrite")
+	if mdFile := c.String("metadata"); mdFile != "" {
+		if req.Metadata, err = readMetadataFile(mdFile); err != nil {
+			return err
+		}
 	}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-	//client := &http.Client{}
-	remote := trimSlash(glintconfig.Get("remote", "url"))
 	fileName := removeExtension(fileinfo.Name())
-	url := remote + "/" + user + "/" + fileName
-	//fmt.Printf("url: [%s]\n", url)
-	//fmt.Printf("req: [%v]\n", string(reqbody))
-	httpreq, err := http.NewRequest(http.MethodPut, url,
-		bytes.NewBuffer(reqbody))
+	resp, err := postFile(gc, dataFile, fileName, &req)
 	if err != nil {
 		return err
 	}
-	httpreq.SetBasicAuth(user, password)
-	httpreq.Header.Set("Content-Type", "application/json")
 
-	httpresp, err := client.Do(httpreq)
-	if err != nil {
-		return err
+	fmt.Printf("%s\n", resp.Url)
+	if resp.Ark != "" {
+		fmt.Fprintf(os.Stderr, "Identifier: %s\n", resp.Ark)
+	}
+	if resp.Delimiter != "" {
+		fmt.Fprintf(os.Stderr, "Read %s data (delimiter %q, %s)\n",
+			resp.Type, resp.Delimiter, resp.Encoding)
+	} else if resp.Type != "" {
+		fmt.Fprintf(os.Stderr, "Read %s data (%s)\n", resp.Type,
+			resp.Encoding)
 	}
 
-	if httpresp.StatusCode != http.StatusCreated {
-		if httpresp.StatusCode == http.StatusUnauthorized {
-			fmt.Println("Server at '" + remote +
-				"' did not accept the username/password")
+	return nil
+}
+
+// postFile reads dataFile and posts it as the data set name, using the
+// options in req.  If req.Type is empty, the type is taken from the file
+// name extension, and if req.Metadata is nil, metadata are read from a
+// sidecar file if there is one.  Large files are sent in chunks.
+func postFile(gc *client.Client, dataFile, name string,
+	req *api.PostRequest) (*api.PostResponse, error) {
+	if req.Type == "" {
+		req.Type = typeFromExtension(dataFile)
+	}
+	if req.Metadata == nil {
+		if sidecar := findSidecar(dataFile); sidecar != "" {
+			md, err := readMetadataFile(sidecar)
+			if err != nil {
+				return nil, err
+			}
+			req.Metadata = md
 		}
-		fmt.Println(httpresp.StatusCode)
-		return responseBodyError(httpresp)
 	}
-
-	respbody, err := ioutil.ReadAll(httpresp.Body)
+	fi, err := os.Stat(dataFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	var resp api.PostResponse
-	err = json.Unmarshal(respbody, &resp)
+	if fi.Size() > client.DefaultChunkSize {
+		return uploadFile(gc, dataFile, name, req)
+	}
+	data, err := ioutil.ReadFile(dataFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return gc.Post(context.Background(), name, data, req)
+}
 
-	fmt.Printf("%s\n", resp.Url)
-
-	return nil
+// typeFromExtension returns the data type implied by a file name extension,
+// or "" if the server should detect the type.
+func typeFromExtension(filename string) string {
+	i := strings.LastIndexByte(filename, '.')
+	if i == -1 {
+		return ""
+	}
+	switch strings.ToLower(filename[i+1:]) {
+	case "tsv", "tab":
+		return "tsv"
+	case "json":
+		return "json"
+	case "ndjson", "jsonl":
+		return "ndjson"
+	}
+	return ""
 }
 
 func cliDelete(c *cli.Context) error {
-	user, password, err := getUserPassword()
+	gc, err := newClient(true)
 	if err != nil {
 		return err
 	}
@@ -223,151 +171,159 @@ func cliDelete(c *cli.Context) error {
 		return errors.New("Data file not specified")
 	}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-	//client := &http.Client{}
-	remote := trimSlash(glintconfig.Get("remote", "url"))
-	url := remote + "/" + user + "/" + fileName
-	//fmt.Printf("url: [%s]\n", url)
-	//fmt.Printf("req: [%v]\n", string(reqbody))
-	httpreq, err := http.NewRequest(http.MethodDelete, url, nil)
-	if err != nil {
-		return err
-	}
-	httpreq.SetBasicAuth(user, password)
-
-	httpresp, err := client.Do(httpreq)
+	err = gc.Delete(context.Background(), fileName)
 	if err != nil {
 		return err
 	}
 
-	if httpresp.StatusCode != http.StatusNoContent {
-		if httpresp.StatusCode == http.StatusUnauthorized {
-			fmt.Println("Server at '" + remote +
-				"' did not accept the username/password")
-		}
-		fmt.Println(httpresp.StatusCode)
-		return responseBodyError(httpresp)
-	}
-
 	fmt.Printf("OK\n")
 
 	return nil
 }
 
 func cliLogin(c *cli.Context) error {
-	user, password, err := getUserPassword()
+	// Log in with the password even if there is a token.
+	if err := loadRemoteCredentials(); err != nil {
+		return err
+	}
+	glintremote.Token = ""
+	gc, err := newClient(true)
 	if err != nil {
 		return err
 	}
 
-	var req api.LoginRequest
-
-	//req.Data = strings.Replace(string(data), "\n", "\\n", -1)
-
-	reqbody, err := json.Marshal(req)
+	resp, err := gc.Login(context.Background())
 	if err != nil {
 		return err
 	}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	if c.Bool("print") {
+		fmt.Printf("%s\n", resp.SessionId)
+		return nil
 	}
-	client := &http.Client{Transport: tr}
-	//client := &http.Client{}
-	remote := trimSlash(glintconfig.Get("remote", "url"))
-	url := remote + "/login"
-	//fmt.Printf("url: [%s]\n", url)
-	//fmt.Printf("req: [%v]\n", string(reqbody))
-	httpreq, err := http.NewRequest(http.MethodPost, url,
-		bytes.NewBuffer(reqbody))
+	err = saveCredential(glintremote.section, "token", resp.SessionId)
 	if err != nil {
 		return err
 	}
-	httpreq.SetBasicAuth(user, password)
-	httpreq.Header.Set("Content-Type", "application/json")
-
-	httpresp, err := client.Do(httpreq)
+	err = writeConfigFile(glintconfigfilename)
 	if err != nil {
 		return err
 	}
+	fmt.Printf("Logged in to %s as %s until %s\n", gc.BaseURL, gc.User,
+		resp.Expires.Local().Format("2006-01-02 15:04"))
 
-	if httpresp.StatusCode != http.StatusCreated {
-		if httpresp.StatusCode == http.StatusUnauthorized {
-			fmt.Println("Server at '" + remote +
-				"' did not accept the username/password")
+	return nil
+}
+
+func cliLogout(c *cli.Context) error {
+	err := loadRemoteCredentials()
+	if err != nil {
+		return err
+	}
+	if glintremote.Token != "" {
+		gc, err := newClient(false)
+		if err != nil {
+			return err
+		}
+		gc.Token = glintremote.Token
+		// A token the server no longer accepts is removed anyway.
+		err = gc.Logout(context.Background())
+		if err != nil && !client.IsAuth(err) {
+			return err
 		}
-		fmt.Println(httpresp.StatusCode)
-		return responseBodyError(httpresp)
 	}
+	err = saveCredential(glintremote.section, "token", "")
+	if err != nil {
+		return err
+	}
+	return writeConfigFile(glintconfigfilename)
+}
 
-	respbody, err := ioutil.ReadAll(httpresp.Body)
+func cliPasswordReset(c *cli.Context) error {
+	gc, err := newClient(false)
+	if err != nil {
+		return err
+	}
+	password, err := inputPassword("Enter new password: ", true)
 	if err != nil {
 		return err
 	}
 
-	var resp api.LoginResponse
-	err = json.Unmarshal(respbody, &resp)
+	err = gc.ResetPassword(context.Background(), c.String("reset-token"),
+		password)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("%s\n", resp.SessionId)
+	fmt.Printf("Updated password on server\n")
 
-	return nil
+	return updateSavedPassword(password)
 }
 
 func cliPasswd(c *cli.Context) error {
-	user, password, err := getUserPassword()
+	if c.String("reset-token") != "" {
+		return cliPasswordReset(c)
+	}
+	gc, err := newClient(true)
 	if err != nil {
 		return err
 	}
+	// A session token is not enough to change the password.
+	current := gc.Password
+	if current == "" {
+		current, err = inputPassword("Enter current password: ", false)
+		if err != nil {
+			return err
+		}
+	}
 
-	var req api.AccountPasswordRequest
-	req.Password, err = inputPassword("Enter new password: ", true)
+	password, err := inputPassword("Enter new password: ", true)
 	if err != nil {
 		return err
 	}
 
-	reqbody, err := json.Marshal(req)
+	err = gc.ChangePassword(context.Background(), current, password)
 	if err != nil {
 		return err
 	}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	fmt.Printf("Updated password on server\n")
+
+	// The server has revoked the session tokens.
+	if glintremote.Token != "" {
+		err = saveCredential(glintremote.section, "token", "")
+		if err != nil {
+			return err
+		}
+		err = writeConfigFile(glintconfigfilename)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Logged out; run \"glint login\" to log in again\n")
 	}
-	client := &http.Client{Transport: tr}
-	//client := &http.Client{}
-	remote := trimSlash(glintconfig.Get("remote", "url"))
-	httpreq, err := http.NewRequest("POST", remote+"/account/password",
-		bytes.NewBuffer(reqbody))
+
+	return updateSavedPassword(password)
+}
+
+// updateSavedPassword replaces the password saved for the selected remote,
+// if there is one.
+func updateSavedPassword(password string) error {
+	err := loadRemoteCredentials()
 	if err != nil {
 		return err
 	}
-	httpreq.SetBasicAuth(user, password)
-	httpreq.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(httpreq)
+	if glintremote.Password == "" {
+		return nil
+	}
+	err = saveCredential(glintremote.section, "password", password)
 	if err != nil {
 		return err
 	}
-
-	if resp.StatusCode != http.StatusCreated {
-		if resp.StatusCode == http.StatusUnauthorized {
-			fmt.Println("Server at '" + remote +
-				"' did not accept the username/password")
-		}
-		return responseBodyError(resp)
+	err = writeConfigFile(glintconfigfilename)
+	if err != nil {
+		return err
 	}
-
-	fmt.Printf("Updated password on server\n")
-
-	glintconfig.Set("remote", "password", req.Password)
-	fmt.Printf("Updated password in configuration file %s\n", glintconfigfilename)
-
+	fmt.Printf("Updated saved password\n")
 	return nil
 }
 
@@ -396,10 +352,18 @@ func cliConfig(c *cli.Context) error {
 		return errors.New("Missing key and value")
 	}
 
+	// The section is everything before the last ".", so that keys of
+	// named remotes can be set, e.g. remote.staging.url.
+	i := strings.LastIndexByte(key, '.')
+	if i <= 0 || i == len(key)-1 {
+		return errors.New("Key must have the form section.key")
+	}
+	section, name := key[:i], key[i+1:]
+
 	var err error
 	value := c.Args().Get(1)
 	if value == "" {
-		if key != "remote.password" {
+		if name != "password" {
 			return errors.New("Missing value")
 		}
 		// Passwords are a special case; we can use the
@@ -415,8 +379,14 @@ func cliConfig(c *cli.Context) error {
 		}
 	}
 
-	var sk []string = strings.Split(key, ".")
-	glintconfig.Set(sk[0], sk[1], value)
+	if name == "password" || name == "token" {
+		err = saveCredential(section, name, value)
+		if err != nil {
+			return err
+		}
+	} else {
+		glintconfig.Set(section, name, value)
+	}
 	err = writeConfigFile(glintconfigfilename)
 	if err != nil {
 		return err
@@ -428,6 +398,8 @@ func cliConfig(c *cli.Context) error {
 func main() {
 	// Read configuration file.
 	glintconfigfilename = os.Getenv("HOME") + "/" + ".glintconfig"
+	credentialsfilename = os.Getenv("HOME") + "/" + ".glintcredentials"
+	uploadsfilename = os.Getenv("HOME") + "/" + ".glintuploads"
 	glintconfig = readConfig(glintconfigfilename)
 	// Run commands specified on the command line.
 	cli.VersionFlag = cli.BoolFlag{
@@ -468,6 +440,13 @@ func main() {
 			Name:      "passwd",
 			Usage:     "Changes the user's password",
 			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name: "reset-token",
+					Usage: "reset the password using a token " +
+						"sent by the server administrator",
+				},
+			},
 			Action: func(c *cli.Context) error {
 				err := cliPasswd(c)
 				if err != nil {
@@ -477,10 +456,17 @@ func main() {
 			},
 		},
 		cli.Command{
-			Name:      "login",
-			Hidden:    true,
-			Usage:     "Authenticates with server and retrieves a session id",
+			Name: "login",
+			Usage: "Authenticates with the server and saves a " +
+				"session token",
 			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name: "print",
+					Usage: "print the token instead of " +
+						"saving it",
+				},
+			},
 			Action: func(c *cli.Context) error {
 				err := cliLogin(c)
 				if err != nil {
@@ -489,21 +475,109 @@ func main() {
 				return nil
 			},
 		},
+		cli.Command{
+			Name:      "logout",
+			Usage:     "Revokes and removes the saved session token",
+			ArgsUsage: " ",
+			Action: func(c *cli.Context) error {
+				err := cliLogout(c)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				return nil
+			},
+		},
+		cli.Command{
+			Name:  "remote",
+			Usage: "Manages named remote servers",
+			Subcommands: []cli.Command{
+				cli.Command{
+					Name:      "add",
+					Usage:     "Adds a remote",
+					ArgsUsage: "name url",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "user",
+							Usage: "user name on the remote",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						err := cliRemoteAdd(c)
+						if err != nil {
+							return cli.NewExitError(err, 1)
+						}
+						return nil
+					},
+				},
+				cli.Command{
+					Name:      "remove",
+					Usage:     "Removes a remote",
+					ArgsUsage: "name",
+					Action: func(c *cli.Context) error {
+						err := cliRemoteRemove(c)
+						if err != nil {
+							return cli.NewExitError(err, 1)
+						}
+						return nil
+					},
+				},
+				cli.Command{
+					Name:      "list",
+					Usage:     "Lists remotes, marking the default",
+					ArgsUsage: " ",
+					Action: func(c *cli.Context) error {
+						err := cliRemoteList(c)
+						if err != nil {
+							return cli.NewExitError(err, 1)
+						}
+						return nil
+					},
+				},
+				cli.Command{
+					Name:      "default",
+					Usage:     "Sets the default remote",
+					ArgsUsage: "name",
+					Action: func(c *cli.Context) error {
+						err := cliRemoteDefault(c)
+						if err != nil {
+							return cli.NewExitError(err, 1)
+						}
+						return nil
+					},
+				},
+			},
+		},
 		cli.Command{
 			Name:      "post",
 			Usage:     "Publishes data on the server",
 			ArgsUsage: " ",
 			Flags: []cli.Flag{
-				// TODO Implement --type and --no-header flags.
 				cli.StringFlag{
-					Name:  "type",
-					Usage: "file format",
+					Name: "type",
+					Usage: "file format: csv, tsv, ssv " +
+						"(semicolon), psv (vertical " +
+						"bar), fixed, json, or ndjson",
 				},
-				cli.StringFlag{
+				cli.BoolFlag{
 					Name: "no-header",
 					Usage: "data file does not include " +
 						"column names",
 				},
+				cli.StringFlag{
+					Name: "columns",
+					Usage: "comma-separated column names " +
+						"to use instead of the header",
+				},
+				cli.BoolFlag{
+					Name: "overwrite",
+					Usage: "replace the data set if it " +
+						"already exists",
+				},
+				cli.StringFlag{
+					Name: "metadata, m",
+					Usage: "read data set metadata from " +
+						"YAML or JSON `FILE`",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				err := cliPost(c)
@@ -513,6 +587,179 @@ func main() {
 				return nil
 			},
 		},
+		cli.Command{
+			Name:      "save",
+			Usage:     "Saves the result of a query as a data set",
+			ArgsUsage: "[user/]dataset?query name",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name: "overwrite",
+					Usage: "replace the data set if it " +
+						"already exists",
+				},
+				cli.StringFlag{
+					Name: "metadata, m",
+					Usage: "read data set metadata from " +
+						"YAML or JSON `FILE`",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliSave(c), exitError)
+			},
+		},
+		cli.Command{
+			Name:      "ls",
+			Usage:     "Lists a user's data sets",
+			ArgsUsage: "[user]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the listing as JSON",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliLs(c), exitError)
+			},
+		},
+		cli.Command{
+			Name:      "info",
+			Usage:     "Describes a data set and its columns",
+			ArgsUsage: "[user/]dataset",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the description as JSON",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliInfo(c), exitError)
+			},
+		},
+		cli.Command{
+			Name:      "get",
+			Usage:     "Retrieves data from the server",
+			ArgsUsage: "[user/]dataset",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "write data to `FILE`",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliGet(c), exitError)
+			},
+		},
+		cli.Command{
+			Name:      "query",
+			Usage:     "Retrieves selected data from the server",
+			ArgsUsage: "[user/]dataset",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "show",
+					Usage: "comma-separated attributes to show",
+				},
+				cli.StringSliceFlag{
+					Name: "where",
+					Usage: "select rows matching a condition " +
+						"such as wind_dir>10 " +
+						"(may be repeated)",
+				},
+				cli.StringFlag{
+					Name:  "as",
+					Usage: "output format: csv, tsv, or json",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "write data to `FILE`",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliQuery(c), exitError)
+			},
+		},
+		cli.Command{
+			Name:      "dict",
+			Usage:     "Describes each attribute of data on the server",
+			ArgsUsage: "[user/]dataset",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name: "where",
+					Usage: "describe only rows matching a " +
+						"condition (may be repeated)",
+				},
+				cli.StringFlag{
+					Name:  "as",
+					Usage: "output format: csv, tsv, or json",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "write the data dictionary to `FILE`",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliDict(c), exitError)
+			},
+		},
+		cli.Command{
+			Name:      "append",
+			Usage:     "Appends rows to data on the server",
+			ArgsUsage: "file [dataset]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name: "type",
+					Usage: "file format: csv, tsv, ssv " +
+						"(semicolon), psv (vertical " +
+						"bar), fixed, json, or ndjson",
+				},
+				cli.BoolFlag{
+					Name: "no-header",
+					Usage: "data file does not include " +
+						"column names",
+				},
+				cli.StringFlag{
+					Name: "key",
+					Usage: "skip rows whose value in this " +
+						"column is already present",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				err := cliAppend(c)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				return nil
+			},
+		},
+		cli.Command{
+			Name:      "sync",
+			Usage:     "Publishes the data files in a directory",
+			ArgsUsage: "directory user[/prefix]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name: "dry-run, n",
+					Usage: "show what would change " +
+						"without changing anything",
+				},
+				cli.BoolFlag{
+					Name: "delete",
+					Usage: "delete data sets that have no " +
+						"file in the directory",
+				},
+				cli.BoolFlag{
+					Name: "force",
+					Usage: "with --delete and no prefix, " +
+						"delete without asking",
+				},
+				cli.IntFlag{
+					Name:  "jobs, j",
+					Value: 4,
+					Usage: "number of parallel uploads",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliSync(c), exitError)
+			},
+		},
 		cli.Command{
 			Name:      "delete",
 			Usage:     "Deletes data from the server",
@@ -527,8 +774,22 @@ func main() {
 		},
 		cli.Command{
 			Name:      "md",
-			Usage:     "Adds metadata to an attribute",
-			ArgsUsage: " ",
+			Usage:     "Adds metadata to an attribute, or shows its metadata",
+			ArgsUsage: "[user/]dataset[.attribute] [key=value ...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name: "from",
+					Usage: "set the metadata of all attributes " +
+						"from a CSV, YAML, or JSON `FILE` " +
+						"(- for CSV on standard input)",
+				},
+				cli.StringFlag{
+					Name: "export",
+					Usage: "write the metadata of all attributes " +
+						"to a CSV, YAML, or JSON `FILE` " +
+						"(- for CSV on standard output)",
+				},
+			},
 			Action: func(c *cli.Context) error {
 				err := cliMd(c)
 				if err != nil {
@@ -537,6 +798,90 @@ func main() {
 				return nil
 			},
 		},
+		cli.Command{
+			Name:      "terms",
+			Usage:     "Finds metadata terms known to the server",
+			ArgsUsage: "[text]",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "limit",
+					Usage: "show at most `N` terms",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the server's JSON response",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliTerms(c), exitError)
+			},
+		},
+		cli.Command{
+			Name:      "search",
+			Usage:     "Finds data sets by name or metadata",
+			ArgsUsage: "[text]",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name: "owner",
+					Usage: "show data sets owned by `USER` " +
+						"(may be repeated)",
+				},
+				cli.StringSliceFlag{
+					Name: "license",
+					Usage: "show data sets with license `LICENSE` " +
+						"(may be repeated)",
+				},
+				cli.StringSliceFlag{
+					Name: "term",
+					Usage: "show data sets with an attribute " +
+						"described by `TERM` (may be repeated)",
+				},
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "show data sets covering time after `DATE`",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "show data sets covering time before `DATE`",
+				},
+				cli.IntFlag{
+					Name:  "limit",
+					Usage: "show at most `N` data sets",
+				},
+				cli.BoolFlag{
+					Name: "facets",
+					Usage: "show the number of matching data sets " +
+						"for each facet value",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the server's JSON response",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return exitWith(cliSearch(c), exitError)
+			},
+		},
+	}
+	// Every command that connects to a server accepts --remote and
+	// --insecure, which can also be given before the command.
+	remoteFlag := cli.StringFlag{
+		Name:  "remote, r",
+		Usage: "connect to the named remote `NAME`",
+	}
+	insecureFlag := cli.BoolFlag{
+		Name:  "insecure",
+		Usage: "do not verify the server's TLS certificate",
+	}
+	app.Flags = []cli.Flag{remoteFlag, insecureFlag}
+	for i := range app.Commands {
+		cmd := &app.Commands[i]
+		if cmd.Name == "config" || cmd.Name == "remote" {
+			continue
+		}
+		cmd.Flags = append(cmd.Flags, remoteFlag, insecureFlag)
+		cmd.Action = withRemote(
+			cmd.Action.(func(c *cli.Context) error))
 	}
 	app.Run(os.Args)
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/glintdb/glintweb/api"
+	"github.com/urfave/cli"
+)
+
+// metadataKeys are the fields of attribute metadata, in the order in which
+// they are printed.
+var metadataKeys = []string{
+	"term", "label", "description", "unit", "datatype", "missing",
+}
+
+func metadataFields(md *api.AttributeMetadata) []string {
+	return []string{md.Term, md.Label, md.Description, md.Unit,
+		md.Datatype, md.Missing}
+}
+
+// formatMetadata returns a one-line summary of attribute metadata: the term
+// followed by the unit in brackets.
+func formatMetadata(md *api.AttributeMetadata) string {
+	if md == nil {
+		return ""
+	}
+	s := md.Term
+	if md.Unit != "" {
+		s = strings.TrimSpace(s + " [" + md.Unit + "]")
+	}
+	return s
+}
+
+func validMetadataKey(key string) bool {
+	for _, k := range metadataKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMetadataArgs reads "key=value" arguments.  A single argument that
+// is not of that form is a term, as in "glint md ocean.t dc:date".
+func parseMetadataArgs(args []string) (map[string]string, error) {
+	set := make(map[string]string)
+	for _, a := range args {
+		i := strings.IndexByte(a, '=')
+		if i > 0 && validMetadataKey(a[:i]) {
+			set[a[:i]] = a[i+1:]
+			continue
+		}
+		if len(args) == 1 {
+			set["term"] = a
+			continue
+		}
+		return nil, fmt.Errorf("Invalid metadata '%s': expected "+
+			"key=value with a key of %s", a,
+			strings.Join(metadataKeys, ", "))
+	}
+	return set, nil
+}
+
+func cliMd(c *cli.Context) error {
+	arg := strings.Trim(c.Args().Get(0), "/")
+	if c.String("from") != "" || c.String("export") != "" {
+		return cliMdFile(c, arg)
+	}
+	if arg == "" {
+		return errors.New("Attribute not specified")
+	}
+	slash := strings.IndexByte(arg, '/')
+	i := slash + 1 + strings.IndexByte(arg[slash+1:], '.')
+	if i <= slash+1 || i == len(arg)-1 {
+		return errors.New("Attribute must have the form " +
+			"[user/]dataset.attribute")
+	}
+	path, err := datasetPath(arg[:i])
+	if err != nil {
+		return err
+	}
+	user, name := splitPath(path)
+	attr := arg[i+1:]
+
+	if c.NArg() == 1 {
+		return printMetadata(user, name, attr)
+	}
+	if user != glintremote.User {
+		return fmt.Errorf("Cannot add metadata to data sets of user '%s'",
+			user)
+	}
+	set, err := parseMetadataArgs(c.Args()[1:])
+	if err != nil {
+		return err
+	}
+	gc, err := newClient(true)
+	if err != nil {
+		return err
+	}
+	return gc.UpdateMetadata(context.Background(), name, attr, set)
+}
+
+// cliMdFile sets the metadata of the attributes of a data set from a file,
+// with --from, or exports them to a file, with --export.
+func cliMdFile(c *cli.Context, arg string) error {
+	from, export := c.String("from"), c.String("export")
+	if from != "" && export != "" {
+		return errors.New("Only one of --from and --export can be given")
+	}
+	if c.NArg() > 1 {
+		return errors.New("Metadata values cannot be given with " +
+			"--from or --export")
+	}
+	path, err := datasetPath(arg)
+	if err != nil {
+		return err
+	}
+	user, name := splitPath(path)
+
+	if export != "" {
+		gc, err := newClient(false)
+		if err != nil {
+			return err
+		}
+		info, err := gc.Info(context.Background(), user, name)
+		if err != nil {
+			return err
+		}
+		return writeAttributeMetadataFile(export, info.Columns)
+	}
+
+	if user != glintremote.User {
+		return fmt.Errorf("Cannot add metadata to data sets of user '%s'",
+			user)
+	}
+	attrs, err := readAttributeMetadataFile(from)
+	if err != nil {
+		return err
+	}
+	gc, err := newClient(true)
+	if err != nil {
+		return err
+	}
+	err = gc.UpdateMetadataBatch(context.Background(), name, attrs)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Updated metadata of %d attributes\n",
+		len(attrs))
+	return nil
+}
+
+// printMetadata prints the metadata of an attribute.
+func printMetadata(user, name, attr string) error {
+	gc, err := newClient(false)
+	if err != nil {
+		return err
+	}
+	info, err := gc.Info(context.Background(), user, name)
+	if err != nil {
+		return err
+	}
+	for _, col := range info.Columns {
+		if col.Name != attr {
+			continue
+		}
+		if col.Metadata == nil {
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for x, v := range metadataFields(col.Metadata) {
+			if v != "" {
+				fmt.Fprintf(w, "%s\t%s\n", metadataKeys[x], v)
+			}
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("Attribute '%s' not found in %s/%s", attr, user,
+		name)
+}
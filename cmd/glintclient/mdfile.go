@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glintdb/glintweb/api"
+	"gopkg.in/yaml.v3"
+)
+
+// metadataFileFormat returns the format of a file of attribute metadata,
+// "csv", "yaml", or "json", from its extension.  Standard input or output
+// ("-") is CSV.
+func metadataFileFormat(filename string) (string, error) {
+	if filename == "-" {
+		return "csv", nil
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".json":
+		return "json", nil
+	}
+	return "", fmt.Errorf("Unknown metadata file format: %s (expected "+
+		".csv, .yaml, .yml, or .json)", filename)
+}
+
+// readAttributeMetadataFile reads the metadata of several attributes.  A
+// CSV file has a column "attribute" naming each attribute and a column for
+// each metadata key that is set; a YAML or JSON file maps each attribute to
+// its keys and values.  Fields that are not in the file are kept, and empty
+// values remove fields.  If filename is "-", CSV is read from standard
+// input.
+func readAttributeMetadataFile(filename string) (map[string]map[string]string,
+	error) {
+	format, err := metadataFileFormat(filename)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	if filename == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var attrs map[string]map[string]string
+	if format == "csv" {
+		attrs, err = readMetadataCSV(bytes.NewReader(b))
+	} else {
+		attrs, err = readMetadataYAML(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return attrs, nil
+}
+
+func readMetadataCSV(r io.Reader) (map[string]map[string]string, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) == 0 || strings.TrimSpace(header[0]) != "attribute" {
+		return nil, fmt.Errorf("The first column must be 'attribute'")
+	}
+	for x := range header[1:] {
+		header[x+1] = strings.TrimSpace(header[x+1])
+		if !validMetadataKey(header[x+1]) {
+			return nil, fmt.Errorf("Unknown metadata key: %s",
+				header[x+1])
+		}
+	}
+	attrs := make(map[string]map[string]string)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		attr := strings.TrimSpace(rec[0])
+		if attr == "" {
+			continue
+		}
+		if _, ok := attrs[attr]; ok {
+			return nil, fmt.Errorf("Attribute listed twice: %s", attr)
+		}
+		set := make(map[string]string)
+		for x := 1; x < len(header); x++ {
+			set[header[x]] = rec[x]
+		}
+		attrs[attr] = set
+	}
+	return attrs, nil
+}
+
+func readMetadataYAML(b []byte) (map[string]map[string]string, error) {
+	// JSON is a subset of YAML.  Values are decoded as nodes so that
+	// their text is kept as written, e.g. "1.0" or "007" rather than the
+	// number they represent.
+	var v map[string]map[string]yaml.Node
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	attrs := make(map[string]map[string]string)
+	for attr, fields := range v {
+		set := make(map[string]string)
+		for k, e := range fields {
+			if !validMetadataKey(k) {
+				return nil, fmt.Errorf("Unknown metadata key for "+
+					"%s: %s", attr, k)
+			}
+			if e.Kind == yaml.AliasNode && e.Alias != nil {
+				e = *e.Alias
+			}
+			if e.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("Value of %s for %s must "+
+					"be a string", k, attr)
+			}
+			if e.Tag == "!!null" {
+				set[k] = ""
+			} else {
+				set[k] = e.Value
+			}
+		}
+		attrs[attr] = set
+	}
+	return attrs, nil
+}
+
+// writeAttributeMetadataFile writes the metadata of the columns of a data
+// set to filename, or to standard output if filename is "-", in a format
+// that readAttributeMetadataFile reads.  All fields are written, so that
+// fields removed from the file are removed when it is read back.
+func writeAttributeMetadataFile(filename string,
+	columns []api.ColumnInfo) error {
+	format, err := metadataFileFormat(filename)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(&b)
+		cw.Write(append([]string{"attribute"}, metadataKeys...))
+		for _, col := range columns {
+			cw.Write(append([]string{col.Name},
+				metadataFields(columnMetadata(col))...))
+		}
+		cw.Flush()
+		err = cw.Error()
+	case "yaml":
+		// A node is built so that attributes are written in order.
+		doc := &yaml.Node{Kind: yaml.MappingNode}
+		for _, col := range columns {
+			fields := &yaml.Node{Kind: yaml.MappingNode}
+			for x, v := range metadataFields(columnMetadata(col)) {
+				fields.Content = append(fields.Content,
+					&yaml.Node{Kind: yaml.ScalarNode,
+						Value: metadataKeys[x]},
+					&yaml.Node{Kind: yaml.ScalarNode, Value: v,
+						Style: yamlStyle(v)})
+			}
+			doc.Content = append(doc.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: col.Name},
+				fields)
+		}
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err = enc.Encode(doc); err == nil {
+			err = enc.Close()
+		}
+	case "json":
+		b.WriteString("{\n")
+		for x, col := range columns {
+			name, _ := json.Marshal(col.Name)
+			fmt.Fprintf(&b, "  %s: {\n", name)
+			for y, v := range metadataFields(columnMetadata(col)) {
+				value, _ := json.Marshal(v)
+				fmt.Fprintf(&b, "    %q: %s", metadataKeys[y], value)
+				if y < len(metadataKeys)-1 {
+					b.WriteString(",")
+				}
+				b.WriteString("\n")
+			}
+			b.WriteString("  }")
+			if x < len(columns)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n")
+	}
+	if err != nil {
+		return err
+	}
+	if filename == "-" {
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(filename, b.Bytes(), 0644)
+}
+
+// columnMetadata returns the metadata of a column, which are empty if it
+// has none.
+func columnMetadata(col api.ColumnInfo) *api.AttributeMetadata {
+	if col.Metadata == nil {
+		return &api.AttributeMetadata{}
+	}
+	return col.Metadata
+}
+
+// yamlStyle returns the style in which a metadata value is written in
+// YAML.  Values that would not be read back as the same string, such as
+// "-999", "true", or "", are quoted.
+func yamlStyle(v string) yaml.Style {
+	var i interface{}
+	if err := yaml.Unmarshal([]byte(v), &i); err == nil {
+		if s, ok := i.(string); ok && s == v {
+			return 0
+		}
+	}
+	return yaml.DoubleQuotedStyle
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadMetadataYAML(t *testing.T) {
+	attrs, err := readMetadataYAML([]byte(`
+t:
+  term: dc:date
+  missing: -999.0
+  unit:
+depth:
+  missing: 007
+  label: &l "Depth"
+  description: *l
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{
+		"t": {"term": "dc:date", "missing": "-999.0", "unit": ""},
+		"depth": {"missing": "007", "label": "Depth",
+			"description": "Depth"},
+	}
+	for attr, fields := range want {
+		for k, v := range fields {
+			if got, ok := attrs[attr][k]; !ok || got != v {
+				t.Errorf("%s.%s = %q, want %q", attr, k, got, v)
+			}
+		}
+	}
+	for _, b := range []string{
+		"t:\n  unit: [m, s]\n",
+		"t:\n  color: red\n",
+		`{"t": {"label": {"en": "Time"}}}`,
+	} {
+		if _, err = readMetadataYAML([]byte(b)); err == nil {
+			t.Errorf("%q: no error", b)
+		}
+	}
+}
+
+func TestReadAttributeMetadataStdin(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "md.csv")
+	err := ioutil.WriteFile(file, []byte("attribute,unit\nt,s\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+	attrs, err := readAttributeMetadataFile("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs["t"]["unit"] != "s" {
+		t.Errorf("read %v", attrs)
+	}
+}
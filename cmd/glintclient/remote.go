@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/glintdb/glintweb/client"
+	"github.com/urfave/cli"
+)
+
+// defaultRemote is the name of the remote stored in the [remote] section,
+// which is used if no other remote has been made the default.
+const defaultRemote = "default"
+
+// remoteConfig holds the settings of the remote that commands connect to.
+type remoteConfig struct {
+	Name     string
+	URL      string
+	User     string
+	Password string
+	Token    string
+
+	// CACert is a file of additional certificate authorities to trust,
+	// and ClientCert and ClientKey are files containing a certificate and
+	// private key for mutual TLS authentication.  Insecure disables
+	// certificate verification.
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	Insecure   bool
+
+	// client is the HTTP client used to connect to the remote.
+	client *http.Client
+
+	// section is the configuration file section of the remote, and
+	// loaded is true once credentials have been read from the
+	// credential store.
+	section string
+	loaded  bool
+}
+
+var glintremote remoteConfig
+
+// remoteSection returns the configuration file section of a named remote.
+func remoteSection(name string) string {
+	if name == defaultRemote {
+		return "remote"
+	}
+	return "remote." + name
+}
+
+// remoteNames returns the names of the configured remotes.
+func remoteNames() []string {
+	var names []string
+	if glintconfig.Get("remote", "url") != "" {
+		names = append(names, defaultRemote)
+	}
+	for _, n := range strings.Split(glintconfig.Get("core", "remotes"), ",") {
+		if n = strings.TrimSpace(n); n != "" && n != defaultRemote {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func validRemoteName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// selectRemote sets glintremote from the remote named name, or if name is
+// empty, from the remote named by GLINT_REMOTE or core.remote.  The
+// environment variables GLINT_REMOTE_URL, GLINT_USER, and GLINT_TOKEN
+// override the configured settings.
+func selectRemote(name string) error {
+	if name == "" {
+		name = os.Getenv("GLINT_REMOTE")
+	}
+	if name == "" {
+		name = glintconfig.Get("core", "remote")
+	}
+	if name == "" {
+		name = defaultRemote
+	}
+	section := remoteSection(name)
+	if err := migrateCredentials(section); err != nil {
+		return err
+	}
+	glintremote = remoteConfig{
+		Name:       name,
+		URL:        glintconfig.Get(section, "url"),
+		User:       glintconfig.Get(section, "user"),
+		CACert:     glintconfig.Get(section, "cacert"),
+		ClientCert: glintconfig.Get(section, "clientcert"),
+		ClientKey:  glintconfig.Get(section, "clientkey"),
+		section:    section,
+	}
+	if u := os.Getenv("GLINT_REMOTE_URL"); u != "" {
+		glintremote.URL = u
+	}
+	if u := os.Getenv("GLINT_USER"); u != "" {
+		glintremote.User = u
+	}
+	if t := os.Getenv("GLINT_TOKEN"); t != "" {
+		glintremote.Token = t
+		glintremote.loaded = true
+	}
+	if glintremote.URL == "" && name != defaultRemote {
+		return fmt.Errorf("Remote '%s' not found", name)
+	}
+	glintremote.URL = trimSlash(glintremote.URL)
+	return nil
+}
+
+// loadRemoteCredentials reads the saved token and password of the selected
+// remote from the credential store, the first time they are needed.
+func loadRemoteCredentials() error {
+	if glintremote.loaded {
+		return nil
+	}
+	var err error
+	glintremote.Token, err = loadCredential(glintremote.section, "token")
+	if err != nil {
+		return err
+	}
+	glintremote.Password, err = loadCredential(glintremote.section,
+		"password")
+	if err != nil {
+		return err
+	}
+	glintremote.loaded = true
+	return nil
+}
+
+// newClient returns a client for the selected remote.  If auth is true, the
+// saved token or password is used, and the password is prompted for if
+// neither has been saved.
+func newClient(auth bool) (*client.Client, error) {
+	gc := client.New(glintremote.URL)
+	gc.User = glintremote.User
+	gc.HTTPClient = glintremote.client
+	if auth {
+		user, password, err := getUserPassword()
+		if err != nil {
+			return nil, err
+		}
+		gc.User = user
+		gc.Password = password
+		gc.Token = glintremote.Token
+	}
+	return gc, nil
+}
+
+// withRemote wraps a command action so that the remote is selected from
+// the --remote flag of the command or of the application, and its HTTP
+// client is set up, before it runs.
+func withRemote(action func(c *cli.Context) error) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		name := c.String("remote")
+		if name == "" {
+			name = c.GlobalString("remote")
+		}
+		if err := selectRemote(name); err != nil {
+			return cli.NewExitError(err, exitUsage)
+		}
+		glintremote.Insecure = c.Bool("insecure") ||
+			c.GlobalBool("insecure")
+		var err error
+		glintremote.client, err = newHTTPClient(&glintremote)
+		if err != nil {
+			return cli.NewExitError(err, exitUsage)
+		}
+		return action(c)
+	}
+}
+
+func cliRemoteAdd(c *cli.Context) error {
+	name := c.Args().Get(0)
+	url := c.Args().Get(1)
+	if name == "" || url == "" {
+		return errors.New("Remote name and URL not specified")
+	}
+	if !validRemoteName(name) {
+		return fmt.Errorf("Invalid remote name: %s", name)
+	}
+	for _, n := range remoteNames() {
+		if n == name {
+			return fmt.Errorf("Remote '%s' already exists", name)
+		}
+	}
+	section := remoteSection(name)
+	glintconfig.Set(section, "url", trimSlash(url))
+	if user := c.String("user"); user != "" {
+		glintconfig.Set(section, "user", user)
+	}
+	if name != defaultRemote {
+		names := remoteNames()
+		if len(names) > 0 && names[0] == defaultRemote {
+			names = names[1:]
+		}
+		glintconfig.Set("core", "remotes",
+			strings.Join(append(names, name), ","))
+	}
+	return writeConfigFile(glintconfigfilename)
+}
+
+func cliRemoteRemove(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" {
+		return errors.New("Remote name not specified")
+	}
+	var found bool
+	var names []string
+	for _, n := range remoteNames() {
+		if n == name {
+			found = true
+		} else if n != defaultRemote {
+			names = append(names, n)
+		}
+	}
+	if !found {
+		return fmt.Errorf("Remote '%s' not found", name)
+	}
+	section := remoteSection(name)
+	if glintconfig.Get(section, "credentials") != "" {
+		for _, kind := range []string{"password", "token"} {
+			if err := saveCredential(section, kind, ""); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range []string{"url", "user", "password", "token",
+		"credentials", "cacert", "clientcert", "clientkey"} {
+		glintconfig.Set(section, key, "")
+	}
+	glintconfig.Set("core", "remotes", strings.Join(names, ","))
+	if glintconfig.Get("core", "remote") == name {
+		glintconfig.Set("core", "remote", "")
+	}
+	return writeConfigFile(glintconfigfilename)
+}
+
+func cliRemoteList(c *cli.Context) error {
+	current := glintconfig.Get("core", "remote")
+	if current == "" {
+		current = defaultRemote
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, n := range remoteNames() {
+		mark := " "
+		if n == current {
+			mark = "*"
+		}
+		section := remoteSection(n)
+		fmt.Fprintf(w, "%s %s\t%s\t%s\n", mark, n,
+			glintconfig.Get(section, "url"),
+			glintconfig.Get(section, "user"))
+	}
+	return w.Flush()
+}
+
+func cliRemoteDefault(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" {
+		return errors.New("Remote name not specified")
+	}
+	for _, n := range remoteNames() {
+		if n == name {
+			glintconfig.Set("core", "remote", name)
+			return writeConfigFile(glintconfigfilename)
+		}
+	}
+	return fmt.Errorf("Remote '%s' not found", name)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/glintdb/glintweb/api"
+	"github.com/urfave/cli"
+)
+
+// cliSave stores the result of a query as a new data set, e.g.
+// "glint save 'ann/ocean?where(depth>100)show(time,temp)' ocean_subset".
+func cliSave(c *cli.Context) error {
+	source := c.Args().Get(0)
+	name := c.Args().Get(1)
+	if source == "" || name == "" {
+		return exitWith(errors.New("Usage: glint save "+
+			"[user/]dataset?query name"), exitUsage)
+	}
+	var query string
+	if i := strings.IndexByte(source, '?'); i >= 0 {
+		source, query = source[:i], source[i:]
+	}
+	path, err := datasetPath(source)
+	if err != nil {
+		return err
+	}
+	gc, err := newClient(true)
+	if err != nil {
+		return exitWith(err, exitError)
+	}
+
+	var req api.PostRequest
+	req.Overwrite = c.Bool("overwrite")
+	if mdFile := c.String("metadata"); mdFile != "" {
+		if req.Metadata, err = readMetadataFile(mdFile); err != nil {
+			return exitWith(err, exitUsage)
+		}
+	}
+	resp, err := gc.Save(context.Background(), name, path+query, &req)
+	if err != nil {
+		return clientExitError(err)
+	}
+	fmt.Printf("%s\n", resp.Url)
+	if resp.Ark != "" {
+		fmt.Fprintf(os.Stderr, "Identifier: %s\n", resp.Ark)
+	}
+	return nil
+}
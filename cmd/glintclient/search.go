@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// cliSearch finds data sets on the server whose names or metadata contain
+// the words given, optionally restricted to facet values.
+func cliSearch(c *cli.Context) error {
+	gc, err := newClient(false)
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	for _, name := range []string{"owner", "license", "term"} {
+		for _, s := range c.StringSlice(name) {
+			params.Add(name, s)
+		}
+	}
+	for _, name := range []string{"from", "to"} {
+		if s := c.String(name); s != "" {
+			params.Set(name, s)
+		}
+	}
+	if n := c.Int("limit"); n > 0 {
+		params.Set("limit", strconv.Itoa(n))
+	}
+	result, err := gc.Search(context.Background(),
+		strings.Join(c.Args(), " "), params)
+	if err != nil {
+		return clientExitError(err)
+	}
+	if c.Bool("json") {
+		return printJSON(result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if c.Bool("facets") {
+		fmt.Fprintf(w, "FACET\tVALUE\tDATASETS\n")
+		for _, facet := range []string{"owner", "license", "term",
+			"decade"} {
+			for _, fc := range result.Facets[facet] {
+				fmt.Fprintf(w, "%s\t%s\t%d\n", facet, fc.Value,
+					fc.Count)
+			}
+		}
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "DATASET\tTITLE\tMODIFIED\n")
+	for _, hit := range result.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", hit.Dataset, hit.Title,
+			formatTime(hit.Modified))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(result.Results) < result.Total {
+		fmt.Fprintf(os.Stderr, "Showing %d of %d data sets\n",
+			len(result.Results), result.Total)
+	}
+	return nil
+}
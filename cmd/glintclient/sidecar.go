@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+	"gopkg.in/yaml.v3"
+)
+
+// sidecarExtensions are the extensions of metadata files that accompany a
+// data file: the metadata for "ocean.csv" are read from "ocean.meta.yaml",
+// "ocean.meta.yml", or "ocean.meta.json".
+var sidecarExtensions = []string{".meta.yaml", ".meta.yml", ".meta.json"}
+
+// isSidecar reports whether filename is the name of a metadata file.
+func isSidecar(filename string) bool {
+	for _, ext := range sidecarExtensions {
+		if strings.HasSuffix(strings.ToLower(filename), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// findSidecar returns the name of the metadata file for dataFile, or "" if
+// there is none.
+func findSidecar(dataFile string) string {
+	base := removeExtension(dataFile)
+	for _, ext := range sidecarExtensions {
+		if fi, err := os.Stat(base + ext); err == nil && fi.Mode().IsRegular() {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// readMetadataFile reads data set metadata from a YAML or JSON file.
+// Unknown fields are reported as errors, to catch misspelled keys.
+func readMetadataFile(filename string) (*api.DatasetMetadata, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".json") {
+		// The YAML is converted to JSON so that the keys are the same
+		// in both formats.
+		var v interface{}
+		if err = yaml.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		if b, err = json.Marshal(yamlToJSON(v)); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	var md api.DatasetMetadata
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err = d.Decode(&md); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &md, nil
+}
+
+// yamlToJSON converts values decoded from YAML into values that encode as
+// JSON.  Dates, which YAML decodes as times, are written back as dates.
+func yamlToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = yamlToJSON(e)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, e := range v {
+			m[fmt.Sprint(k)] = yamlToJSON(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = yamlToJSON(e)
+		}
+	case time.Time:
+		if v.Equal(v.Truncate(24*time.Hour)) && v.Location() == time.UTC {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	}
+	return v
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/glintdb/glintweb/api"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// syncAction is a change that sync makes on the server.
+type syncAction struct {
+	op   string // "add", "update", or "delete"
+	name string
+	file string
+}
+
+// hashFile returns the SHA-256 hash of a file in the form reported by the
+// server.
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// planSync compares the files in dir with the data sets in list whose
+// names begin with prefix, and returns the actions needed to make the
+// server match the directory.  Files whose data set names would contain
+// "." are reported as an error, because the server reads a name such as
+// "ocean.2018" as the attribute "2018" of the data set "ocean".
+func planSync(dir string, prefix string, list *api.DatasetList,
+	del bool) ([]syncAction, error) {
+	remote := make(map[string]string)
+	for _, d := range list.Datasets {
+		if strings.HasPrefix(d.Name, prefix) {
+			remote[d.Name] = d.Hash
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var actions []syncAction
+	var invalid []string
+	local := make(map[string]bool)
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || strings.HasPrefix(e.Name(), ".") ||
+			isSidecar(e.Name()) {
+			continue
+		}
+		file := filepath.Join(dir, e.Name())
+		name := prefix + removeExtension(e.Name())
+		if strings.ContainsRune(name, '.') {
+			invalid = append(invalid, e.Name())
+			continue
+		}
+		if local[name] {
+			return nil, fmt.Errorf("More than one file would be "+
+				"posted as '%s'", name)
+		}
+		local[name] = true
+		hash, ok := remote[name]
+		if !ok {
+			actions = append(actions, syncAction{"add", name, file})
+			continue
+		}
+		h, err := hashFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if h != hash {
+			actions = append(actions,
+				syncAction{"update", name, file})
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("Data set names cannot contain '.'; "+
+			"rename these files: %s", strings.Join(invalid, ", "))
+	}
+	if del {
+		for name := range remote {
+			if !local[name] {
+				actions = append(actions,
+					syncAction{"delete", name, ""})
+			}
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].name < actions[j].name
+	})
+	return actions, nil
+}
+
+func cliSync(c *cli.Context) error {
+	dir := c.Args().Get(0)
+	target := c.Args().Get(1)
+	if dir == "" || target == "" {
+		return exitWith(errors.New("Directory and user/prefix not "+
+			"specified"), exitUsage)
+	}
+	sp := strings.SplitN(strings.TrimLeft(target, "/"), "/", 2)
+	syncUser := sp[0]
+	var prefix string
+	if len(sp) == 2 {
+		prefix = sp[1]
+	}
+	if strings.ContainsRune(prefix, '.') {
+		return exitWith(errors.New("Data set names cannot contain '.'"),
+			exitUsage)
+	}
+	jobs := c.Int("jobs")
+	if jobs < 1 {
+		return exitWith(errors.New("--jobs must be at least 1"),
+			exitUsage)
+	}
+
+	gc, err := newClient(false)
+	if err != nil {
+		return err
+	}
+	list, err := gc.List(context.Background(), syncUser)
+	if err != nil {
+		return clientExitError(err)
+	}
+	actions, err := planSync(dir, prefix, list, c.Bool("delete"))
+	if err != nil {
+		return err
+	}
+	if c.Bool("dry-run") {
+		for _, a := range actions {
+			if a.file != "" {
+				fmt.Printf("%-6s  %s  (%s)\n", a.op, a.name, a.file)
+			} else {
+				fmt.Printf("%-6s  %s\n", a.op, a.name)
+			}
+		}
+		fmt.Printf("%d changes (dry run)\n", len(actions))
+		return nil
+	}
+	if len(actions) == 0 {
+		fmt.Printf("Up to date\n")
+		return nil
+	}
+	// Without a prefix, --delete applies to all of the user's data sets,
+	// which is easily done by mistake.
+	var deletes int
+	for _, a := range actions {
+		if a.op == "delete" {
+			deletes++
+		}
+	}
+	if deletes > 0 && prefix == "" && !c.Bool("force") {
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			return exitWith(fmt.Errorf("--delete without a prefix "+
+				"would delete %d of %s's data sets; give a "+
+				"prefix or --force", deletes, syncUser),
+				exitUsage)
+		}
+		ok, err := confirm(fmt.Sprintf("Delete %d of %s's data sets "+
+			"that have no file in %s? [y/N] ", deletes, syncUser,
+			dir))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("Sync cancelled")
+		}
+	}
+
+	gc, err = newClient(true)
+	if err != nil {
+		return err
+	}
+	if gc.User != syncUser {
+		return exitWith(fmt.Errorf("Configured user '%s' cannot "+
+			"modify data belonging to '%s'", gc.User, syncUser),
+			exitAuth)
+	}
+
+	var mu sync.Mutex
+	var failed int
+	ch := make(chan syncAction)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range ch {
+				var err error
+				switch a.op {
+				case "delete":
+					err = gc.Delete(context.Background(),
+						a.name)
+				default:
+					req := api.PostRequest{
+						Overwrite: a.op == "update",
+					}
+					_, err = postFile(gc, a.file, a.name,
+						&req)
+				}
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Fprintf(os.Stderr, "%-6s  %s: %v\n",
+						a.op, a.name, err)
+				} else {
+					fmt.Printf("%-6s  %s\n", a.op, a.name)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, a := range actions {
+		ch <- a
+	}
+	close(ch)
+	wg.Wait()
+
+	if failed > 0 {
+		return exitWith(fmt.Errorf("%d of %d changes failed", failed,
+			len(actions)), exitError)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+func syncDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "glint-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, data := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data),
+			0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPlanSync(t *testing.T) {
+	dir := syncDir(t, map[string]string{
+		"buoy.csv":  "a\n1\n",
+		"ocean.csv": "a\n2\n",
+		"same.csv":  "a\n3\n",
+		".hidden":   "a\n4\n",
+	})
+	same, err := hashFile(filepath.Join(dir, "same.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := &api.DatasetList{Datasets: []api.DatasetInfo{
+		{Name: "n_ocean", Hash: "sha256:old"},
+		{Name: "n_same", Hash: same},
+		{Name: "n_gone"},
+		{Name: "other"},
+	}}
+	actions, err := planSync(dir, "n_", list, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range actions {
+		got = append(got, a.op+" "+a.name)
+	}
+	want := []string{"add n_buoy", "delete n_gone", "update n_ocean"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPlanSyncDottedNames(t *testing.T) {
+	dir := syncDir(t, map[string]string{
+		"ocean.2018.csv": "a\n1\n",
+		"buoy.csv":       "a\n1\n",
+	})
+	_, err := planSync(dir, "", &api.DatasetList{}, false)
+	if err == nil || !strings.Contains(err.Error(), "ocean.2018.csv") {
+		t.Errorf("error %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// cliTerms lists metadata terms that match a query, or the vocabulary
+// prefixes if there is no query.
+func cliTerms(c *cli.Context) error {
+	gc, err := newClient(false)
+	if err != nil {
+		return err
+	}
+	q := c.Args().Get(0)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if q == "" {
+		prefixes, err := gc.Prefixes(context.Background())
+		if err != nil {
+			return clientExitError(err)
+		}
+		if c.Bool("json") {
+			return printJSON(prefixes)
+		}
+		var names []string
+		for p := range prefixes {
+			names = append(names, p)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(w, "PREFIX\tNAMESPACE\n")
+		for _, p := range names {
+			fmt.Fprintf(w, "%s\t%s\n", p, prefixes[p])
+		}
+		return w.Flush()
+	}
+	list, err := gc.Terms(context.Background(), q, c.Int("limit"))
+	if err != nil {
+		return clientExitError(err)
+	}
+	if c.Bool("json") {
+		return printJSON(list)
+	}
+	fmt.Fprintf(w, "TERM\tLABEL\tURI\n")
+	for _, t := range list.Terms {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.Id, t.Label, t.Uri)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// newHTTPClient returns an HTTP client that verifies the server certificate
+// of the remote r against the system's certificate authorities and, if
+// r.CACert is set, the authorities in that file.  If r.ClientCert is set,
+// the client presents it for mutual TLS authentication.
+func newHTTPClient(r *remoteConfig) (*http.Client, error) {
+	config := &tls.Config{}
+	if r.Insecure {
+		fmt.Fprintf(os.Stderr, "WARNING: TLS certificate verification "+
+			"is disabled (--insecure)\n")
+		config.InsecureSkipVerify = true
+	}
+	if r.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(r.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA certificate: %v",
+				err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s",
+				r.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if r.ClientCert != "" || r.ClientKey != "" {
+		if r.ClientCert == "" || r.ClientKey == "" {
+			return nil, errors.New("Client certificate requires both " +
+				"clientcert and clientkey")
+		}
+		cert, err := tls.LoadX509KeyPair(r.ClientCert, r.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading client "+
+				"certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	// The default transport's proxy, timeout, and HTTP/2 settings are kept.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewHTTPClientCACert(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	cacert := filepath.Join(t.TempDir(), "ca.pem")
+	err := ioutil.WriteFile(cacert, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newHTTPClient(&remoteConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Get(ts.URL); err == nil {
+		t.Errorf("untrusted certificate accepted")
+	}
+
+	c, err = newHTTPClient(&remoteConfig{CACert: cacert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	tr := c.Transport.(*http.Transport)
+	if tr.Proxy == nil || tr.TLSHandshakeTimeout == 0 ||
+		!tr.ForceAttemptHTTP2 {
+		t.Errorf("default transport settings not kept")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+	"github.com/glintdb/glintweb/client"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Files larger than client.DefaultChunkSize are posted with a resumable
+// upload session.  The ids of unfinished sessions are saved in
+// uploadsfilename, so that posting the same file again resumes the upload.
+
+var uploadsfilename string
+
+// uploadsMu serializes access to the uploads file by concurrent posts.
+var uploadsMu sync.Mutex
+
+// uploadKey identifies an upload of a file with the given hash as a data set.
+func uploadKey(gc *client.Client, name, hash string) string {
+	return gc.BaseURL + "/" + gc.User + "/" + name + " " + hash
+}
+
+func readUploads() map[string]string {
+	uploads := make(map[string]string)
+	b, err := ioutil.ReadFile(uploadsfilename)
+	if err == nil {
+		json.Unmarshal(b, &uploads)
+	}
+	return uploads
+}
+
+// saveUpload records the session id for key, or removes it if id is "".
+func saveUpload(key, id string) {
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+	uploads := readUploads()
+	if id == "" {
+		delete(uploads, key)
+	} else {
+		uploads[key] = id
+	}
+	b, err := json.Marshal(uploads)
+	if err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(uploadsfilename, b, fileModeRW); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", uploadsfilename,
+			err)
+	}
+}
+
+// uploadFile posts dataFile in chunks as the data set name, resuming an
+// earlier upload of the same file if there is one.
+func uploadFile(gc *client.Client, dataFile, name string,
+	req *api.PostRequest) (*api.PostResponse, error) {
+	f, err := os.Open(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashFile(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	key := uploadKey(gc, name, hash)
+	uploadsMu.Lock()
+	id := readUploads()[key]
+	uploadsMu.Unlock()
+
+	u := &client.Upload{
+		Name:     name,
+		Reader:   f,
+		Size:     fi.Size(),
+		Checksum: hash,
+		Options:  req,
+		Id:       id,
+		Started:  func(id string) { saveUpload(key, id) },
+	}
+	if id != "" {
+		fmt.Fprintf(os.Stderr, "Resuming upload of %s\n", dataFile)
+	}
+	var p *progress
+	if terminal.IsTerminal(int(os.Stderr.Fd())) {
+		p = &progress{total: fi.Size(), updated: time.Now()}
+		u.Progress = p.set
+	}
+	resp, err := gc.Upload(context.Background(), u)
+	if p != nil {
+		p.finish()
+	}
+	if err != nil {
+		// The session is kept for resuming only if the server could
+		// not be reached.
+		if _, ok := err.(*client.Error); ok {
+			saveUpload(key, "")
+		}
+		return nil, err
+	}
+	saveUpload(key, "")
+	return resp, nil
+}
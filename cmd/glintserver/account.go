@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/glintdb/glintweb/server"
+	"github.com/urfave/cli"
+)
+
+func cliUnlock(c *cli.Context) error {
+	_, storage, err := setup(c, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup(nil, storage)
+	user := c.String("user")
+	address := c.String("address")
+	if user == "" && address == "" {
+		return errors.New("User or address not specified")
+	}
+	if user != "" {
+		err = storage.ResetLoginFailures(user)
+		auditAdmin(storage, server.AuditUnlock, user, err)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("User '%s' unlocked\n", user)
+	}
+	if address != "" {
+		if net.ParseIP(address) == nil {
+			return errors.New("Invalid IP address: " + address)
+		}
+		err = storage.UnlockAddress(address)
+		auditAdmin(storage, server.AuditUnlock, address, err)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Address %s unlocked\n", address)
+	}
+	return nil
+}
+
+func cliDisable(c *cli.Context, disabled bool) error {
+	_, storage, err := setup(c, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup(nil, storage)
+	user := c.String("user")
+	if user == "" {
+		return errors.New("User not specified")
+	}
+	err = storage.SetAccountDisabled(user, disabled)
+	if disabled {
+		auditAdmin(storage, server.AuditDisable, user, err)
+	} else {
+		auditAdmin(storage, server.AuditEnable, user, err)
+	}
+	if err != nil {
+		return err
+	}
+	if disabled {
+		fmt.Printf("User '%s' disabled\n", user)
+	} else {
+		fmt.Printf("User '%s' enabled\n", user)
+	}
+	return nil
+}
+
+func cliBind(c *cli.Context) error {
+	_, storage, err := setup(c, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup(nil, storage)
+	user := c.String("user")
+	provider := c.String("provider")
+	subject := c.String("subject")
+	if user == "" || subject == "" {
+		return errors.New("User or subject not specified")
+	}
+	if provider != "ldap" && provider != "oidc" {
+		return errors.New("Provider must be ldap or oidc")
+	}
+	err = storage.BindExternalPerson(user, provider, subject)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("User '%s' does not exist, has a password, "+
+			"or is already bound", user)
+	}
+	auditAdmin(storage, server.AuditBind, user, err)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User '%s' bound to %s %s\n", user, provider, subject)
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/glintdb/glintweb/server"
 	"github.com/urfave/cli"
 )
 
@@ -18,6 +19,9 @@ func cliAddUser(c *cli.Context) error {
 	if user == "" {
 		return errors.New("User not specified")
 	}
+	if server.ReservedUsername(user) {
+		return fmt.Errorf("Username '%s' is reserved", user)
+	}
 	// Get full name.
 	fullname := c.String("fullname")
 	// Get email address.
@@ -29,6 +33,7 @@ func cliAddUser(c *cli.Context) error {
 	}
 	// Add to Postgres.
 	err = storage.AddPerson(user, fullname, email, password)
+	auditAdmin(storage, server.AuditAddUser, user, err)
 	if err != nil {
 		return err
 	}
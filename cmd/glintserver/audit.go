@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"text/tabwriter"
+	"time"
+
+	"github.com/glintdb/glintweb/server"
+	"github.com/urfave/cli"
+)
+
+// auditAdmin records an audit event for an administrative command run on
+// the server host.  The actor is the operating system user who ran it.
+func auditAdmin(storage server.Storage, action string, target string,
+	err error) {
+	actor := "glintserver"
+	if u, uerr := user.Current(); uerr == nil {
+		actor += ":" + u.Username
+	}
+	e := &server.AuditEvent{
+		Actor:   actor,
+		IP:      "local",
+		Action:  action,
+		Target:  target,
+		Outcome: server.AuditSuccess,
+	}
+	if err != nil {
+		e.Outcome = server.AuditFailure
+		e.Detail = err.Error()
+	}
+	if aerr := storage.AddAuditEvent(e); aerr != nil {
+		fmt.Fprintf(os.Stderr, "%sError writing audit event: %v\n",
+			errorPrefix, aerr)
+	}
+}
+
+// parseTime accepts either an RFC 3339 time or a date.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+func cliAudit(c *cli.Context) error {
+	_, storage, err := setup(c, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup(nil, storage)
+	f := server.AuditFilter{
+		Actor:  c.String("user"),
+		Action: c.String("action"),
+		Target: c.String("target"),
+		Limit:  c.Int("limit"),
+	}
+	if s := c.String("since"); s != "" {
+		if f.Since, err = parseTime(s); err != nil {
+			return fmt.Errorf("Invalid time: %s", s)
+		}
+	}
+	if s := c.String("until"); s != "" {
+		if f.Until, err = parseTime(s); err != nil {
+			return fmt.Errorf("Invalid time: %s", s)
+		}
+	}
+	events, err := storage.LookupAuditEvents(&f)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "TIME\tACTOR\tIP\tACTION\tTARGET\tOUTCOME\tDETAIL\n")
+	for _, e := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Time.Local().Format(time.RFC3339), e.Actor, e.IP,
+			e.Action, e.Target, e.Outcome, e.Detail)
+	}
+	return tw.Flush()
+}
@@ -125,6 +125,11 @@ func main() {
 					Name:  "user",
 					Usage: "username",
 				},
+				cli.BoolFlag{
+					Name: "reset",
+					Usage: "send the user a password reset " +
+						"token instead of setting a password",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				err = cliPasswd(c)
@@ -134,6 +139,133 @@ func main() {
 				return nil
 			},
 		},
+		cli.Command{
+			Name:      "unlock",
+			Usage:     "Unlocks an account or address after failed logins",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "username",
+				},
+				cli.StringFlag{
+					Name:  "address",
+					Usage: "client IP address",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				err = cliUnlock(c)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				return nil
+			},
+		},
+		cli.Command{
+			Name:      "disable",
+			Usage:     "Disables a user account",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "username",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				err = cliDisable(c, true)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				return nil
+			},
+		},
+		cli.Command{
+			Name:      "enable",
+			Usage:     "Re-enables a disabled user account",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "username",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				err = cliDisable(c, false)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				return nil
+			},
+		},
+		cli.Command{
+			Name: "bind",
+			Usage: "Binds an account with no provider to an " +
+				"LDAP or OpenID Connect identity",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "username",
+				},
+				cli.StringFlag{
+					Name:  "provider",
+					Usage: "authentication provider (ldap or oidc)",
+				},
+				cli.StringFlag{
+					Name: "subject",
+					Usage: "identity at the provider (LDAP " +
+						"distinguished name or OpenID sub claim)",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				err = cliBind(c)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				return nil
+			},
+		},
+		cli.Command{
+			Name:      "audit",
+			Usage:     "Lists audit log events",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "only events by this user",
+				},
+				cli.StringFlag{
+					Name: "action",
+					Usage: "only events with this action " +
+						"(e.g. post, delete, metadata, " +
+						"password, login, login_failed)",
+				},
+				cli.StringFlag{
+					Name: "target",
+					Usage: "only events with a target " +
+						"beginning with this path",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only events at or after this time",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "only events before this time",
+				},
+				cli.IntFlag{
+					Name:  "limit",
+					Usage: "maximum number of events to list",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				err = cliAudit(c)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				return nil
+			},
+		},
 	}
 	app.Run(os.Args)
 }
@@ -68,6 +68,13 @@ func setup(c *cli.Context, logging bool) (*os.File, server.Storage, error) {
 	}
 	// Read configuration file.
 	glintconfig = oldReadConfig(configPath)
+	// Set the password policy.
+	var policy *server.PasswordPolicy
+	policy, err = passwordPolicy(glintconfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	server.SetPasswordPolicy(policy)
 	// Set up logging.
 	var logfile *os.File = nil
 	if logging {
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/glintdb/glintweb/server"
 	"github.com/urfave/cli"
 )
 
@@ -18,11 +19,26 @@ func cliPasswd(c *cli.Context) error {
 	if user == "" {
 		return errors.New("User not specified")
 	}
+	if c.Bool("reset") {
+		mail, err := mailSender(glintconfig)
+		if err != nil {
+			return err
+		}
+		email, err := server.RequestPasswordReset(storage, mail, user)
+		auditAdmin(storage, server.AuditPasswordReset, user, err)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Password reset token for user '%s' sent to %s\n",
+			user, email)
+		return nil
+	}
 	password, err := inputPassword("Enter new password: ", false)
 	if err != nil {
 		return errors.New("Error inputting password")
 	}
 	err = storage.ChangePassword(user, password)
+	auditAdmin(storage, server.AuditPassword, user, err)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/glintdb/glintweb/server"
+	"github.com/nassibnassar/goconfig/ini"
+)
+
+// passwordPolicy reads the password policy from the [password] section of
+// the configuration file, using defaults for any settings not given.
+func passwordPolicy(config *ini.Config) (*server.PasswordPolicy, error) {
+	p := server.DefaultPasswordPolicy()
+	ints := []struct {
+		key string
+		v   *int
+	}{
+		{"minlength", &p.MinLength},
+		{"maxlength", &p.MaxLength},
+		{"minclasses", &p.MinClasses},
+	}
+	for _, i := range ints {
+		s := config.Get("password", i.key)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf(
+				"Invalid value for password.%s: %s", i.key, s)
+		}
+		*i.v = n
+	}
+	if p.MaxLength < p.MinLength {
+		return nil, fmt.Errorf("password.maxlength is less than " +
+			"password.minlength")
+	}
+	if blocklist := config.Get("password", "blocklist"); blocklist != "" {
+		if err := p.LoadBlocklist(blocklist); err != nil {
+			return nil, fmt.Errorf("Error reading password "+
+				"blocklist: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// mailSender creates the MailSender configured in the [mail] section of the
+// configuration file.
+func mailSender(config *ini.Config) (server.MailSender, error) {
+	sender := coalesce("", config.Get("mail", "sender"), "file")
+	switch sender {
+	case "file":
+		dir := config.Get("mail", "dir")
+		if dir == "" {
+			return nil, fmt.Errorf("Mail directory (mail.dir) " +
+				"not specified")
+		}
+		return &server.FileMailSender{
+			Dir:  dir,
+			From: coalesce("", config.Get("mail", "from"), "glint"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown mail sender: %s", sender)
+	}
+}
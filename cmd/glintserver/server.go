@@ -95,6 +95,11 @@ func cliNewServer(c *cli.Context) error {
 	warnConfigChange(config, "http.sslcert", "http.tlscert")
 	warnConfigChange(config, "http.sslkey", "http.tlskey")
 
+	policy, err := passwordPolicy(config)
+	if err != nil {
+		return serverErr(err)
+	}
+
 	logf, err := logToFile(coalesce("", config.Get("log", "file"), ""))
 	if err != nil {
 		return serverErr(fmt.Errorf("Error writing to log file: %v", err))
@@ -111,6 +116,7 @@ func cliNewServer(c *cli.Context) error {
 			"port"), "8080"),
 		TLSCertFile: coalesce("", config.Get("http", "tlscert"), ""),
 		TLSKeyFile:  coalesce("", config.Get("http", "tlskey"), ""),
+		CACertFile:  coalesce("", config.Get("http", "cacert"), ""),
 		Debug:       c.GlobalBool("debug"),
 		PostgresHost: coalesce("", config.Get("database",
 			"host"), ""),
@@ -125,6 +131,26 @@ func cliNewServer(c *cli.Context) error {
 		DebugAllowInsecureCORS: c.Bool("debug-allow-insecure-cors"),
 		StorageModule: coalesce("", config.Get("storage",
 			"module"), ""),
+		PasswordPolicy: policy,
+		AuthProviders: coalesce("", config.Get("auth", "providers"),
+			"password"),
+		Admins:     coalesce("", config.Get("auth", "admins"), ""),
+		LDAPURL:    coalesce("", config.Get("ldap", "url"), ""),
+		LDAPBindDN: coalesce("", config.Get("ldap", "binddn"), ""),
+		OIDCIssuer: coalesce("", config.Get("oidc", "issuer"), ""),
+		OIDCClientID: coalesce("", config.Get("oidc", "clientid"),
+			""),
+		OIDCClientSecret: coalesce("", config.Get("oidc",
+			"clientsecret"), ""),
+		OIDCUsernameClaim: coalesce("", config.Get("oidc",
+			"usernameclaim"), "preferred_username"),
+		ArkNAAN: coalesce("", config.Get("ark", "naan"), ""),
+		VocabularyPrefixes: coalesce("", config.Get("vocabulary",
+			"prefixes"), ""),
+		VocabularyFiles: coalesce("", config.Get("vocabulary",
+			"files"), ""),
+		VocabularyClosed: coalesce("", config.Get("vocabulary",
+			"closed"), ""),
 	}
 
 	err = srv.ListenAndServe()
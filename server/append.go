@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// matchColumns returns, for each stored attribute, the index of the column
+// with the same name in columns.  The incoming columns must be the same
+// set as the stored attributes, although they may be in a different order.
+func matchColumns(attrs []string, columns []string) ([]int, error) {
+	var index = make(map[string]int)
+	for i, c := range columns {
+		index[c] = i
+	}
+	var missing, extra []string
+	var order = make([]int, len(attrs))
+	var known = make(map[string]bool)
+	for i, a := range attrs {
+		known[a] = true
+		n, ok := index[a]
+		if !ok {
+			missing = append(missing, a)
+			continue
+		}
+		order[i] = n
+	}
+	for _, c := range columns {
+		if !known[c] {
+			extra = append(extra, c)
+		}
+	}
+	if len(missing) > 0 || len(extra) > 0 {
+		var m []string
+		if len(missing) > 0 {
+			m = append(m, "missing columns: "+
+				strings.Join(missing, ", "))
+		}
+		if len(extra) > 0 {
+			m = append(m, "unknown columns: "+
+				strings.Join(extra, ", "))
+		}
+		return nil, fmt.Errorf("Header does not match data set (%s)",
+			strings.Join(m, "; "))
+	}
+	return order, nil
+}
+
+// decodeRequestData returns the file contents sent in the data of a post or
+// append request.  Data sent as base64 are raw file contents; otherwise
+// newlines are escaped as by older clients.
+func decodeRequestData(data, encoding string) ([]byte, error) {
+	switch encoding {
+	case "base64":
+		return base64.StdEncoding.DecodeString(data)
+	case "":
+		return []byte(strings.Replace(data, "\\n", "\n", -1)), nil
+	}
+	return nil, errors.New("Unknown data encoding: " + encoding)
+}
+
+// appendRows adds rows to CSV data and returns the new data and the number
+// of rows added.  The rows must have the same columns as the data.  If key
+// is not empty, rows whose value in the key column is already present are
+// skipped.
+func appendRows(data string, rows [][]string, key string) (string, int,
+	error) {
+	var r = csv.NewReader(strings.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var header []string
+	var err error
+	header, err = r.Read()
+	if err != nil {
+		return "", 0, err
+	}
+	var keyCol = -1
+	var seen map[string]bool
+	if key != "" {
+		keyCol = indexOf(header, key)
+		if keyCol == -1 {
+			return "", 0, fmt.Errorf("Key column not found: %s",
+				key)
+		}
+		seen = make(map[string]bool)
+		for {
+			var rec []string
+			rec, err = r.Read()
+			if err != nil {
+				break
+			}
+			if keyCol < len(rec) {
+				seen[rec[keyCol]] = true
+			}
+		}
+	}
+	var b bytes.Buffer
+	b.WriteString(data)
+	if data != "" && !strings.HasSuffix(data, "\n") {
+		b.WriteString("\n")
+	}
+	var w = csv.NewWriter(&b)
+	var added int
+	for _, row := range rows {
+		if keyCol != -1 {
+			if seen[row[keyCol]] {
+				continue
+			}
+			seen[row[keyCol]] = true
+		}
+		w.Write(row)
+		added++
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return "", 0, err
+	}
+	return b.String(), added, nil
+}
+
+// handleDataAppend adds rows to an existing data set.  The rows are read
+// in any format accepted by handleDataPut, and their header must contain
+// the same columns as the data set.
+func (srv *Server) handleDataAppend(w http.ResponseWriter, r *http.Request) {
+	var pathUser, pathDataName string
+	var err error
+	pathUser, pathDataName, err = parsePathBasic(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	if pathDataName == "" {
+		writeError(w, http.StatusBadRequest, "Data set name not specified")
+		return
+	}
+
+	// Authenticate user.
+	var user string
+	var ok bool
+	user, ok = srv.requireUser(w, r, pathUser)
+	if !ok {
+		return
+	}
+
+	// Read the json request.
+	var body []byte
+	body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	var req api.AppendRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var personId int64
+	personId, err = srv.storage.LookupPersonId(user)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var f *FileInfo
+	f, err = srv.storage.LookupFileInfo(personId, pathDataName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Data set '"+pathUser+"/"+
+			pathDataName+"' not found")
+		return
+	}
+	var attrs []string
+	for _, a := range f.Attributes {
+		attrs = append(attrs, a.Name)
+	}
+
+	var raw []byte
+	raw, err = decodeRequestData(req.Data, req.DataEncoding)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Rows without a header are assumed to be in the stored order.
+	var columns []string
+	if req.NoHeader {
+		columns = attrs
+	}
+	var data string
+	var conv *conversion
+	data, conv, err = convertData(raw, req.Type, req.NoHeader, columns)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity,
+			"Unable to read data: "+err.Error())
+		return
+	}
+	var order []int
+	order, err = matchColumns(attrs, conv.Columns)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	var records [][]string
+	records, err = readCSV(data)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var rows = make([][]string, 0, len(records))
+	for _, rec := range records[1:] {
+		var row = make([]string, len(order))
+		for i, n := range order {
+			row[i] = rec[n]
+		}
+		rows = append(rows, row)
+	}
+
+	var fileId int64
+	fileId, err = srv.storage.LookupFileId(personId, pathDataName)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var added int
+	var ark string
+	added, ark, err = srv.storage.StoreAppend(fileId, rows, req.Key,
+		srv.mintArk)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity,
+			"Unable to append to data set '"+pathUser+"/"+
+				pathDataName+"': "+err.Error())
+		return
+	}
+
+	var resp = api.AppendResponse{
+		Url:     joinURLPath(glintbaseurl, pathUser+"/"+pathDataName),
+		Rows:    added,
+		Skipped: len(rows) - added,
+		Ark:     ark,
+	}
+	var respbody []byte
+	respbody, err = json.Marshal(resp)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respbody)
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestDecodeRequestData(t *testing.T) {
+	for _, c := range []struct {
+		data, encoding, want string
+		ok                   bool
+	}{
+		{`a,b\n1,2\n`, "", "a,b\n1,2\n", true},
+		{"YSxiCjEsMgo=", "base64", "a,b\n1,2\n", true},
+		{"a\\\\n", "base64", "", false},
+		{"a", "gzip", "", false},
+	} {
+		raw, err := decodeRequestData(c.data, c.encoding)
+		if (err == nil) != c.ok {
+			t.Errorf("%q (%s): error %v", c.data, c.encoding, err)
+			continue
+		}
+		if c.ok && string(raw) != c.want {
+			t.Errorf("%q (%s): got %q, want %q", c.data, c.encoding,
+				raw, c.want)
+		}
+	}
+}
+
+func TestAppendRows(t *testing.T) {
+	data := "id,note\n1,\"a, b\"\n2,c"
+	got, added, err := appendRows(data, [][]string{
+		{"2", "dup"},
+		{"3", "line\nbreak"},
+		{"3", "dup"},
+	}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id,note\n1,\"a, b\"\n2,c\n3,\"line\nbreak\"\n"
+	if got != want || added != 1 {
+		t.Errorf("got %q (%d added), want %q", got, added, want)
+	}
+	if _, _, err = appendRows(data, nil, "missing"); err == nil {
+		t.Errorf("missing key: no error")
+	}
+	got, added, err = appendRows(data, [][]string{{"2", "again"}}, "")
+	if err != nil || added != 1 || countRows(got) != 3 {
+		t.Errorf("no key: %q (%d added), error %v", got, added, err)
+	}
+}
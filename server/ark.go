@@ -0,0 +1,265 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// DefaultArkNAAN is the Name Assigning Authority Number used in ARKs if
+// none is configured.  It is reserved for testing, and identifiers minted
+// with it are not expected to persist.
+const DefaultArkNAAN = "99999"
+
+// arkShoulder begins the name of every ARK minted by the server.
+const arkShoulder = "glint-"
+
+// arkBladeLength is the number of random characters in an ARK name, which
+// is followed by a check character.
+const arkBladeLength = 8
+
+// betanumeric contains the characters used in minted names: digits and
+// consonants other than l, as in the Noid minter.
+const betanumeric = "0123456789bcdfghjkmnpqrstvwxz"
+
+// Revision describes a revision of a data set.
+type Revision struct {
+	Ark  string
+	User string
+
+	// Path is the current path of the data set, or its path when it was
+	// deleted.
+	Path    string
+	Hash    string
+	Created time.Time
+	Deleted bool
+
+	// Latest is the ARK of the latest revision of the data set, which is
+	// Ark if this is the latest revision.
+	Latest string
+
+	// Metadata are the current descriptive metadata of the data set.
+	Metadata *api.DatasetMetadata
+}
+
+// noidCheckChar returns the Noid check character of an identifier, which
+// detects a single changed character or two transposed characters.
+func noidCheckChar(id string) byte {
+	var sum int
+	for x := 0; x < len(id); x++ {
+		// Characters outside betanumeric count as 0.
+		if n := strings.IndexByte(betanumeric, id[x]); n > 0 {
+			sum += (x + 1) * n
+		}
+	}
+	return betanumeric[sum%len(betanumeric)]
+}
+
+// mintArk returns a new random ARK in the server's NAAN.
+func (srv *Server) mintArk() (string, error) {
+	var naan string = srv.ArkNAAN
+	if naan == "" {
+		naan = DefaultArkNAAN
+	}
+	var blade = make([]byte, arkBladeLength)
+	var max = big.NewInt(int64(len(betanumeric)))
+	for x := range blade {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		blade[x] = betanumeric[n.Int64()]
+	}
+	var id string = naan + "/" + arkShoulder + string(blade)
+	return "ark:/" + id + string(noidCheckChar(id)), nil
+}
+
+// addMissingRevisions mints ARKs for data sets that have none, such as
+// those posted before ARKs were minted.
+func (srv *Server) addMissingRevisions() error {
+	var ids []int64
+	var err error
+	ids, err = srv.storage.LookupFilesWithoutRevision()
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		srv.log("Minting ARKs for %d data sets", len(ids))
+	}
+	for _, id := range ids {
+		if _, err = srv.storage.AddRevision(id, srv.mintArk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// arkURL returns the URL at which the server resolves an ARK.
+func arkURL(ark string) string {
+	return joinURLPath(glintbaseurl, ark)
+}
+
+// parseArk returns the ARK in a request path, in the form "ark:/NAAN/name".
+// The slash after "ark:" may be omitted, as newer ARKs do.
+func parseArk(path string) (string, bool) {
+	var s string = strings.TrimPrefix(path, "/")
+	if !strings.HasPrefix(s, "ark:") {
+		return "", false
+	}
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "ark:"), "/")
+	var sp []string = strings.Split(strings.TrimSuffix(s, "/"), "/")
+	if len(sp) != 2 || sp[0] == "" || sp[1] == "" {
+		return "", false
+	}
+	return "ark:/" + sp[0] + "/" + sp[1], true
+}
+
+// arkInfo returns the metadata of a revision.  The brief form contains the
+// ERC kernel elements (who, what, when, and where); the full form adds the
+// status, location, and persistence statement.
+func arkInfo(rev *Revision, full bool) *api.ArkInfo {
+	var info = &api.ArkInfo{
+		Ark:  rev.Ark,
+		Who:  rev.User,
+		What: rev.Path,
+		When: rev.Created.UTC().Format(time.RFC3339),
+	}
+	if md := rev.Metadata; md != nil {
+		var who []string
+		for _, c := range md.Creators {
+			who = append(who, c.Name)
+		}
+		if len(who) > 0 {
+			info.Who = strings.Join(who, "; ")
+		}
+		if md.Title != "" {
+			info.What = md.Title
+		}
+	}
+	info.Where = arkURL(rev.Ark)
+	if !full {
+		return info
+	}
+	if !rev.Deleted {
+		info.Url = joinURLPath(glintbaseurl, rev.User+"/"+rev.Path)
+	}
+	if rev.Hash != "" {
+		info.Hash = "sha256:" + rev.Hash
+	}
+	switch {
+	case rev.Deleted:
+		info.Status = "deleted"
+		info.Persistence = "The data set that this identifier refers " +
+			"to has been deleted.  The identifier will not be " +
+			"assigned to anything else."
+	case rev.Latest != rev.Ark:
+		info.Status = "superseded"
+		info.Latest = rev.Latest
+		info.Persistence = "This identifier refers to an earlier " +
+			"revision of a data set, which has since been " +
+			"changed.  It will resolve to the data set's current " +
+			"location for as long as the data set is published " +
+			"on this server, including if the data set is " +
+			"renamed.  The content of earlier revisions is not " +
+			"kept; the hash identifies the content of this " +
+			"revision."
+	default:
+		info.Status = "current"
+		info.Persistence = "This identifier refers to the current " +
+			"revision of a data set.  It will resolve to the " +
+			"data set for as long as the data set is published " +
+			"on this server, including if the data set is " +
+			"renamed.  Each change to the data set is given a " +
+			"new identifier."
+	}
+	if rev.Metadata != nil {
+		info.License = rev.Metadata.License
+	}
+	return info
+}
+
+// writeERC writes ARK metadata as an Electronic Resource Citation record.
+func writeERC(w http.ResponseWriter, info *api.ArkInfo) {
+	var oneLine = strings.NewReplacer("\r", " ", "\n", " ").Replace
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "erc:\n")
+	fmt.Fprintf(w, "who: %s\n", oneLine(info.Who))
+	fmt.Fprintf(w, "what: %s\n", oneLine(info.What))
+	fmt.Fprintf(w, "when: %s\n", info.When)
+	fmt.Fprintf(w, "where: %s\n", info.Where)
+	if info.Status == "" {
+		return
+	}
+	fmt.Fprintf(w, "status: %s\n", info.Status)
+	if info.Latest != "" {
+		fmt.Fprintf(w, "latest: %s\n", arkURL(info.Latest))
+	}
+	if info.Url != "" {
+		fmt.Fprintf(w, "url: %s\n", info.Url)
+	}
+	if info.Hash != "" {
+		fmt.Fprintf(w, "hash: %s\n", info.Hash)
+	}
+	if info.License != "" {
+		fmt.Fprintf(w, "license: %s\n", info.License)
+	}
+	fmt.Fprintf(w, "\nerc-support:\n")
+	fmt.Fprintf(w, "who: %s\n", strings.TrimSuffix(glintbaseurl, "/"))
+	fmt.Fprintf(w, "what: %s\n", info.Persistence)
+	fmt.Fprintf(w, "where: %s\n", strings.TrimSuffix(glintbaseurl, "/"))
+}
+
+// handleArk resolves an ARK.  Without an inflection the client is
+// redirected to the data set.  The "?" inflection returns brief metadata,
+// and "??" (or "?info") returns the full metadata and persistence
+// statement, as text or as JSON if the client accepts JSON.
+func (srv *Server) handleArk(w http.ResponseWriter, r *http.Request) {
+	srv.logRequest(r, 0)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeMethodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+	var ark, ok = parseArk(r.URL.Path)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Invalid ARK: "+r.URL.Path)
+		return
+	}
+	var rev, err = srv.storage.LookupRevision(ark)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "ARK not found: "+ark)
+		return
+	}
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var full bool
+	switch {
+	case r.URL.RawQuery == "" && r.URL.ForceQuery:
+	case r.URL.RawQuery == "?" || r.URL.RawQuery == "info":
+		full = true
+	default:
+		if rev.Deleted {
+			writeError(w, http.StatusGone, "The data set identified "+
+				"by "+ark+" has been deleted")
+			return
+		}
+		http.Redirect(w, r, joinURLPath(glintbaseurl,
+			rev.User+"/"+rev.Path), http.StatusFound)
+		return
+	}
+	var info *api.ArkInfo = arkInfo(rev, full)
+	if acceptsJSON(r) {
+		writeJSON(w, info)
+		return
+	}
+	writeERC(w, info)
+}
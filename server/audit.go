@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// Audit actions.
+const (
+	AuditPost          = "post"
+	AuditOverwrite     = "overwrite"
+	AuditAppend        = "append"
+	AuditDelete        = "delete"
+	AuditMetadata      = "metadata"
+	AuditPassword      = "password"
+	AuditPasswordReset = "password_reset"
+	AuditLogin         = "login"
+	AuditLogout        = "logout"
+	AuditLoginFailed   = "login_failed"
+	AuditAddUser       = "adduser"
+	AuditUnlock        = "unlock"
+	AuditDisable       = "disable"
+	AuditEnable        = "enable"
+	AuditBind          = "bind"
+)
+
+// Audit outcomes.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent records an action performed on the server, or an attempt to
+// perform one.
+type AuditEvent struct {
+	Id      int64
+	Time    time.Time
+	Actor   string
+	IP      string
+	Action  string
+	Target  string
+	Outcome string
+	Detail  string
+}
+
+// AuditFilter selects audit events.  Empty fields match any value, and a
+// Limit of 0 returns all matching events.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// addAuditEvent stores an audit event, logging any error rather than
+// failing the request that caused it.
+func (srv *Server) addAuditEvent(e *AuditEvent) {
+	if err := srv.storage.AddAuditEvent(e); err != nil {
+		srv.log("Error writing audit event: %v", err)
+	}
+}
+
+// auditWriter wraps a ResponseWriter to capture the status code of the
+// response and the user who was authenticated while handling the request.
+// A handler may also replace the action once it knows what the request did.
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	actor  string
+	action string
+}
+
+func (aw *auditWriter) WriteHeader(code int) {
+	if aw.status == 0 {
+		aw.status = code
+	}
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+func (aw *auditWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	return aw.ResponseWriter.Write(b)
+}
+
+// setAuditActor records the authenticated user for the audit event of the
+// current request, if it is being audited.
+func setAuditActor(w http.ResponseWriter, user string) {
+	if aw, ok := w.(*auditWriter); ok {
+		aw.actor = user
+	}
+}
+
+// setAuditAction replaces the action recorded in the audit event of the
+// current request, if it is being audited.
+func setAuditAction(w http.ResponseWriter, action string) {
+	if aw, ok := w.(*auditWriter); ok {
+		aw.action = action
+	}
+}
+
+// audit calls the handler h and records an audit event for the request with
+// the outcome determined by the response status.  Requests rejected for
+// invalid credentials are not recorded here, because handleBasicAuth
+// records them as failed logins.  The actor is the user who was
+// authenticated, and is empty if the request was refused before
+// authentication succeeded, e.g. because logins were throttled; the
+// username that the client sent is not trusted.
+func (srv *Server) audit(action string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var aw = &auditWriter{ResponseWriter: w, action: action}
+		h(aw, r)
+		if aw.status == http.StatusUnauthorized ||
+			aw.status == http.StatusMethodNotAllowed {
+			return
+		}
+		var outcome = AuditSuccess
+		if aw.status >= 400 {
+			outcome = AuditFailure
+		}
+		srv.addAuditEvent(&AuditEvent{
+			Actor:   aw.actor,
+			IP:      remoteIP(r),
+			Action:  aw.action,
+			Target:  r.URL.Path,
+			Outcome: outcome,
+			Detail: strconv.Itoa(aw.status) + " " +
+				http.StatusText(aw.status),
+		})
+	}
+}
+
+// isAdmin returns true if user is listed in srv.Admins.
+func (srv *Server) isAdmin(user string) bool {
+	for _, a := range strings.Split(srv.Admins, ",") {
+		if strings.TrimSpace(a) == user && user != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAudit returns audit events selected by the query parameters actor,
+// action, target, since, until (RFC 3339 times), and limit.  It is available
+// only to administrators.
+func (srv *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	srv.logRequest(r, 0)
+	if r.Method != "GET" {
+		writeMethodNotAllowed(w, r, "GET")
+		return
+	}
+	var user, ok = srv.handleBasicAuth(w, r)
+	if !ok {
+		return
+	}
+	if !srv.isAdmin(user) {
+		writeError(w, http.StatusForbidden,
+			"User '"+user+"' is not an administrator")
+		return
+	}
+	var q = r.URL.Query()
+	var f = AuditFilter{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+	}
+	var err error
+	if s := q.Get("since"); s != "" {
+		if f.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			handleError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if s := q.Get("until"); s != "" {
+		if f.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			handleError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if f.Limit, err = strconv.Atoi(s); err != nil || f.Limit < 0 {
+			writeError(w, http.StatusBadRequest,
+				"Invalid limit: "+s)
+			return
+		}
+	}
+	var events []AuditEvent
+	events, err = srv.storage.LookupAuditEvents(&f)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var resp = make([]api.AuditEvent, 0, len(events))
+	for _, e := range events {
+		resp = append(resp, api.AuditEvent{
+			Id:      e.Id,
+			Time:    e.Time,
+			Actor:   e.Actor,
+			IP:      e.IP,
+			Action:  e.Action,
+			Target:  e.Target,
+			Outcome: e.Outcome,
+			Detail:  e.Detail,
+		})
+	}
+	var respbody []byte
+	respbody, err = json.Marshal(resp)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respbody)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// auditStorage is a Storage that keeps audit events in memory.
+type auditStorage struct {
+	Storage
+	events []*AuditEvent
+}
+
+func (s *auditStorage) AddAuditEvent(e *AuditEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		h       http.HandlerFunc
+		actor   string
+		action  string
+		outcome string
+		logged  bool
+	}{
+		{"authenticated", func(w http.ResponseWriter, r *http.Request) {
+			setAuditActor(w, "alice")
+			w.WriteHeader(http.StatusCreated)
+		}, "alice", AuditPost, AuditSuccess, true},
+		{"overwrite", func(w http.ResponseWriter, r *http.Request) {
+			setAuditActor(w, "alice")
+			setAuditAction(w, AuditOverwrite)
+			w.WriteHeader(http.StatusOK)
+		}, "alice", AuditOverwrite, AuditSuccess, true},
+		{"throttled", func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusTooManyRequests, "Try again")
+		}, "", AuditPost, AuditFailure, true},
+		{"unauthorized", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}, "", "", "", false},
+	} {
+		st := &auditStorage{}
+		srv := &Server{storage: st}
+		r := httptest.NewRequest("PUT", "/mallory/data", nil)
+		r.SetBasicAuth("mallory", "guess")
+		srv.audit(AuditPost, c.h)(httptest.NewRecorder(), r)
+		if !c.logged {
+			if len(st.events) != 0 {
+				t.Errorf("%s: logged %+v", c.name, *st.events[0])
+			}
+			continue
+		}
+		if len(st.events) != 1 {
+			t.Fatalf("%s: %d events", c.name, len(st.events))
+		}
+		e := st.events[0]
+		if e.Actor != c.actor || e.Action != c.action ||
+			e.Outcome != c.outcome || e.Target != "/mallory/data" {
+			t.Errorf("%s: event %+v", c.name, *e)
+		}
+	}
+}
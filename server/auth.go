@@ -0,0 +1,225 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Identity describes a user who has been authenticated by an
+// Authenticator.  Subject is the identifier that an external provider
+// guarantees to be unique and stable for the user, such as an LDAP
+// distinguished name or an OpenID Connect "sub" claim; it is empty for local
+// users.  Fullname and Email may be empty if the provider does not supply
+// them.
+type Identity struct {
+	Username string
+	Subject  string
+	Fullname string
+	Email    string
+}
+
+// Authenticator verifies a username and password.  Authenticate returns ok ==
+// false if the credentials were rejected; a non-nil error is reserved for
+// failures of the provider itself, such as an unreachable directory server.
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (id Identity, ok bool, err error)
+}
+
+// TokenAuthenticator is implemented by an Authenticator that can also verify
+// bearer tokens.
+type TokenAuthenticator interface {
+	AuthenticateToken(token string) (id Identity, ok bool, err error)
+}
+
+// passwordAuthenticator compares passwords with the bcrypt hashes stored in
+// the person table.
+type passwordAuthenticator struct {
+	storage Storage
+}
+
+func (a *passwordAuthenticator) Name() string {
+	return "password"
+}
+
+func (a *passwordAuthenticator) Authenticate(username, password string) (
+	Identity, bool, error) {
+
+	var match, err = a.storage.Authenticate(username, password)
+	if err == sql.ErrNoRows {
+		return Identity{}, false, nil
+	}
+	if err != nil {
+		return Identity{}, false, err
+	}
+	return Identity{Username: username}, match, nil
+}
+
+// setupAuth creates the authentication providers listed in
+// srv.AuthProviders, in the order they will be tried.
+func (srv *Server) setupAuth() error {
+	var providers = srv.AuthProviders
+	if strings.TrimSpace(providers) == "" {
+		providers = "password"
+	}
+	// Session tokens issued by the server are always accepted.
+	srv.authenticators = []Authenticator{
+		&sessionAuthenticator{storage: srv.storage},
+	}
+	for _, p := range strings.Split(providers, ",") {
+		var a Authenticator
+		switch strings.TrimSpace(p) {
+		case "password":
+			a = &passwordAuthenticator{storage: srv.storage}
+		case "ldap":
+			if srv.LDAPURL == "" || srv.LDAPBindDN == "" {
+				return fmt.Errorf("LDAP URL and bind DN must be " +
+					"specified")
+			}
+			a = &ldapAuthenticator{
+				url:    srv.LDAPURL,
+				bindDN: srv.LDAPBindDN,
+			}
+		case "oidc":
+			if srv.OIDCIssuer == "" || srv.OIDCClientID == "" {
+				return fmt.Errorf("OpenID Connect issuer and " +
+					"client ID must be specified")
+			}
+			a = &oidcAuthenticator{
+				issuer:        srv.OIDCIssuer,
+				clientID:      srv.OIDCClientID,
+				clientSecret:  srv.OIDCClientSecret,
+				usernameClaim: srv.OIDCUsernameClaim,
+			}
+		case "":
+			continue
+		default:
+			return fmt.Errorf("Unknown authentication provider: %s",
+				p)
+		}
+		srv.authenticators = append(srv.authenticators, a)
+	}
+	return nil
+}
+
+// isLocal reports whether an authenticator verifies users against the
+// person table itself rather than an external provider.
+func isLocal(a Authenticator) bool {
+	switch a.(type) {
+	case *passwordAuthenticator, *sessionAuthenticator:
+		return true
+	}
+	return false
+}
+
+// authenticate tries each configured authentication provider in turn until
+// one accepts the username and password, and returns the username of the
+// account.  An external provider may name the account differently from the
+// username that was given.  A user authenticated by an external provider is
+// added to the person table on first login.
+func (srv *Server) authenticate(username, password string) (string, bool,
+	error) {
+	var lastErr error
+	for _, a := range srv.authenticators {
+		var id, ok, err = a.Authenticate(username, password)
+		if err != nil {
+			srv.log("Authentication provider %s: %v", a.Name(), err)
+			lastErr = err
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if isLocal(a) {
+			return username, true, nil
+		}
+		ok, err = srv.provisionUser(a.Name(), id)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return id.Username, true, nil
+		}
+	}
+	return "", false, lastErr
+}
+
+// authenticateToken tries each configured provider that supports bearer
+// tokens, returning the username of the token's owner.  Session tokens
+// issued by /login are tried only if sessions is true.
+func (srv *Server) authenticateToken(token string, sessions bool) (string,
+	bool, error) {
+	var lastErr error
+	for _, a := range srv.authenticators {
+		var ta, ok = a.(TokenAuthenticator)
+		if !ok {
+			continue
+		}
+		if _, ok = a.(*sessionAuthenticator); ok && !sessions {
+			continue
+		}
+		var id Identity
+		var err error
+		id, ok, err = ta.AuthenticateToken(token)
+		if err != nil {
+			srv.log("Authentication provider %s: %v", a.Name(), err)
+			lastErr = err
+			continue
+		}
+		if !ok || id.Username == "" {
+			continue
+		}
+		if isLocal(a) {
+			return id.Username, true, nil
+		}
+		ok, err = srv.provisionUser(a.Name(), id)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return id.Username, true, nil
+		}
+	}
+	return "", false, lastErr
+}
+
+// provisionUser adds an externally authenticated user to the person table if
+// the user does not already exist, recording the provider and subject that
+// own the account.  It returns false if the username belongs to a local
+// account or to a different external identity, which the user may not log
+// in to.  An existing account with no provider is bound to an identity only
+// by an administrator, with glintserver bind.  Reserved usernames are
+// never provisioned.
+func (srv *Server) provisionUser(provider string, id Identity) (bool,
+	error) {
+	if id.Username == "" || id.Subject == "" {
+		srv.log("Authentication provider %s: identity has no "+
+			"username or subject", provider)
+		return false, nil
+	}
+	if ReservedUsername(id.Username) {
+		srv.log("Refusing login by %s %s: username '%s' is reserved",
+			provider, id.Subject, id.Username)
+		return false, nil
+	}
+	var p, subject, err = srv.storage.LookupPersonProvider(id.Username)
+	switch {
+	case err == sql.ErrNoRows:
+		srv.log("Provisioning user '%s' (%s %s)", id.Username, provider,
+			id.Subject)
+		err = srv.storage.AddExternalPerson(id.Username, id.Fullname,
+			id.Email, provider, id.Subject)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	case err != nil:
+		return false, err
+	case p == provider && subject == id.Subject:
+		return true, nil
+	}
+	srv.log("Refusing login by %s %s: account '%s' belongs to another "+
+		"identity", provider, id.Subject, id.Username)
+	return false, nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// personStorage is a Storage holding only the person table, for testing
+// authentication.
+type personStorage struct {
+	Storage
+	people map[string]*testPerson
+}
+
+type testPerson struct {
+	provider, subject, password string
+}
+
+func (s *personStorage) Authenticate(username, password string) (bool,
+	error) {
+	p, ok := s.people[username]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	return p.password != "" && p.password == password, nil
+}
+
+func (s *personStorage) LookupPersonProvider(username string) (string,
+	string, error) {
+	p, ok := s.people[username]
+	if !ok {
+		return "", "", sql.ErrNoRows
+	}
+	return p.provider, p.subject, nil
+}
+
+func (s *personStorage) AddExternalPerson(username, fullname, email,
+	provider, subject string) error {
+	s.people[username] = &testPerson{provider: provider, subject: subject}
+	return nil
+}
+
+// stubAuthenticator accepts any password and returns a fixed identity.
+type stubAuthenticator struct {
+	name string
+	id   Identity
+}
+
+func (a *stubAuthenticator) Name() string {
+	return a.name
+}
+
+func (a *stubAuthenticator) Authenticate(username, password string) (
+	Identity, bool, error) {
+	return a.id, true, nil
+}
+
+func TestProvisionUser(t *testing.T) {
+	st := &personStorage{people: map[string]*testPerson{
+		"root":   {password: "local"},
+		"carol":  {provider: "ldap", subject: "uid=carol"},
+		"legacy": {},
+	}}
+	srv := &Server{storage: st}
+	for _, c := range []struct {
+		provider string
+		id       Identity
+		ok       bool
+	}{
+		// A new user is provisioned and bound to the identity.
+		{"oidc", Identity{Username: "dave", Subject: "s-dave"}, true},
+		{"oidc", Identity{Username: "dave", Subject: "s-dave"}, true},
+		{"oidc", Identity{Username: "dave", Subject: "s-other"}, false},
+		{"ldap", Identity{Username: "dave", Subject: "s-dave"}, false},
+		// A local account is never mapped to an external identity.
+		{"oidc", Identity{Username: "root", Subject: "s-root"}, false},
+		{"ldap", Identity{Username: "root", Subject: "uid=root"}, false},
+		// Nor is another provider's account.
+		{"oidc", Identity{Username: "carol", Subject: "uid=carol"}, false},
+		{"ldap", Identity{Username: "carol", Subject: "uid=carol"}, true},
+		// An account with no provider is never claimed by a login;
+		// an administrator must bind it.
+		{"ldap", Identity{Username: "legacy", Subject: "uid=legacy"}, false},
+		{"oidc", Identity{Username: "legacy", Subject: "s-legacy"}, false},
+		// Identities without a subject are refused.
+		{"oidc", Identity{Username: "erin"}, false},
+		// Reserved usernames would be hidden by the server's own
+		// paths.
+		{"oidc", Identity{Username: "logout", Subject: "s-logout"}, false},
+	} {
+		ok, err := srv.provisionUser(c.provider, c.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.ok {
+			t.Errorf("%s %+v: ok = %v", c.provider, c.id, ok)
+		}
+	}
+	if p := st.people["dave"]; p.provider != "oidc" || p.subject != "s-dave" {
+		t.Errorf("dave provisioned as %+v", p)
+	}
+	if _, ok := st.people["erin"]; ok {
+		t.Errorf("erin provisioned without a subject")
+	}
+	if _, ok := st.people["logout"]; ok {
+		t.Errorf("reserved username provisioned")
+	}
+}
+
+func TestAuthenticateExternalName(t *testing.T) {
+	st := &personStorage{people: map[string]*testPerson{
+		"root": {password: "local"},
+	}}
+	srv := &Server{storage: st}
+	srv.authenticators = []Authenticator{
+		&stubAuthenticator{name: "oidc", id: Identity{
+			Username: "robert", Subject: "s-robert"}},
+	}
+	user, ok, err := srv.authenticate("bob", "secret")
+	if err != nil || !ok || user != "robert" {
+		t.Errorf("user = %q, ok = %v, err = %v", user, ok, err)
+	}
+	srv.authenticators = []Authenticator{
+		&stubAuthenticator{name: "oidc", id: Identity{
+			Username: "root", Subject: "s-mallory"}},
+		&passwordAuthenticator{storage: st},
+	}
+	if _, ok, _ = srv.authenticate("root", "anything"); ok {
+		t.Errorf("external identity logged in to local account")
+	}
+	if user, ok, _ = srv.authenticate("root", "local"); !ok ||
+		user != "root" {
+		t.Errorf("local login: user = %q, ok = %v", user, ok)
+	}
+}
@@ -0,0 +1,583 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// RDF namespaces used in the catalog.
+const (
+	nsDCAT = "http://www.w3.org/ns/dcat#"
+	nsDCT  = "http://purl.org/dc/terms/"
+	nsFOAF = "http://xmlns.com/foaf/0.1/"
+	nsXSD  = "http://www.w3.org/2001/XMLSchema#"
+	nsGSP  = "http://www.opengis.net/ont/geosparql#"
+	nsIANA = "https://www.iana.org/assignments/media-types/"
+	nsSPDX = "https://spdx.org/licenses/"
+)
+
+// distribution is a form in which a data set can be downloaded.
+type distribution struct {
+	Title     string
+	Format    string
+	MediaType string
+	Url       string
+}
+
+// datasetDistributions returns the distributions of the data set at url.
+func datasetDistributions(url string) []distribution {
+	return []distribution{
+		{"CSV", "CSV", "text/csv", url},
+		{"TSV", "TSV", "text/tab-separated-values", url + "?as(tsv)"},
+		{"JSON", "JSON", "application/json", url + "?as(json)"},
+	}
+}
+
+// datasetDescription returns the description of a data set for catalogs,
+// which is its abstract or, if it has none, a sentence naming it.
+func datasetDescription(f *FileInfo) string {
+	if f.Metadata != nil && f.Metadata.Abstract != "" {
+		return f.Metadata.Abstract
+	}
+	return fmt.Sprintf("Data set %s published by %s on %s, with %d rows "+
+		"and %d columns.", f.Path, f.User,
+		strings.TrimSuffix(glintbaseurl, "/"), f.Rows, len(f.Attributes))
+}
+
+// datasetTitle returns the title of a data set, or its path if it has no
+// title.
+func datasetTitle(f *FileInfo) string {
+	if f.Metadata != nil && f.Metadata.Title != "" {
+		return f.Metadata.Title
+	}
+	return f.Path
+}
+
+// wktBox returns a bounding box [west, south, east, north] as a WKT
+// polygon.
+func wktBox(b []float64) string {
+	return fmt.Sprintf("POLYGON((%g %g,%g %g,%g %g,%g %g,%g %g))",
+		b[0], b[1], b[2], b[1], b[2], b[3], b[0], b[3], b[0], b[1])
+}
+
+// coverageDate returns the XSD datatype of a temporal coverage value.
+func coverageDate(s string) string {
+	if len(s) == len("2006-01-02") {
+		return nsXSD + "date"
+	}
+	return nsXSD + "dateTime"
+}
+
+// dcatDataset returns a data set as a DCAT dataset in JSON-LD.
+func dcatDataset(f *FileInfo) map[string]interface{} {
+	var url = joinURLPath(glintbaseurl, f.User+"/"+f.Path)
+	var d = map[string]interface{}{
+		"@id":             url,
+		"@type":           "dcat:Dataset",
+		"dct:title":       datasetTitle(f),
+		"dct:description": datasetDescription(f),
+		"dct:publisher": map[string]interface{}{
+			"@id":       joinURLPath(glintbaseurl, f.User),
+			"@type":     "foaf:Agent",
+			"foaf:name": f.User,
+		},
+		"dct:modified": map[string]interface{}{
+			"@value": f.Modified.UTC().Format(time.RFC3339),
+			"@type":  "xsd:dateTime",
+		},
+		"dcat:landingPage": map[string]interface{}{"@id": url},
+	}
+	if f.Ark != "" {
+		d["dct:identifier"] = f.Ark
+	}
+	var dists []interface{}
+	for _, dist := range datasetDistributions(url) {
+		dists = append(dists, map[string]interface{}{
+			"@type":            "dcat:Distribution",
+			"dct:title":        dist.Title,
+			"dct:format":       dist.Format,
+			"dcat:mediaType":   map[string]interface{}{"@id": nsIANA + dist.MediaType},
+			"dcat:downloadURL": map[string]interface{}{"@id": dist.Url},
+			"dcat:accessURL":   map[string]interface{}{"@id": dist.Url},
+		})
+	}
+	d["dcat:distribution"] = dists
+	var md = f.Metadata
+	if md == nil {
+		return d
+	}
+	if len(md.Keywords) > 0 {
+		d["dcat:keyword"] = md.Keywords
+	}
+	if md.License != "" {
+		d["dct:license"] = map[string]interface{}{
+			"@id": nsSPDX + strings.TrimSuffix(md.License, "+"),
+		}
+	}
+	if len(md.Creators) > 0 {
+		var creators []interface{}
+		for _, c := range md.Creators {
+			var a = map[string]interface{}{
+				"@type":     "foaf:Agent",
+				"foaf:name": c.Name,
+			}
+			if isURI(c.Id) {
+				a["@id"] = c.Id
+			} else if c.Id != "" {
+				a["dct:identifier"] = c.Id
+			}
+			creators = append(creators, a)
+		}
+		d["dct:creator"] = creators
+	}
+	if t := md.Temporal; t != nil && (t.Start != "" || t.End != "") {
+		var p = map[string]interface{}{"@type": "dct:PeriodOfTime"}
+		if t.Start != "" {
+			p["dcat:startDate"] = map[string]interface{}{
+				"@value": t.Start, "@type": coverageDate(t.Start),
+			}
+		}
+		if t.End != "" {
+			p["dcat:endDate"] = map[string]interface{}{
+				"@value": t.End, "@type": coverageDate(t.End),
+			}
+		}
+		d["dct:temporal"] = p
+	}
+	if s := md.Spatial; s != nil && (s.Place != "" || len(s.Bbox) == 4) {
+		var l = map[string]interface{}{"@type": "dct:Location"}
+		if s.Place != "" {
+			l["skos:prefLabel"] = s.Place
+		}
+		if len(s.Bbox) == 4 {
+			l["dcat:bbox"] = map[string]interface{}{
+				"@value": wktBox(s.Bbox),
+				"@type":  nsGSP + "wktLiteral",
+			}
+		}
+		d["dct:spatial"] = l
+	}
+	return d
+}
+
+// catalogContext is the JSON-LD context of the catalog.
+var catalogContext = map[string]interface{}{
+	"dcat":  nsDCAT,
+	"dct":   nsDCT,
+	"foaf":  nsFOAF,
+	"hydra": "http://www.w3.org/ns/hydra/core#",
+	"skos":  "http://www.w3.org/2004/02/skos/core#",
+	"xsd":   nsXSD,
+}
+
+// dcatCatalog returns a DCAT catalog of files in JSON-LD.
+func dcatCatalog(files []FileInfo) map[string]interface{} {
+	var datasets = []interface{}{}
+	for x := range files {
+		datasets = append(datasets, dcatDataset(&files[x]))
+	}
+	var base = strings.TrimSuffix(glintbaseurl, "/")
+	return map[string]interface{}{
+		"@context":        catalogContext,
+		"@id":             joinURLPath(glintbaseurl, "catalog"),
+		"@type":           "dcat:Catalog",
+		"dct:title":       "Glint data sets at " + base,
+		"dct:description": "Data sets published on the Glint server at " + base + ".",
+		"foaf:homepage":   map[string]interface{}{"@id": base + "/"},
+		"dcat:dataset":    datasets,
+	}
+}
+
+// turtleString returns s as a Turtle string literal.
+func turtleString(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"",
+		"\n", "\\n", "\r", "\\r", "\t", "\\t").Replace(s) + "\""
+}
+
+// turtleIRI returns an IRI reference, with characters that are not allowed
+// in it percent-encoded.
+func turtleIRI(iri string) string {
+	return "<" + strings.NewReplacer(" ", "%20", "<", "%3C", ">", "%3E",
+		"\"", "%22", "{", "%7B", "}", "%7D", "|", "%7C", "\\", "%5C",
+		"^", "%5E", "`", "%60").Replace(iri) + ">"
+}
+
+// turtleWriter writes JSON-LD nodes as Turtle, using the prefixes of
+// catalogContext.  Nested nodes without an @id are written as blank nodes;
+// those with an @id are referred to by it and written after the node that
+// contains them.
+type turtleWriter struct {
+	w       io.Writer
+	pending []map[string]interface{}
+	written map[string]bool
+}
+
+// subject writes a node with an @id as a Turtle subject, followed by the
+// nodes that it refers to.
+func (t *turtleWriter) subject(node map[string]interface{}) {
+	var id, _ = node["@id"].(string)
+	if t.written[id] {
+		return
+	}
+	t.written[id] = true
+	fmt.Fprintf(t.w, "\n%s\n    %s .\n", turtleIRI(id), t.predicates(node, ""))
+	for len(t.pending) > 0 {
+		var n = t.pending[0]
+		t.pending = t.pending[1:]
+		t.subject(n)
+	}
+}
+
+// predicates returns the predicates and objects of a node.
+func (t *turtleWriter) predicates(node map[string]interface{},
+	indent string) string {
+	var keys []string
+	for k := range node {
+		if !strings.HasPrefix(k, "@") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var lines []string
+	if typ, ok := node["@type"].(string); ok {
+		lines = append(lines, "a "+typ)
+	}
+	for _, k := range keys {
+		var values []interface{}
+		switch v := node[k].(type) {
+		case []interface{}:
+			values = v
+		case []string:
+			for _, s := range v {
+				values = append(values, s)
+			}
+		default:
+			values = []interface{}{v}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		var objects []string
+		for _, v := range values {
+			objects = append(objects, t.object(v, indent+"    "))
+		}
+		lines = append(lines, k+" "+strings.Join(objects, ", "))
+	}
+	return strings.Join(lines, " ;\n"+indent+"    ")
+}
+
+// object returns the Turtle form of a JSON-LD value.
+func (t *turtleWriter) object(v interface{}, indent string) string {
+	switch v := v.(type) {
+	case string:
+		return turtleString(v)
+	case map[string]interface{}:
+		if val, ok := v["@value"].(string); ok {
+			var typ, _ = v["@type"].(string)
+			if strings.HasPrefix(typ, "http") {
+				typ = turtleIRI(typ)
+			}
+			return turtleString(val) + "^^" + typ
+		}
+		if id, ok := v["@id"].(string); ok {
+			if len(v) > 1 {
+				t.pending = append(t.pending, v)
+			}
+			return turtleIRI(id)
+		}
+		return "[\n" + indent + "    " + t.predicates(v, indent) +
+			"\n" + indent + "]"
+	}
+	return turtleString(fmt.Sprint(v))
+}
+
+// writeCatalogTurtle writes a catalog returned by dcatCatalog as Turtle.
+func writeCatalogTurtle(w io.Writer, catalog map[string]interface{}) {
+	var prefixes []string
+	for p := range catalogContext {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	for _, p := range prefixes {
+		fmt.Fprintf(w, "@prefix %s: %s .\n", p,
+			turtleIRI(catalogContext[p].(string)))
+	}
+	var c = make(map[string]interface{})
+	for k, v := range catalog {
+		if k != "@context" {
+			c[k] = v
+		}
+	}
+	var t = &turtleWriter{w: w, written: make(map[string]bool)}
+	t.subject(c)
+}
+
+// acceptsTurtle reports whether the client prefers Turtle to JSON-LD.
+func acceptsTurtle(r *http.Request) bool {
+	for _, a := range r.Header["Accept"] {
+		for _, b := range strings.Split(a, ",") {
+			b = strings.TrimSpace(strings.SplitN(b, ";", 2)[0])
+			if b == "text/turtle" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Pages of the catalog.
+const (
+	catalogPageSize    = 100
+	maxCatalogPageSize = 1000
+)
+
+// pageParams reads the offset and limit query parameters of a request for
+// a page of results, returning limit if none is given and at most max.
+func pageParams(v url.Values, limit, max int) (int, int, error) {
+	var offset int
+	for _, p := range []struct {
+		name string
+		n    *int
+		min  int
+	}{{"limit", &limit, 1}, {"offset", &offset, 0}} {
+		if s := v.Get(p.name); s != "" {
+			var n, err = strconv.Atoi(s)
+			if err != nil || n < p.min {
+				return 0, 0, errors.New("Invalid " + p.name +
+					": " + s)
+			}
+			*p.n = n
+		}
+	}
+	if limit > max {
+		limit = max
+	}
+	return offset, limit, nil
+}
+
+// catalogView returns a Hydra view of a page of the catalog at path,
+// with links to the first, previous, next, and last pages, and the same
+// links in the form of a Link header.
+func catalogView(path string, offset, limit, total int) (
+	map[string]interface{}, string) {
+	var page = func(o int) string {
+		return joinURLPath(glintbaseurl, strings.TrimPrefix(path, "/")) +
+			"?offset=" + strconv.Itoa(o) + "&limit=" +
+			strconv.Itoa(limit)
+	}
+	var last int
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+	var view = map[string]interface{}{
+		"@id":         page(offset),
+		"@type":       "hydra:PartialCollectionView",
+		"hydra:first": map[string]interface{}{"@id": page(0)},
+		"hydra:last":  map[string]interface{}{"@id": page(last)},
+	}
+	var links = []string{"<" + page(0) + ">; rel=\"first\"",
+		"<" + page(last) + ">; rel=\"last\""}
+	if offset > 0 {
+		var prev = offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		view["hydra:previous"] = map[string]interface{}{"@id": page(prev)}
+		links = append(links, "<"+page(prev)+">; rel=\"prev\"")
+	}
+	if offset+limit < total {
+		view["hydra:next"] = map[string]interface{}{
+			"@id": page(offset + limit)}
+		links = append(links, "<"+page(offset+limit)+">; rel=\"next\"")
+	}
+	return view, strings.Join(links, ", ")
+}
+
+// handleCatalog lists data sets as a DCAT catalog, in JSON-LD or, if the
+// client accepts text/turtle or the path ends in ".ttl", in Turtle.  The
+// catalog is returned in pages selected by the offset and limit query
+// parameters; a catalog of more than one page has a Hydra view linking the
+// pages.
+func (srv *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	srv.logRequest(r, 0)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeMethodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+	var offset, limit, err = pageParams(r.URL.Query(), catalogPageSize,
+		maxCatalogPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var files []FileInfo
+	var total int
+	files, total, err = srv.storage.LookupFileInfoPage(offset, limit)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var catalog = dcatCatalog(files)
+	catalog["hydra:totalItems"] = map[string]interface{}{
+		"@value": strconv.Itoa(total),
+		"@type":  "xsd:integer",
+	}
+	if offset > 0 || total > limit {
+		var view, links = catalogView(r.URL.Path, offset, limit, total)
+		catalog["hydra:view"] = view
+		w.Header().Set("Link", links)
+	}
+	if r.URL.Path == "/catalog.ttl" ||
+		(r.URL.Path == "/catalog" && acceptsTurtle(r)) {
+		w.Header().Set("Content-Type", "text/turtle; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		writeCatalogTurtle(w, catalog)
+		return
+	}
+	var b []byte
+	b, err = json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ld+json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// schemaOrgDataset returns a data set as a schema.org Dataset in JSON-LD,
+// for embedding in its HTML page.
+func schemaOrgDataset(f *FileInfo) map[string]interface{} {
+	var url = joinURLPath(glintbaseurl, f.User+"/"+f.Path)
+	var d = map[string]interface{}{
+		"@context":     "https://schema.org/",
+		"@type":        "Dataset",
+		"name":         datasetTitle(f),
+		"description":  datasetDescription(f),
+		"url":          url,
+		"dateModified": f.Modified.UTC().Format(time.RFC3339),
+		"publisher": map[string]interface{}{
+			"@type": "Person",
+			"name":  f.User,
+			"url":   joinURLPath(glintbaseurl, f.User),
+		},
+	}
+	if f.Ark != "" {
+		d["identifier"] = arkURL(f.Ark)
+	}
+	var dists []interface{}
+	for _, dist := range datasetDistributions(url) {
+		dists = append(dists, map[string]interface{}{
+			"@type":          "DataDownload",
+			"encodingFormat": dist.MediaType,
+			"contentUrl":     dist.Url,
+		})
+	}
+	d["distribution"] = dists
+	var vars []interface{}
+	for _, a := range f.Attributes {
+		var v = map[string]interface{}{
+			"@type": "PropertyValue",
+			"name":  a.Name,
+		}
+		if a.Metadata.Label != "" {
+			v["description"] = a.Metadata.Label
+		}
+		if a.Metadata.Unit != "" {
+			v["unitText"] = a.Metadata.Unit
+		}
+		vars = append(vars, v)
+	}
+	if len(vars) > 0 {
+		d["variableMeasured"] = vars
+	}
+	var md *api.DatasetMetadata = f.Metadata
+	if md == nil {
+		return d
+	}
+	if len(md.Keywords) > 0 {
+		d["keywords"] = md.Keywords
+	}
+	if md.License != "" {
+		d["license"] = nsSPDX + strings.TrimSuffix(md.License, "+")
+	}
+	if len(md.Creators) > 0 {
+		var creators []interface{}
+		for _, c := range md.Creators {
+			var p = map[string]interface{}{
+				"@type": "Person",
+				"name":  c.Name,
+			}
+			if c.Id != "" {
+				p["identifier"] = c.Id
+			}
+			if c.Affiliation != "" {
+				p["affiliation"] = map[string]interface{}{
+					"@type": "Organization",
+					"name":  c.Affiliation,
+				}
+			}
+			creators = append(creators, p)
+		}
+		d["creator"] = creators
+	}
+	if len(md.Funders) > 0 {
+		var funders []interface{}
+		for _, name := range md.Funders {
+			funders = append(funders, map[string]interface{}{
+				"@type": "Organization",
+				"name":  name,
+			})
+		}
+		d["funder"] = funders
+	}
+	if t := md.Temporal; t != nil && (t.Start != "" || t.End != "") {
+		var start, end = t.Start, t.End
+		if start == "" {
+			start = ".."
+		}
+		if end == "" {
+			end = ".."
+		}
+		d["temporalCoverage"] = start + "/" + end
+	}
+	if s := md.Spatial; s != nil && (s.Place != "" || len(s.Bbox) == 4) {
+		var p = map[string]interface{}{"@type": "Place"}
+		if s.Place != "" {
+			p["name"] = s.Place
+		}
+		if len(s.Bbox) == 4 {
+			// schema.org boxes are "south west north east".
+			p["geo"] = map[string]interface{}{
+				"@type": "GeoShape",
+				"box": fmt.Sprintf("%g %g %g %g", s.Bbox[1],
+					s.Bbox[0], s.Bbox[3], s.Bbox[2]),
+			}
+		}
+		d["spatialCoverage"] = p
+	}
+	return d
+}
+
+// htmlSchemaOrg returns a script element containing the schema.org
+// description of a data set.
+func htmlSchemaOrg(f *FileInfo) string {
+	// json.Marshal escapes "<", ">", and "&", so the JSON cannot end
+	// the script element.
+	var b, err = json.Marshal(schemaOrgDataset(f))
+	if err != nil {
+		return ""
+	}
+	return "<script type=\"application/ld+json\">" + string(b) +
+		"</script>\n"
+}
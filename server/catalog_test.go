@@ -0,0 +1,348 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// catalogFile returns a data set with descriptive metadata.
+func catalogFile() *FileInfo {
+	return &FileInfo{
+		User:     "izzy",
+		Path:     "ocean",
+		Rows:     2,
+		Modified: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Ark:      "ark:/99999/fk4abc",
+		Attributes: []AttributeInfo{
+			{Name: "t", Metadata: api.AttributeMetadata{
+				Label: "Temperature", Unit: "Cel"}},
+		},
+		Metadata: &api.DatasetMetadata{
+			Title:    "Ocean \"temperature\"",
+			License:  "GPL-2.0+",
+			Keywords: []string{"ocean"},
+			Creators: []api.Creator{
+				{Name: "Izzy", Id: "https://orcid.org/0000-0001",
+					Affiliation: "UCSD"},
+				{Name: "Bob", Id: "bob@example.org"},
+			},
+			Funders: []string{"NSF"},
+			Temporal: &api.TemporalCoverage{Start: "2020-01-01",
+				End: "2020-06-30T12:00:00Z"},
+			Spatial: &api.SpatialCoverage{Place: "Pacific",
+				Bbox: []float64{-130, 30, -120, 40}},
+		},
+	}
+}
+
+// roundTrip returns v as it would be read from its JSON encoding.
+func roundTrip(t *testing.T, v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r interface{}
+	if err = json.Unmarshal(b, &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// jsonPath returns the value at a path of keys and indexes in decoded JSON.
+func jsonPath(v interface{}, path ...interface{}) interface{} {
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			m, _ := v.(map[string]interface{})
+			v = m[k]
+		case int:
+			a, _ := v.([]interface{})
+			if k >= len(a) {
+				return nil
+			}
+			v = a[k]
+		}
+	}
+	return v
+}
+
+func TestPageParams(t *testing.T) {
+	for _, c := range []struct {
+		query         string
+		offset, limit int
+		ok            bool
+	}{
+		{"", 0, 100, true},
+		{"offset=200", 200, 100, true},
+		{"limit=10&offset=5", 5, 10, true},
+		{"limit=5000", 0, 1000, true},
+		{"limit=0", 0, 0, false},
+		{"offset=-1", 0, 0, false},
+		{"offset=x", 0, 0, false},
+	} {
+		v, _ := url.ParseQuery(c.query)
+		offset, limit, err := pageParams(v, catalogPageSize,
+			maxCatalogPageSize)
+		if (err == nil) != c.ok {
+			t.Errorf("%q: error %v", c.query, err)
+			continue
+		}
+		if c.ok && (offset != c.offset || limit != c.limit) {
+			t.Errorf("%q: offset %d, limit %d", c.query, offset,
+				limit)
+		}
+	}
+}
+
+func TestCatalogView(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	id := func(v interface{}) string {
+		if m, ok := v.(map[string]interface{}); ok {
+			s, _ := m["@id"].(string)
+			return s
+		}
+		return ""
+	}
+	const base = "https://glint.example.org/catalog?offset="
+	view, links := catalogView("/catalog", 100, 100, 250)
+	for k, want := range map[string]string{
+		"hydra:first":    base + "0&limit=100",
+		"hydra:previous": base + "0&limit=100",
+		"hydra:next":     base + "200&limit=100",
+		"hydra:last":     base + "200&limit=100",
+	} {
+		if got := id(view[k]); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if !strings.Contains(links, "<"+base+"200&limit=100>; rel=\"next\"") {
+		t.Errorf("links: %s", links)
+	}
+	view, links = catalogView("/catalog.ttl", 200, 100, 250)
+	if view["hydra:next"] != nil || strings.Contains(links, "next") {
+		t.Errorf("last page has a next page: %v", view)
+	}
+	if got := id(view["hydra:previous"]); got !=
+		"https://glint.example.org/catalog.ttl?offset=100&limit=100" {
+		t.Errorf("previous = %q", got)
+	}
+}
+
+func TestDcatDataset(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	d := roundTrip(t, dcatDataset(catalogFile()))
+	const url = "https://glint.example.org/izzy/ocean"
+	for _, c := range []struct {
+		path []interface{}
+		want interface{}
+	}{
+		{[]interface{}{"@id"}, url},
+		{[]interface{}{"dct:title"}, "Ocean \"temperature\""},
+		{[]interface{}{"dct:identifier"}, "ark:/99999/fk4abc"},
+		{[]interface{}{"dct:modified", "@value"}, "2021-03-04T05:06:07Z"},
+		{[]interface{}{"dct:license", "@id"},
+			"https://spdx.org/licenses/GPL-2.0"},
+		{[]interface{}{"dcat:keyword", 0}, "ocean"},
+		{[]interface{}{"dct:creator", 0, "@id"},
+			"https://orcid.org/0000-0001"},
+		{[]interface{}{"dct:creator", 1, "@id"}, nil},
+		{[]interface{}{"dct:creator", 1, "dct:identifier"},
+			"bob@example.org"},
+		{[]interface{}{"dct:temporal", "dcat:startDate", "@type"},
+			nsXSD + "date"},
+		{[]interface{}{"dct:temporal", "dcat:endDate", "@type"},
+			nsXSD + "dateTime"},
+		{[]interface{}{"dct:spatial", "skos:prefLabel"}, "Pacific"},
+		{[]interface{}{"dct:spatial", "dcat:bbox", "@value"},
+			"POLYGON((-130 30,-120 30,-120 40,-130 40,-130 30))"},
+		{[]interface{}{"dcat:distribution", 1, "dcat:downloadURL", "@id"},
+			url + "?as(tsv)"},
+	} {
+		if got := jsonPath(d, c.path...); !reflect.DeepEqual(got,
+			c.want) {
+			t.Errorf("%v = %v, want %v", c.path, got, c.want)
+		}
+	}
+
+	// A data set without metadata is described by its path.
+	f := catalogFile()
+	f.Metadata, f.Ark = nil, ""
+	d = roundTrip(t, dcatDataset(f))
+	if got := jsonPath(d, "dct:title"); got != "ocean" {
+		t.Errorf("title %v", got)
+	}
+	if got, _ := jsonPath(d, "dct:description").(string); got !=
+		"Data set ocean published by izzy on "+
+			"https://glint.example.org, with 2 rows and 1 columns." {
+		t.Errorf("description %q", got)
+	}
+	for _, k := range []string{"dct:identifier", "dct:license",
+		"dct:creator", "dct:temporal", "dct:spatial"} {
+		if v := jsonPath(d, k); v != nil {
+			t.Errorf("%s = %v", k, v)
+		}
+	}
+}
+
+func TestDcatCatalog(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	c := roundTrip(t, dcatCatalog(nil))
+	if got := jsonPath(c, "dcat:dataset"); !reflect.DeepEqual(got,
+		[]interface{}{}) {
+		t.Errorf("empty catalog has data sets %v", got)
+	}
+	c = roundTrip(t, dcatCatalog([]FileInfo{*catalogFile()}))
+	if got := jsonPath(c, "@id"); got !=
+		"https://glint.example.org/catalog" {
+		t.Errorf("@id %v", got)
+	}
+	if got := jsonPath(c, "dcat:dataset", 0, "@id"); got !=
+		"https://glint.example.org/izzy/ocean" {
+		t.Errorf("data set %v", got)
+	}
+	if got := jsonPath(c, "@context", "dcat"); got != nsDCAT {
+		t.Errorf("context %v", got)
+	}
+}
+
+func TestTurtleString(t *testing.T) {
+	for s, want := range map[string]string{
+		"":                   `""`,
+		"plain":              `"plain"`,
+		"a \"quote\"":        `"a \"quote\""`,
+		"back\\slash":        `"back\\slash"`,
+		"line\nbreak\r\ttab": `"line\nbreak\r\ttab"`,
+	} {
+		if got := turtleString(s); got != want {
+			t.Errorf("turtleString(%q) = %s, want %s", s, got, want)
+		}
+	}
+	if got := turtleIRI("https://x.org/a b<c>{d}"); got !=
+		"<https://x.org/a%20b%3Cc%3E%7Bd%7D>" {
+		t.Errorf("turtleIRI = %s", got)
+	}
+}
+
+func TestWriteCatalogTurtle(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	var b bytes.Buffer
+	writeCatalogTurtle(&b, dcatCatalog([]FileInfo{*catalogFile()}))
+	s := b.String()
+	for _, want := range []string{
+		"@prefix dcat: <http://www.w3.org/ns/dcat#> .\n",
+		"\n<https://glint.example.org/catalog>\n    a dcat:Catalog ;",
+		"dcat:dataset <https://glint.example.org/izzy/ocean>",
+		"\n<https://glint.example.org/izzy/ocean>\n    a dcat:Dataset ;",
+		`dct:title "Ocean \"temperature\""`,
+		`dct:modified "2021-03-04T05:06:07Z"^^xsd:dateTime`,
+		`dcat:startDate "2020-01-01"^^<http://www.w3.org/2001/` +
+			`XMLSchema#date>`,
+		`dcat:keyword "ocean"`,
+		"dct:creator <https://orcid.org/0000-0001>, [\n",
+		"\n<https://orcid.org/0000-0001>\n    a foaf:Agent ;",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("missing %q in:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "@context") {
+		t.Errorf("context written as a predicate:\n%s", s)
+	}
+	// Each subject is written once.
+	if n := strings.Count(s, "\n<https://orcid.org/0000-0001>\n"); n != 1 {
+		t.Errorf("creator written %d times", n)
+	}
+}
+
+func TestAcceptsTurtle(t *testing.T) {
+	for _, c := range []struct {
+		accept []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"application/ld+json"}, false},
+		{[]string{"text/turtle"}, true},
+		{[]string{"application/ld+json;q=0.9, text/turtle;q=0.5"}, true},
+		{[]string{"text/html", "text/turtle"}, true},
+		{[]string{"text/turtles"}, false},
+	} {
+		r := httptest.NewRequest("GET", "/catalog", nil)
+		r.Header["Accept"] = c.accept
+		if got := acceptsTurtle(r); got != c.want {
+			t.Errorf("%q: %v", c.accept, got)
+		}
+	}
+}
+
+func TestSchemaOrgDataset(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	d := roundTrip(t, schemaOrgDataset(catalogFile()))
+	for _, c := range []struct {
+		path []interface{}
+		want interface{}
+	}{
+		{[]interface{}{"@type"}, "Dataset"},
+		{[]interface{}{"url"}, "https://glint.example.org/izzy/ocean"},
+		{[]interface{}{"identifier"},
+			"https://glint.example.org/ark:/99999/fk4abc"},
+		{[]interface{}{"license"}, "https://spdx.org/licenses/GPL-2.0"},
+		{[]interface{}{"creator", 0, "affiliation", "name"}, "UCSD"},
+		{[]interface{}{"creator", 1, "identifier"}, "bob@example.org"},
+		{[]interface{}{"funder", 0, "name"}, "NSF"},
+		{[]interface{}{"temporalCoverage"},
+			"2020-01-01/2020-06-30T12:00:00Z"},
+		{[]interface{}{"spatialCoverage", "geo", "box"},
+			"30 -130 40 -120"},
+		{[]interface{}{"variableMeasured", 0, "unitText"}, "Cel"},
+		{[]interface{}{"distribution", 2, "encodingFormat"},
+			"application/json"},
+	} {
+		if got := jsonPath(d, c.path...); !reflect.DeepEqual(got,
+			c.want) {
+			t.Errorf("%v = %v, want %v", c.path, got, c.want)
+		}
+	}
+	f := catalogFile()
+	f.Metadata.Temporal = &api.TemporalCoverage{End: "2020-06-30"}
+	d = roundTrip(t, schemaOrgDataset(f))
+	if got := jsonPath(d, "temporalCoverage"); got != "../2020-06-30" {
+		t.Errorf("open-ended coverage %v", got)
+	}
+}
+
+func TestHtmlSchemaOrg(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	f := catalogFile()
+	f.Metadata.Title = "</script><script>alert(1)"
+	h := htmlSchemaOrg(f)
+	if !strings.HasPrefix(h, `<script type="application/ld+json">`) ||
+		!strings.HasSuffix(h, "</script>\n") {
+		t.Fatalf("not a script element: %s", h)
+	}
+	if strings.Count(h, "</script>") != 1 {
+		t.Errorf("title ends the script element: %s", h)
+	}
+	var d interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(strings.TrimPrefix(h,
+		`<script type="application/ld+json">`), "</script>\n")),
+		&d); err != nil {
+		t.Fatal(err)
+	}
+	if got := jsonPath(d, "name"); got != f.Metadata.Title {
+		t.Errorf("name %v", got)
+	}
+}
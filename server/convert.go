@@ -0,0 +1,478 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Data types accepted by convertData.
+const (
+	typeCSV        = "csv"
+	typeTSV        = "tsv"
+	typeSemicolon  = "ssv"
+	typePipe       = "psv"
+	typeFixedWidth = "fixed"
+	typeJSON       = "json"
+	typeNDJSON     = "ndjson"
+)
+
+// dataTypeAliases maps the names that clients may use for data types to the
+// canonical names.
+var dataTypeAliases = map[string]string{
+	"":          "",
+	"csv":       typeCSV,
+	"tsv":       typeTSV,
+	"tab":       typeTSV,
+	"ssv":       typeSemicolon,
+	"semicolon": typeSemicolon,
+	"psv":       typePipe,
+	"pipe":      typePipe,
+	"fixed":     typeFixedWidth,
+	"fwf":       typeFixedWidth,
+	"json":      typeJSON,
+	"ndjson":    typeNDJSON,
+	"jsonl":     typeNDJSON,
+}
+
+// Errors returned by convertData for input that contains no data set.
+var (
+	errNoData    = errors.New("No data found")
+	errNoColumns = errors.New("No columns found")
+)
+
+// conversion describes how data were interpreted by convertData.
+type conversion struct {
+	Type      string
+	Delimiter string
+	Encoding  string
+	Columns   []string
+}
+
+// convertData converts data of the given type to CSV with a header line.  If
+// typ is empty, the data are assumed to be delimited text and the delimiter
+// is detected.  If noHeader is true, the data have no header line, and
+// column names are taken from columns or generated as V1, V2, etc.  If
+// noHeader is false and columns is not empty, columns replaces the names in
+// the header line.
+func convertData(raw []byte, typ string, noHeader bool, columns []string) (
+	string, *conversion, error) {
+
+	t, ok := dataTypeAliases[strings.ToLower(typ)]
+	if !ok {
+		return "", nil, fmt.Errorf("Unknown data type: %s", typ)
+	}
+	text, encoding := decodeText(raw)
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	conv := &conversion{Type: t, Encoding: encoding}
+	if strings.TrimSpace(text) == "" {
+		return "", nil, errNoData
+	}
+
+	var records [][]string
+	var err error
+	switch t {
+	case typeJSON, typeNDJSON:
+		// Objects supply their own column names.
+		var objects bool
+		records, objects, err = parseJSONRecords(text, t == typeNDJSON)
+		if objects {
+			noHeader = false
+		}
+	case typeFixedWidth:
+		records = parseFixedWidth(text)
+	default:
+		var delim rune
+		switch t {
+		case typeCSV:
+			delim = ','
+		case typeTSV:
+			delim = '\t'
+		case typeSemicolon:
+			delim = ';'
+		case typePipe:
+			delim = '|'
+		default:
+			delim = detectDelimiter(text)
+			switch delim {
+			case '\t':
+				conv.Type = typeTSV
+			case ';':
+				conv.Type = typeSemicolon
+			case '|':
+				conv.Type = typePipe
+			default:
+				conv.Type = typeCSV
+			}
+		}
+		conv.Delimiter = string(delim)
+		records, err = parseDelimited(text, delim)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(records) == 0 {
+		return "", nil, errNoData
+	}
+
+	var header []string
+	if noHeader {
+		width := 0
+		for _, r := range records {
+			if len(r) > width {
+				width = len(r)
+			}
+		}
+		header = make([]string, width)
+		for i := range header {
+			header[i] = "V" + strconv.Itoa(i+1)
+		}
+	} else {
+		header = records[0]
+		records = records[1:]
+	}
+	// JSON objects with no keys, or empty arrays, have no columns.
+	if len(header) == 0 {
+		return "", nil, errNoColumns
+	}
+	if len(columns) > 0 {
+		if len(columns) != len(header) {
+			return "", nil, fmt.Errorf("%d column names given, "+
+				"but the data have %d columns", len(columns),
+				len(header))
+		}
+		header = columns
+	}
+	if err = checkColumnNames(header); err != nil {
+		return "", nil, err
+	}
+	conv.Columns = header
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(header)
+	for i, r := range records {
+		if len(r) > len(header) {
+			return "", nil, fmt.Errorf("Row %d has %d values, but "+
+				"there are only %d columns", i+1, len(r),
+				len(header))
+		}
+		for len(r) < len(header) {
+			r = append(r, "")
+		}
+		w.Write(r)
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return "", nil, err
+	}
+	return b.String(), conv, nil
+}
+
+// checkColumnNames reports empty or duplicate column names.
+func checkColumnNames(header []string) error {
+	seen := make(map[string]bool)
+	for i, h := range header {
+		if strings.TrimSpace(h) == "" {
+			return fmt.Errorf("Column %d has no name", i+1)
+		}
+		if seen[h] {
+			return fmt.Errorf("Duplicate column name: %s", h)
+		}
+		seen[h] = true
+	}
+	return nil
+}
+
+// decodeText converts raw bytes to a string, detecting the encoding from a
+// byte order mark or from whether the data are valid UTF-8.  Data that are
+// not UTF-8 are assumed to be Windows-1252, a superset of ISO 8859-1.
+func decodeText(raw []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(raw, []byte{0xef, 0xbb, 0xbf}):
+		return string(raw[3:]), "UTF-8"
+	case bytes.HasPrefix(raw, []byte{0xff, 0xfe}):
+		return decodeUTF16(raw[2:], false), "UTF-16LE"
+	case bytes.HasPrefix(raw, []byte{0xfe, 0xff}):
+		return decodeUTF16(raw[2:], true), "UTF-16BE"
+	case utf8.Valid(raw):
+		return string(raw), "UTF-8"
+	}
+	var b strings.Builder
+	for _, c := range raw {
+		if c >= 0x80 && c < 0xa0 && windows1252[c-0x80] != 0 {
+			b.WriteRune(windows1252[c-0x80])
+		} else {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String(), "windows-1252"
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		if bigEndian {
+			u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			u[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+// windows1252 maps bytes 0x80-0x9f in Windows-1252 to Unicode; zero entries
+// are undefined and are treated as the corresponding C1 control.
+var windows1252 = [32]rune{
+	0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+	0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+}
+
+// detectDelimiter chooses the delimiter that occurs the same, nonzero
+// number of times in each of the first lines of text, preferring the one
+// that occurs most often.  Quoted values are not taken into account.  If no
+// delimiter is consistent, comma is assumed.
+func detectDelimiter(text string) rune {
+	lines := strings.SplitN(text, "\n", 11)
+	if len(lines) > 10 {
+		lines = lines[:10]
+	}
+	best, bestCount := ',', 0
+	for _, d := range []rune{',', '\t', ';', '|'} {
+		count := -1
+		for _, l := range lines {
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			n := strings.Count(l, string(d))
+			if count == -1 {
+				count = n
+			} else if n != count {
+				count = 0
+				break
+			}
+		}
+		if count > bestCount {
+			best, bestCount = d, count
+		}
+	}
+	return best
+}
+
+// readCSV parses data in the form stored by convertData, which is CSV as in
+// RFC 4180: values may be quoted and contain commas, quotes, and newlines.
+// Blank lines are skipped, and rows may have fewer values than the header.
+func readCSV(data string) ([][]string, error) {
+	return parseDelimited(data, ',')
+}
+
+// writeCSV formats records in the form stored by convertData.
+func writeCSV(records [][]string) (string, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.WriteAll(records)
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func parseDelimited(text string, delim rune) ([][]string, error) {
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = delim
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// parseFixedWidth splits fixed-width text into columns.  Column boundaries
+// are inferred from character positions that are blank in every line.
+func parseFixedWidth(text string) [][]string {
+	var lines [][]rune
+	width := 0
+	for _, l := range strings.Split(text, "\n") {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		r := []rune(strings.Replace(l, "\t", " ", -1))
+		lines = append(lines, r)
+		if len(r) > width {
+			width = len(r)
+		}
+	}
+	blank := make([]bool, width+1)
+	for i := range blank {
+		blank[i] = true
+	}
+	for _, l := range lines {
+		for i, c := range l {
+			if c != ' ' {
+				blank[i] = false
+			}
+		}
+	}
+	type span struct{ start, end int }
+	var spans []span
+	start := -1
+	for i, b := range blank {
+		if !b && start == -1 {
+			start = i
+		}
+		if b && start != -1 {
+			spans = append(spans, span{start, i})
+			start = -1
+		}
+	}
+	records := make([][]string, 0, len(lines))
+	for _, l := range lines {
+		rec := make([]string, len(spans))
+		for j, s := range spans {
+			if s.start < len(l) {
+				end := s.end
+				if end > len(l) {
+					end = len(l)
+				}
+				rec[j] = strings.TrimSpace(string(l[s.start:end]))
+			}
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+// parseJSONRecords reads a JSON array, or newline-delimited JSON values if
+// ndjson is true.  Each value may be an object, in which case the keys
+// become the column names in order of first appearance, or an array of
+// values.  The second result is true if the rows were objects, in which
+// case the first record holds the column names.
+func parseJSONRecords(text string, ndjson bool) ([][]string, bool, error) {
+
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	if !ndjson {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false, err
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '[' {
+			return nil, false, errors.New("JSON data must be an array")
+		}
+	}
+	var objects []map[string]string
+	var keys []string
+	keyIndex := make(map[string]bool)
+	var arrays [][]string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false, err
+		}
+		d, ok := tok.(json.Delim)
+		if !ok {
+			return nil, false, errors.New("JSON rows must be objects or arrays")
+		}
+		switch d {
+		case '{':
+			obj := make(map[string]string)
+			for dec.More() {
+				kt, err := dec.Token()
+				if err != nil {
+					return nil, false, err
+				}
+				k := kt.(string)
+				v, err := jsonValue(dec)
+				if err != nil {
+					return nil, false, err
+				}
+				obj[k] = v
+				if !keyIndex[k] {
+					keyIndex[k] = true
+					keys = append(keys, k)
+				}
+			}
+			if _, err = dec.Token(); err != nil {
+				return nil, false, err
+			}
+			objects = append(objects, obj)
+		case '[':
+			var row []string
+			for dec.More() {
+				v, err := jsonValue(dec)
+				if err != nil {
+					return nil, false, err
+				}
+				row = append(row, v)
+			}
+			if _, err = dec.Token(); err != nil {
+				return nil, false, err
+			}
+			arrays = append(arrays, row)
+		default:
+			return nil, false, errors.New("Malformed JSON data")
+		}
+	}
+	if objects != nil && arrays != nil {
+		return nil, false, errors.New("JSON rows must be either all objects " +
+			"or all arrays")
+	}
+	if arrays != nil {
+		return arrays, false, nil
+	}
+	records := make([][]string, 0, len(objects)+1)
+	records = append(records, keys)
+	for _, obj := range objects {
+		row := make([]string, len(keys))
+		for i, k := range keys {
+			row[i] = obj[k]
+		}
+		records = append(records, row)
+	}
+	return records, true, nil
+}
+
+// jsonValue reads a scalar JSON value and returns it as text.  Nested
+// objects and arrays are returned as compact JSON.
+func jsonValue(dec *json.Decoder) (string, error) {
+	var v json.RawMessage
+	if err := dec.Decode(&v); err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	var x interface{}
+	d := json.NewDecoder(bytes.NewReader(v))
+	d.UseNumber()
+	if err := d.Decode(&x); err != nil {
+		return "", err
+	}
+	switch t := x.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	default:
+		var b bytes.Buffer
+		if err := json.Compact(&b, v); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+func TestConvertData(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		raw      string
+		typ      string
+		noHeader bool
+		columns  []string
+		data     string
+		conv     conversion
+	}{
+		{"comma", "a,b\n1,2\n3,4\n", "", false, nil,
+			"a,b\n1,2\n3,4\n",
+			conversion{typeCSV, ",", "UTF-8", []string{"a", "b"}}},
+		{"tab", "a\tb\r\n1\t2\r\n", "", false, nil,
+			"a,b\n1,2\n",
+			conversion{typeTSV, "\t", "UTF-8", []string{"a", "b"}}},
+		{"semicolon", "a;b\n1,5;2\n", "ssv", false, nil,
+			"a,b\n\"1,5\",2\n",
+			conversion{typeSemicolon, ";", "UTF-8",
+				[]string{"a", "b"}}},
+		{"pipe", "a|b\n1,5|2\n", "", false, nil,
+			"a,b\n\"1,5\",2\n",
+			conversion{typePipe, "|", "UTF-8", []string{"a", "b"}}},
+		{"quoted", "a,b\n\"x, y\",\"2\n3\"\n", "csv", false, nil,
+			"a,b\n\"x, y\",\"2\n3\"\n",
+			conversion{typeCSV, ",", "UTF-8", []string{"a", "b"}}},
+		{"short rows", "a,b,c\n1\n", "csv", false, nil,
+			"a,b,c\n1,,\n",
+			conversion{typeCSV, ",", "UTF-8",
+				[]string{"a", "b", "c"}}},
+		{"no header", "1,2\n3,4\n", "csv", true, nil,
+			"V1,V2\n1,2\n3,4\n",
+			conversion{typeCSV, ",", "UTF-8", []string{"V1", "V2"}}},
+		{"columns", "1,2\n", "csv", true, []string{"x", "y"},
+			"x,y\n1,2\n",
+			conversion{typeCSV, ",", "UTF-8", []string{"x", "y"}}},
+		{"bom", "\xef\xbb\xbfa\n1\n", "", false, nil, "a\n1\n",
+			conversion{typeCSV, ",", "UTF-8", []string{"a"}}},
+		{"windows-1252", "a\n\x80\xe9\n", "", false, nil,
+			"a\n€é\n",
+			conversion{typeCSV, ",", "windows-1252",
+				[]string{"a"}}},
+		{"utf-16", "\xff\xfea\x00\n\x001\x00\n\x00", "", false, nil,
+			"a\n1\n",
+			conversion{typeCSV, ",", "UTF-16LE", []string{"a"}}},
+		{"json objects", `[{"a":1,"b":"x"},{"b":null,"c":true}]`,
+			"json", false, nil, "a,b,c\n1,x,\n,,true\n",
+			conversion{typeJSON, "", "UTF-8",
+				[]string{"a", "b", "c"}}},
+		{"ndjson arrays", "[1,2]\n[3,4]\n", "jsonl", true, nil,
+			"V1,V2\n1,2\n3,4\n",
+			conversion{typeNDJSON, "", "UTF-8",
+				[]string{"V1", "V2"}}},
+		{"fixed", "a   bb\n1   22\n333 4\n", "fwf", false, nil,
+			"a,bb\n1,22\n333,4\n",
+			conversion{typeFixedWidth, "", "UTF-8",
+				[]string{"a", "bb"}}},
+	} {
+		data, conv, err := convertData([]byte(c.raw), c.typ, c.noHeader,
+			c.columns)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if data != c.data {
+			t.Errorf("%s: data = %q, want %q", c.name, data, c.data)
+		}
+		if !reflect.DeepEqual(*conv, c.conv) {
+			t.Errorf("%s: conversion = %+v, want %+v", c.name, *conv,
+				c.conv)
+		}
+	}
+}
+
+func TestConvertDataErrors(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		raw     string
+		typ     string
+		columns []string
+	}{
+		{"unknown type", "a\n", "xls", nil},
+		{"empty", "", "csv", nil},
+		{"empty column name", "a,,c\n", "csv", nil},
+		{"duplicate column name", "a,a\n", "csv", nil},
+		{"long row", "a,b\n1,2,3\n", "csv", nil},
+		{"column count", "a,b\n", "csv", []string{"x"}},
+		{"json scalar", `[1]`, "json", nil},
+		{"json mixed", `[{"a":1},[1]]`, "json", nil},
+	} {
+		if _, _, err := convertData([]byte(c.raw), c.typ, false,
+			c.columns); err == nil {
+			t.Errorf("%s: no error", c.name)
+		}
+	}
+}
+
+func TestConvertDataNoColumns(t *testing.T) {
+	for _, c := range []struct {
+		raw, typ string
+		noHeader bool
+		err      error
+	}{
+		{"", "csv", false, errNoData},
+		{"", "json", false, errNoData},
+		{`[]`, "json", false, errNoColumns},
+		{`[{}]`, "json", false, errNoColumns},
+		{`[{},{}]`, "json", false, errNoColumns},
+		{"{}\n{}\n", "ndjson", false, errNoColumns},
+		{`[[]]`, "json", false, errNoColumns},
+		{`[[]]`, "json", true, errNoColumns},
+	} {
+		if _, _, err := convertData([]byte(c.raw), c.typ, c.noHeader,
+			nil); err != c.err {
+			t.Errorf("%s %q: error %v, want %v", c.typ, c.raw, err,
+				c.err)
+		}
+	}
+}
+
+func TestStoreDataEmpty(t *testing.T) {
+	srv, st, _ := newSessionServer(t)
+	ust := &uploadStorage{sessionStorage: st, files: map[string]string{}}
+	srv.storage = ust
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	for _, c := range []struct {
+		raw, typ string
+		code     int
+	}{
+		{`[{}]`, "json", http.StatusBadRequest},
+		{"", "csv", http.StatusBadRequest},
+		{`[1]`, "json", http.StatusUnprocessableEntity},
+		{`[{"a":1}]`, "json", http.StatusCreated},
+	} {
+		w := httptest.NewRecorder()
+		srv.storeData(w, "alice", 1, "ocean", []byte(c.raw),
+			&api.PostRequest{Type: c.typ}, nil)
+		if w.Code != c.code {
+			t.Errorf("%s %q: status %d, want %d", c.typ, c.raw, w.Code,
+				c.code)
+		}
+	}
+	if len(ust.files) != 1 {
+		t.Errorf("%d data sets stored", len(ust.files))
+	}
+}
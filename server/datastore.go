@@ -4,6 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"plugin"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
 )
 
 type Storage interface {
@@ -16,11 +19,14 @@ type Storage interface {
 
 	//AddMetadata()
 	AddMetadata(personId int64, path string, attribute string,
-		metadata string) error
+		metadata *api.AttributeMetadata) error
+
+	AddMetadataBatch(personId int64, path string,
+		merge MetadataMerge) error
 
 	//LookupMetadata()
-	LookupMetadata(personId int64, path string, attribute string) (string,
-		error)
+	LookupMetadata(personId int64, path string, attribute string) (
+		*api.AttributeMetadata, error)
 
 	//LookupData()
 	LookupData(person_id int64, path string) (string, error)
@@ -28,8 +34,23 @@ type Storage interface {
 	//LookupDataList()
 	LookupDataList(person_id int64) (string, error)
 
+	LookupFileInfoList(personId int64) ([]FileInfo, error)
+	LookupAllFileInfo() ([]FileInfo, error)
+	LookupFileInfoPage(offset, limit int) ([]FileInfo, int, error)
+	LookupFileInfo(personId int64, path string) (*FileInfo, error)
+
 	//AddFile()
-	AddFile(person_id int64, path string, data string) (int64, error)
+	AddFile(person_id int64, path string, data string, hash string) (int64,
+		error)
+
+	ReplaceFile(fileId int64, data string, hash string, attrs []string) error
+
+	StoreFile(f *StoredFile) (int64, string, error)
+
+	AppendFile(fileId int64, rows [][]string, key string) (int, error)
+
+	StoreAppend(fileId int64, rows [][]string, key string,
+		mint func() (string, error)) (int, string, error)
 
 	//DeleteFile()
 	DeleteFile(personId int64, path string) error
@@ -41,13 +62,71 @@ type Storage interface {
 	LookupPersonId(username string) (int64, error)
 	AddPerson(username string, fullname string, email string,
 		password string) error
+	AddExternalPerson(username string, fullname string, email string,
+		provider string, subject string) error
+	LookupPersonProvider(username string) (string, string, error)
+	BindExternalPerson(username string, provider string,
+		subject string) error
+	LookupAccountDisabled(username string) (bool, error)
+	SetAccountDisabled(username string, disabled bool) error
+	LookupLoginFailures(username string) (int, time.Time, error)
+	RecordLoginFailure(username string) error
+	ResetLoginFailures(username string) error
+	UnlockAddress(ip string) error
+	LookupAddressUnlock(ip string) (time.Time, error)
+	LookupEmail(username string) (string, error)
+	AddPasswordReset(username string, tokenHash string,
+		expires time.Time) error
+	ResetPassword(tokenHash string, password string) (string, error)
+	AddSession(username string, tokenHash string, expires time.Time) error
+	LookupSession(tokenHash string) (string, error)
+	DeleteSession(tokenHash string) error
+	AddAuditEvent(e *AuditEvent) error
+	LookupAuditEvents(f *AuditFilter) ([]AuditEvent, error)
 	LookupFileId(personId int64, path string) (int64, error)
 	AddAttributes(file_id int64, attrs []string) error
+	AddDatasetMetadata(fileId int64, metadata *api.DatasetMetadata) error
+
+	AddRevision(fileId int64, mint func() (string, error)) (string, error)
+	LookupRevision(ark string) (*Revision, error)
+	LookupFilesWithoutRevision() ([]int64, error)
+	AddDerivation(fileId int64, d *api.Derivation) error
+	LookupDerivations(personId int64, path string) ([]api.Derivation,
+		error)
 	CreateTableAttribute(tx *sql.Tx) error
 	CreateTableFile(tx *sql.Tx) error
 	CreateSchema() error
 }
 
+// MetadataMerge is called by AddMetadataBatch with the current metadata of
+// the attributes of a data set, and returns the metadata to be replaced.
+type MetadataMerge func(current map[string]*api.AttributeMetadata) (
+	map[string]*api.AttributeMetadata, error)
+
+// StoredFile describes a data set to be stored by StoreFile.
+type StoredFile struct {
+	// FileId is the id of the file to replace, or 0 to add a new file.
+	FileId     int64
+	PersonId   int64
+	Path       string
+	Data       string
+	Hash       string
+	Attributes []string
+
+	// Metadata, if not nil, replace the descriptive metadata.
+	Metadata *api.DatasetMetadata
+
+	// Derivation, if not nil, describes how the data were derived.  Its
+	// Ark is set to the ARK of the new revision.
+	Derivation *api.Derivation
+
+	// AttributeMetadata are set for the attributes of the same name.
+	AttributeMetadata map[string]*api.AttributeMetadata
+
+	// Mint returns an ARK for the new revision.
+	Mint func() (string, error)
+}
+
 func StoragePlugin(pluginFile string) (Storage, error) {
 
 	p, err := plugin.Open(pluginFile)
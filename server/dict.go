@@ -0,0 +1,219 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// maxDictExamples is the number of example values listed for each attribute
+// in a data dictionary.
+const maxDictExamples = 3
+
+// dictColumns lists the columns of a data dictionary in CSV or TSV.
+var dictColumns = []string{"attribute", "type", "term", "unit",
+	"description", "nulls", "distinct", "min", "max", "examples"}
+
+// dataDictionary summarizes each attribute of data, with its metadata
+// returned by metadataOf.  Empty values and values equal to the attribute's
+// missing value are counted as nulls and are otherwise ignored.
+func dataDictionary(data string,
+	metadataOf func(attr string) *api.AttributeMetadata) (
+	[]api.AttributeSummary, int) {
+	var rows, err = readCSV(data)
+	if err != nil || len(rows) == 0 {
+		return []api.AttributeSummary{}, 0
+	}
+	var header []string = rows[0]
+	var attrs = make([]api.AttributeSummary, len(header))
+	var missing = make([]string, len(header))
+	var types = make([]int, len(header))
+	var distinct = make([]map[string]bool, len(header))
+	for c, name := range header {
+		var md *api.AttributeMetadata = metadataOf(name)
+		attrs[c] = api.AttributeSummary{
+			Name:        name,
+			Term:        md.Term,
+			Unit:        md.Unit,
+			Description: md.Description,
+			Examples:    []string{},
+		}
+		missing[c] = md.Missing
+		types[c] = -1
+		distinct[c] = make(map[string]bool)
+	}
+	var nrows int
+	for _, cells := range rows[1:] {
+		nrows++
+		for c := range header {
+			var v string
+			if c < len(cells) {
+				v = strings.TrimSpace(cells[c])
+			}
+			if v == "" || (missing[c] != "" && v == missing[c]) {
+				attrs[c].Nulls++
+				continue
+			}
+			types[c] = narrowType(types[c], v)
+			if !distinct[c][v] {
+				distinct[c][v] = true
+				if len(attrs[c].Examples) < maxDictExamples {
+					attrs[c].Examples = append(attrs[c].Examples,
+						v)
+				}
+			}
+		}
+	}
+	// The range is found once the types are known, so that numbers are
+	// compared as numbers.
+	for c := range attrs {
+		attrs[c].Distinct = len(distinct[c])
+		if types[c] == -1 {
+			continue
+		}
+		attrs[c].Type = columnTypes[types[c]].name
+		var numeric bool = attrs[c].Type == columnInteger ||
+			attrs[c].Type == columnNumber
+		var less = func(a, b string) bool {
+			if numeric {
+				var x, _ = strconv.ParseFloat(a, 64)
+				var y, _ = strconv.ParseFloat(b, 64)
+				return x < y
+			}
+			return a < b
+		}
+		for v := range distinct[c] {
+			if attrs[c].Min == "" || less(v, attrs[c].Min) {
+				attrs[c].Min = v
+			}
+			if attrs[c].Max == "" || less(attrs[c].Max, v) {
+				attrs[c].Max = v
+			}
+		}
+	}
+	return attrs, nrows
+}
+
+// writeDataDict writes a data dictionary of data, the result of a query on
+// the data set path, as an HTML page, JSON, CSV, or TSV.
+func (srv *Server) writeDataDict(w http.ResponseWriter, r *http.Request,
+	thp map[string][]string, personId int64, user string, path string,
+	data string) {
+	f, err := srv.storage.LookupFileInfo(personId, path)
+	if err != nil {
+		writeStatusCode(w, r, http.StatusNotFound,
+			"Data set '"+user+"/"+path+"' not found")
+		return
+	}
+	// Converted attributes are described with their new units.
+	var units map[string]string
+	if thp["units"] != nil {
+		units, _ = thumpParseUnits(thp["units"])
+	}
+	var dict = api.DataDictionary{Dataset: user + "/" + path}
+	dict.Attributes, dict.Rows = dataDictionary(data,
+		func(attr string) *api.AttributeMetadata {
+			var md api.AttributeMetadata
+			for _, a := range f.Attributes {
+				if a.Name == attr {
+					md = a.Metadata
+				}
+			}
+			if u, ok := units[attr]; ok {
+				md.Unit = u
+			}
+			return &md
+		})
+
+	var as string
+	if thp["as"] != nil {
+		as = thp["as"][0]
+	}
+	switch {
+	case acceptsHtml(r):
+		setContentTypeTextHtml(w)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "%s", header())
+		fmt.Fprintf(w, "<h1><a href=\"/%s\">%s</a> / %s</h1>\n",
+			user, user, path)
+		fmt.Fprintf(w, "%s", htmlDataTabs(user, path, "dict"))
+		fmt.Fprintf(w, "%s", htmlDataDict(&dict))
+		fmt.Fprintf(w, "%s", footer())
+	case as == "json" || acceptsJSON(r):
+		writeJSON(w, &dict)
+	default:
+		var contentType string = "text/csv"
+		var cw *csv.Writer = csv.NewWriter(w)
+		if as == "tsv" {
+			contentType = "text/tab-separated-values"
+			cw.Comma = '\t'
+		}
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		cw.Write(dictColumns)
+		for _, a := range dict.Attributes {
+			cw.Write([]string{a.Name, a.Type, a.Term, a.Unit,
+				a.Description, strconv.Itoa(a.Nulls),
+				strconv.Itoa(a.Distinct), a.Min, a.Max,
+				strings.Join(a.Examples, "; ")})
+		}
+		cw.Flush()
+	}
+}
+
+// htmlDataTabs returns links to the views of a data set for its HTML pages,
+// marking the current view, "data" or "dict".
+func htmlDataTabs(user, path, current string) string {
+	var esc = template.HTMLEscapeString
+	var url string = "/" + user + "/" + path
+	var tabs = []struct{ name, label, href string }{
+		{"data", "Data", url},
+		{"dict", "Dictionary", url + "?dict()"},
+	}
+	var b strings.Builder
+	b.WriteString("<p class=\"tabs\">")
+	for _, t := range tabs {
+		var class string
+		if t.name == current {
+			class = " class=\"current\""
+		}
+		fmt.Fprintf(&b, "<a%s href=\"%s\">%s</a>", class, esc(t.href),
+			t.label)
+	}
+	b.WriteString("</p>\n")
+	return b.String()
+}
+
+// htmlDataDict returns a data dictionary as an HTML table.
+func htmlDataDict(dict *api.DataDictionary) string {
+	var esc = template.HTMLEscapeString
+	var b strings.Builder
+	fmt.Fprintf(&b, "<p>%d rows, %d attributes</p>\n", dict.Rows,
+		len(dict.Attributes))
+	b.WriteString("<table class=\"dict\">\n<tr>")
+	for _, col := range []string{"Attribute", "Type", "Term", "Unit",
+		"Description", "Nulls", "Distinct", "Min", "Max", "Examples"} {
+		fmt.Fprintf(&b, "<th>%s</th>", col)
+	}
+	b.WriteString("</tr>\n")
+	for _, a := range dict.Attributes {
+		var term string = esc(a.Term)
+		if a.Term != "" {
+			term = "<a href=\"/terms/" + esc(a.Term) + "\">" + term +
+				"</a>"
+		}
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%s</td>"+
+			"<td>%s</td><td>%s</td><td>%d</td><td>%d</td>"+
+			"<td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			esc(a.Name), esc(a.Type), term, esc(a.Unit),
+			esc(a.Description), a.Nulls, a.Distinct, esc(a.Min),
+			esc(a.Max), esc(strings.Join(a.Examples, "; ")))
+	}
+	b.WriteString("</table>\n")
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+func TestThumpParseDict(t *testing.T) {
+	for _, c := range []struct {
+		query string
+		want  map[string][]string
+	}{
+		{"dict()", map[string][]string{"dict": {""}}},
+		{"dict", map[string][]string{"dict": {}}},
+		{"dict()as(json)", map[string][]string{
+			"dict": {""},
+			"as":   {"json"},
+		}},
+	} {
+		if got := thumpParse(c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("thumpParse(%q) = %v, want %v", c.query, got,
+				c.want)
+		}
+	}
+}
+
+func TestDataDictionary(t *testing.T) {
+	data := "name,t\n\"Smith, J\",1.5\nJones,-99\n\"Smith, J\",10\n"
+	attrs, rows := dataDictionary(data,
+		func(attr string) *api.AttributeMetadata {
+			if attr == "t" {
+				return &api.AttributeMetadata{Unit: "Cel",
+					Missing: "-99"}
+			}
+			return &api.AttributeMetadata{}
+		})
+	if rows != 3 || len(attrs) != 2 {
+		t.Fatalf("%d rows, %d attributes", rows, len(attrs))
+	}
+	name, temp := attrs[0], attrs[1]
+	if name.Type != columnString || name.Distinct != 2 ||
+		name.Min != "Jones" || name.Max != "Smith, J" {
+		t.Errorf("name: %+v", name)
+	}
+	if temp.Type != columnNumber || temp.Nulls != 1 ||
+		temp.Unit != "Cel" || temp.Min != "1.5" || temp.Max != "10" {
+		t.Errorf("t: %+v", temp)
+	}
+}
+
+func TestDataDictionaryEmpty(t *testing.T) {
+	for _, data := range []string{"", "a,b\n"} {
+		attrs, rows := dataDictionary(data,
+			func(attr string) *api.AttributeMetadata {
+				return &api.AttributeMetadata{}
+			})
+		if rows != 0 {
+			t.Errorf("%q: %d rows", data, rows)
+		}
+		for _, a := range attrs {
+			if a.Type != "" || a.Distinct != 0 || a.Min != "" {
+				t.Errorf("%q: %+v", data, a)
+			}
+		}
+	}
+}
+
+// dictStorage returns the attribute metadata of one data set.
+type dictStorage struct {
+	Storage
+	file *FileInfo
+}
+
+func (s *dictStorage) LookupFileInfo(personId int64, path string) (
+	*FileInfo, error) {
+	return s.file, nil
+}
+
+func TestWriteDataDict(t *testing.T) {
+	srv := &Server{storage: &dictStorage{file: &FileInfo{
+		User: "izzy",
+		Path: "ocean",
+		Attributes: []AttributeInfo{
+			{Name: "site"},
+			{Name: "t", Metadata: api.AttributeMetadata{
+				Term:        "cf:sea_water_temperature",
+				Unit:        "Cel",
+				Description: "Water temperature",
+			}},
+			{Name: "p", Metadata: api.AttributeMetadata{
+				Unit: "hPa",
+			}},
+		},
+	}}}
+	data := "site,t,p\nA,283.15,100\nB,,101.3\n"
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		// Attributes without metadata have empty columns.
+		{"dict()", []string{
+			strings.Join(dictColumns, ","),
+			"site,string,,,,0,2,A,B,A; B",
+			"t,number,cf:sea_water_temperature,Cel," +
+				"Water temperature,1,1,283.15,283.15,283.15",
+			"p,number,,hPa,,0,2,100,101.3,100; 101.3",
+		}},
+		// Converted attributes are described with their new units.
+		{"dict()units(t:K,p:kPa)", []string{
+			strings.Join(dictColumns, ","),
+			"site,string,,,,0,2,A,B,A; B",
+			"t,number,cf:sea_water_temperature,K," +
+				"Water temperature,1,1,283.15,283.15,283.15",
+			"p,number,,kPa,,0,2,100,101.3,100; 101.3",
+		}},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/izzy/ocean?"+c.query, nil)
+		srv.writeDataDict(w, r, thumpParse(c.query), 1, "izzy",
+			"ocean", data)
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct,
+			"text/csv") {
+			t.Errorf("%s: Content-Type %q", c.query, ct)
+		}
+		got := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", c.query, got, c.want)
+		}
+	}
+}
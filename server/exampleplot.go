@@ -1,7 +1,6 @@
 package server
 
 import (
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"html/template"
@@ -29,17 +28,12 @@ func handlePlotForm(w http.ResponseWriter, r *http.Request) {
 
 func retrieveData(dataurl string) (string, error) {
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-	//client := &http.Client{}
 	httpreq, err := http.NewRequest(http.MethodGet, addMdCmd(dataurl), nil)
 	if err != nil {
 		return "", err
 	}
 
-	httpresp, err := client.Do(httpreq)
+	httpresp, err := fetchClient.Do(httpreq)
 	if err != nil {
 		return "", err
 	}
@@ -60,8 +54,8 @@ func retrieveData(dataurl string) (string, error) {
 
 func findTimeColumn(header []string) (int, error) {
 	for x := range header {
-		if strings.Contains(header[x], "{dc:date}") ||
-			strings.Contains(header[x], "{yamz:h1317}") {
+		_, md := parseHeaderMetadata(header[x])
+		if md.Term == "dc:date" || md.Term == "yamz:h1317" {
 			return x, nil
 		}
 	}
@@ -101,8 +95,14 @@ func makeSeries(dataurl string) []chart.Series {
 
 	var series []chart.Series
 
-	datarows := strings.Split(rawdata, "\n")
-	header := strings.Split(datarows[0], ",")
+	datarows, err := readCSV(rawdata)
+	if err != nil {
+		log.Print(err)
+	}
+	if len(datarows) == 0 {
+		return nil
+	}
+	header := datarows[0]
 
 	timeIndex, err := findTimeColumn(header)
 	if err != nil {
@@ -120,7 +120,7 @@ func makeSeries(dataurl string) []chart.Series {
 		if r == 0 {
 			continue
 		}
-		row := strings.Split(datarows[r], ",")
+		row := datarows[r]
 		for c := range row {
 			d[c][r-1] = row[c]
 		}
@@ -130,11 +130,7 @@ func makeSeries(dataurl string) []chart.Series {
 		if c == timeIndex {
 			continue
 		}
-		h := header[c]
-		x := strings.IndexRune(h, '{')
-		if x >= 0 {
-			h = h[0:x]
-		}
+		h, _ := parseHeaderMetadata(header[c])
 
 		series = append(series,
 			chart.TimeSeries{
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// fetchTimeout limits requests that the server makes to other servers.
+const fetchTimeout = 60 * time.Second
+
+// fetchClient is the HTTP client used by services such as the time series
+// plot to retrieve data from URLs.  It verifies server certificates.
+var fetchClient = &http.Client{Timeout: fetchTimeout}
+
+// newFetchClient returns an HTTP client that trusts the certificate
+// authorities in caCertFile in addition to the system's authorities.
+func newFetchClient(caCertFile string) (*http.Client, error) {
+	var pool, err = x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	var pem []byte
+	pem, err = ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in %s", caCertFile)
+	}
+	var transport = http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Timeout: fetchTimeout, Transport: transport}, nil
+}
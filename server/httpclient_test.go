@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewFetchClient(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	cacert := filepath.Join(t.TempDir(), "ca.pem")
+	err := ioutil.WriteFile(cacert, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newFetchClient(cacert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if tr := c.Transport.(*http.Transport); tr.Proxy == nil ||
+		tr.IdleConnTimeout == 0 {
+		t.Errorf("default transport settings not kept")
+	}
+	if _, err = newFetchClient(filepath.Join(t.TempDir(), "x")); err == nil {
+		t.Errorf("missing file: no error")
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// authRealm is the realm sent in authentication challenges.
+const authRealm = "Glint"
+
+// writeError writes an error response with a JSON body describing the error,
+// and logs the message.
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	log.Println(message)
+	var resp = api.ErrorResponse{
+		Status:  statusCode,
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// acceptsBearer returns true if any configured authentication provider
+// accepts bearer tokens, which is normally the case because the server
+// issues session tokens.
+func (srv *Server) acceptsBearer() bool {
+	for _, a := range srv.authenticators {
+		if _, ok := a.(TokenAuthenticator); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeUnauthorized writes a 401 response with a challenge for each
+// authentication scheme the server accepts.  If a bearer token was presented
+// and rejected, the Bearer challenge says so as described in RFC 6750.
+func (srv *Server) writeUnauthorized(w http.ResponseWriter, message string,
+	invalidToken bool) {
+	w.Header().Add("WWW-Authenticate",
+		`Basic realm="`+authRealm+`", charset="UTF-8"`)
+	if srv.acceptsBearer() {
+		var c = `Bearer realm="` + authRealm + `"`
+		if invalidToken {
+			c += `, error="invalid_token"`
+		}
+		w.Header().Add("WWW-Authenticate", c)
+	}
+	writeError(w, http.StatusUnauthorized, message)
+}
+
+// writeMethodNotAllowed writes a 405 response listing the allowed methods.
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request,
+	allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed, "HTTP method "+r.Method+
+		" is not supported by this URL")
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// disabledStorage reports every account as disabled.
+type disabledStorage struct {
+	*sessionStorage
+}
+
+func (s *disabledStorage) LookupAccountDisabled(username string) (bool,
+	error) {
+	return true, nil
+}
+
+// checkErrorBody checks that a response has a JSON error body with the
+// status code of the response.
+func checkErrorBody(t *testing.T, name string, w *httptest.ResponseRecorder) {
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s: Content-Type %q", name, ct)
+	}
+	var resp api.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Errorf("%s: %v: %s", name, err, w.Body.String())
+		return
+	}
+	if resp.Status != w.Code || resp.Error != http.StatusText(w.Code) ||
+		resp.Message == "" {
+		t.Errorf("%s: error body %+v", name, resp)
+	}
+}
+
+func TestAuthenticationChallenges(t *testing.T) {
+	srv, _, token := newSessionServer(t)
+	basic := `Basic realm="Glint", charset="UTF-8"`
+	bearer := `Bearer realm="Glint"`
+	for _, c := range []struct {
+		name       string
+		user, pass string
+		bearer     string
+		owner      string
+		code       int
+		challenges []string
+	}{
+		{"no credentials", "", "", "", "alice",
+			http.StatusUnauthorized, []string{basic, bearer}},
+		{"wrong password", "alice", "wrong", "", "alice",
+			http.StatusUnauthorized, []string{basic, bearer}},
+		{"unknown user", "mallory", "secret", "", "alice",
+			http.StatusUnauthorized, []string{basic, bearer}},
+		{"invalid token", "", "", "expired", "alice",
+			http.StatusUnauthorized, []string{basic,
+				bearer + `, error="invalid_token"`}},
+		// Authenticated users who may not modify the data are
+		// forbidden, and are not asked to authenticate again.
+		{"other user", "alice", "secret", "", "bob",
+			http.StatusForbidden, nil},
+		{"other user with token", "", "", token, "bob",
+			http.StatusForbidden, nil},
+		{"password", "alice", "secret", "", "alice", http.StatusOK, nil},
+		{"token", "", "", token, "alice", http.StatusOK, nil},
+	} {
+		r := httptest.NewRequest("POST", "/"+c.owner+"/ocean", nil)
+		if c.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+c.bearer)
+		} else if c.user != "" {
+			r.SetBasicAuth(c.user, c.pass)
+		}
+		w := httptest.NewRecorder()
+		if _, ok := srv.requireUser(w, r, c.owner); ok {
+			w.WriteHeader(http.StatusOK)
+		}
+		if w.Code != c.code {
+			t.Errorf("%s: status %d, want %d", c.name, w.Code, c.code)
+		}
+		got := w.Header()["Www-Authenticate"]
+		if !reflect.DeepEqual(got, c.challenges) {
+			t.Errorf("%s: challenges %q, want %q", c.name, got,
+				c.challenges)
+		}
+		if c.code != http.StatusOK {
+			checkErrorBody(t, c.name, w)
+		}
+	}
+}
+
+func TestAuthenticationChallengesWithoutTokens(t *testing.T) {
+	srv, st, _ := newSessionServer(t)
+	srv.authenticators = []Authenticator{&passwordAuthenticator{storage: st}}
+	r := httptest.NewRequest("POST", "/login", nil)
+	w := httptest.NewRecorder()
+	srv.handleLogin(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want 401", w.Code)
+	}
+	want := []string{`Basic realm="Glint", charset="UTF-8"`}
+	if got := w.Header()["Www-Authenticate"]; !reflect.DeepEqual(got,
+		want) {
+		t.Errorf("challenges %q, want %q", got, want)
+	}
+	checkErrorBody(t, "login", w)
+}
+
+func TestAuthenticationDisabledAccount(t *testing.T) {
+	srv, st, _ := newSessionServer(t)
+	srv.storage = &disabledStorage{st}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("alice", "secret")
+	w := httptest.NewRecorder()
+	if _, ok := srv.handleBasicAuth(w, r); ok {
+		t.Fatal("disabled account authenticated")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status %d, want 403", w.Code)
+	}
+	if got := w.Header()["Www-Authenticate"]; got != nil {
+		t.Errorf("challenges %q", got)
+	}
+	checkErrorBody(t, "disabled", w)
+}
+
+func TestWriteMethodNotAllowed(t *testing.T) {
+	srv, _, _ := newSessionServer(t)
+	r := httptest.NewRequest("GET", "/login", nil)
+	w := httptest.NewRecorder()
+	srv.handleLogin(w, r)
+	if w.Code != http.StatusMethodNotAllowed ||
+		w.Header().Get("Allow") != "POST" {
+		t.Errorf("status %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+	checkErrorBody(t, "method", w)
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// FileInfo contains statistics about a stored data set.
+type FileInfo struct {
+	Id         int64
+	User       string
+	Path       string
+	Size       int64
+	Rows       int64
+	Modified   time.Time
+	Hash       string
+	Metadata   *api.DatasetMetadata
+	Ark        string
+	Attributes []AttributeInfo
+}
+
+// AttributeInfo describes an attribute (column) of a data set.
+type AttributeInfo struct {
+	Name     string
+	Metadata api.AttributeMetadata
+}
+
+// Column types reported by inferTypes.
+const (
+	columnInteger  = "integer"
+	columnNumber   = "number"
+	columnBoolean  = "boolean"
+	columnDate     = "date"
+	columnDateTime = "datetime"
+	columnString   = "string"
+)
+
+// columnTypes lists the column types from most to least specific, with a
+// function that reports whether a value can have each type.
+var columnTypes = []struct {
+	name  string
+	match func(string) bool
+}{
+	{columnInteger, func(v string) bool {
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	}},
+	{columnNumber, func(v string) bool {
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	}},
+	{columnBoolean, func(v string) bool {
+		switch strings.ToLower(v) {
+		case "true", "false":
+			return true
+		}
+		return false
+	}},
+	{columnDate, func(v string) bool {
+		_, err := time.Parse("2006-01-02", v)
+		return err == nil
+	}},
+	{columnDateTime, func(v string) bool {
+		for _, layout := range []string{time.RFC3339,
+			"2006-01-02 15:04:05", "2006-01-02T15:04:05",
+			"2006-01-02 15:04"} {
+			if _, err := time.Parse(layout, v); err == nil {
+				return true
+			}
+		}
+		return false
+	}},
+	{columnString, func(v string) bool { return true }},
+}
+
+// inferTypes returns the most specific type that fits all non-empty values
+// of each column in data.  A column with no values has an empty type.
+func inferTypes(data string) []string {
+	var rows, err = readCSV(data)
+	if err != nil || len(rows) == 0 {
+		return nil
+	}
+	var ncols int = len(rows[0])
+	// candidate[c] is the index in columnTypes of the most specific type
+	// still possible for column c, or -1 if no values have been seen.
+	var candidate = make([]int, ncols)
+	var x int
+	for x = range candidate {
+		candidate[x] = -1
+	}
+	for _, cells := range rows[1:] {
+		var c int
+		for c = 0; c < ncols && c < len(cells); c++ {
+			var v string = strings.TrimSpace(cells[c])
+			if v == "" {
+				continue
+			}
+			candidate[c] = narrowType(candidate[c], v)
+		}
+	}
+	var types = make([]string, ncols)
+	for x = range candidate {
+		if candidate[x] != -1 {
+			types[x] = columnTypes[candidate[x]].name
+		}
+	}
+	return types
+}
+
+// countRows returns the number of rows of data, not counting the header.
+// Quoted values may contain newlines.
+func countRows(data string) int64 {
+	var r = csv.NewReader(strings.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = true
+	var n int64 = -1
+	for {
+		if _, err := r.Read(); err != nil {
+			break
+		}
+		n++
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// narrowType returns the index in columnTypes of the most specific type
+// that fits both v and the values that fit columnTypes[t].  If t is -1, no
+// other values have been seen.
+func narrowType(t int, v string) int {
+	if t == -1 {
+		t = 0
+	}
+	for !columnTypes[t].match(v) {
+		t++
+	}
+	return t
+}
+
+// acceptsJSON returns true if the client lists application/json in the
+// Accept header.
+func acceptsJSON(r *http.Request) bool {
+	for _, a := range r.Header["Accept"] {
+		for _, b := range strings.Split(a, ",") {
+			b = strings.TrimSpace(strings.SplitN(b, ";", 2)[0])
+			if b == "application/json" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func datasetInfo(user string, f *FileInfo) api.DatasetInfo {
+	var info = api.DatasetInfo{
+		Name:     f.Path,
+		Url:      joinURLPath(glintbaseurl, user+"/"+f.Path),
+		Size:     f.Size,
+		Rows:     f.Rows,
+		Columns:  []api.ColumnInfo{},
+		Modified: f.Modified,
+	}
+	if f.Hash != "" {
+		info.Hash = "sha256:" + f.Hash
+	}
+	info.Metadata = f.Metadata
+	info.Ark = f.Ark
+	for x := range f.Attributes {
+		var col = api.ColumnInfo{Name: f.Attributes[x].Name}
+		if f.Attributes[x].Metadata != (api.AttributeMetadata{}) {
+			col.Metadata = &f.Attributes[x].Metadata
+		}
+		info.Columns = append(info.Columns, col)
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	respbody, err := json.Marshal(v)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respbody)
+}
+
+// writeDataList writes a JSON listing of a user's data sets.
+func (srv *Server) writeDataList(w http.ResponseWriter, r *http.Request,
+	user string, personId int64) {
+	files, err := srv.storage.LookupFileInfoList(personId)
+	if err != nil {
+		writeStatusCode(w, r, http.StatusInternalServerError,
+			"Unable to list data sets: "+err.Error())
+		return
+	}
+	var list = api.DatasetList{
+		User:     user,
+		Datasets: []api.DatasetInfo{},
+	}
+	for x := range files {
+		list.Datasets = append(list.Datasets,
+			datasetInfo(user, &files[x]))
+	}
+	writeJSON(w, list)
+}
+
+// writeDataInfo writes a JSON description of a data set, including the
+// inferred type of each column.
+func (srv *Server) writeDataInfo(w http.ResponseWriter, r *http.Request,
+	user string, personId int64, path string) {
+	f, err := srv.storage.LookupFileInfo(personId, path)
+	if err != nil {
+		writeStatusCode(w, r, http.StatusNotFound,
+			"Data set '"+user+"/"+path+"' not found")
+		return
+	}
+	data, err := srv.storage.LookupData(personId, path)
+	if err != nil {
+		writeStatusCode(w, r, http.StatusInternalServerError,
+			"Unable to read data set: "+err.Error())
+		return
+	}
+	var info = datasetInfo(user, f)
+	info.DerivedFrom = srv.lookupDerivation(personId, f)
+	var types []string = inferTypes(data)
+	for x := range info.Columns {
+		if x < len(types) {
+			info.Columns[x].Type = types[x]
+		}
+	}
+	writeJSON(w, info)
+}
+
+// checkETag sets the ETag header for a data set, and writes 304 Not
+// Modified and returns false if it matches If-None-Match.  The ETag is weak
+// because it is the hash of the source file rather than of the response.
+func (srv *Server) checkETag(w http.ResponseWriter, r *http.Request,
+	personId int64, path string) bool {
+	f, err := srv.storage.LookupFileInfo(personId, path)
+	if err != nil || f.Hash == "" {
+		return true
+	}
+	var etag = "W/\"" + f.Hash + "\""
+	w.Header().Set("ETag", etag)
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		t = strings.TrimSpace(t)
+		if t == etag || t == "\""+f.Hash+"\"" || t == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return false
+		}
+	}
+	return true
+}
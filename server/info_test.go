@@ -0,0 +1,34 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInferTypes(t *testing.T) {
+	data := "id,name,t,when,ok,empty\n" +
+		"1,\"Smith, J\",1.5,2018-06-01,true,\n" +
+		"2,Jones,-3,2018-06-02,false,\n"
+	want := []string{columnInteger, columnString, columnNumber,
+		columnDate, columnBoolean, ""}
+	if got := inferTypes(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCountRows(t *testing.T) {
+	for _, c := range []struct {
+		data string
+		n    int64
+	}{
+		{"", 0},
+		{"a,b\n", 0},
+		{"a,b\n1,2\n3,4\n", 2},
+		{"a,b\n1,2\n3,4", 2},
+		{"a,b\n\"x\ny\",2\n\n3,4\n", 2},
+	} {
+		if n := countRows(c.data); n != c.n {
+			t.Errorf("%q: %d rows, want %d", c.data, n, c.n)
+		}
+	}
+}
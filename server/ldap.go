@@ -0,0 +1,268 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ldapTimeout limits the time spent connecting to and waiting for a response
+// from the directory server.
+const ldapTimeout = 10 * time.Second
+
+// ldapMaxMessage is the largest BER element accepted from the directory
+// server.  A bind response is normally a few dozen bytes.
+const ldapMaxMessage = 64 * 1024
+
+// LDAP result codes used by the bind operation (RFC 4511).
+const (
+	ldapResultSuccess            = 0
+	ldapResultInvalidCredentials = 49
+)
+
+// ldapAuthenticator authenticates users with an LDAP simple bind.  bindDN is
+// a template for the user's distinguished name in which "%s" is replaced by
+// the escaped username, e.g. "uid=%s,ou=people,dc=example,dc=org".
+type ldapAuthenticator struct {
+	url    string
+	bindDN string
+}
+
+func (a *ldapAuthenticator) Name() string {
+	return "ldap"
+}
+
+func (a *ldapAuthenticator) Authenticate(username, password string) (
+	Identity, bool, error) {
+
+	// An empty password would be treated by the directory server as an
+	// unauthenticated bind, which succeeds.
+	if username == "" || password == "" {
+		return Identity{}, false, nil
+	}
+	var conn, err = ldapDial(a.url)
+	if err != nil {
+		return Identity{}, false, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ldapTimeout))
+
+	var dn = strings.Replace(a.bindDN, "%s", ldapEscapeDN(username), -1)
+	if _, err = conn.Write(ldapBindRequest(1, dn, password)); err != nil {
+		return Identity{}, false, err
+	}
+	var code int
+	var msg string
+	code, msg, err = ldapReadBindResponse(bufio.NewReader(conn))
+	if err != nil {
+		return Identity{}, false, err
+	}
+	// Unbind politely; the result does not matter.
+	conn.Write(ldapUnbindRequest(2))
+
+	switch code {
+	case ldapResultSuccess:
+		return Identity{Username: username, Subject: dn}, true, nil
+	case ldapResultInvalidCredentials:
+		return Identity{}, false, nil
+	default:
+		return Identity{}, false, fmt.Errorf(
+			"LDAP bind failed with result code %d: %s", code, msg)
+	}
+}
+
+// ldapDial connects to the server specified by an ldap:// or ldaps:// URL.
+func ldapDial(rawurl string) (net.Conn, error) {
+	var u, err = url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	var host = u.Host
+	var dialer = &net.Dialer{Timeout: ldapTimeout}
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		return dialer.Dial("tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		return tls.DialWithDialer(dialer, "tcp", host,
+			&tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("Unsupported LDAP URL scheme: %s",
+			u.Scheme)
+	}
+}
+
+// ldapEscapeDN escapes a value for use in a distinguished name (RFC 4514).
+func ldapEscapeDN(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case strings.ContainsRune(",+\"\\<>;=", r):
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == ' ' && (i == 0 || i == len(s)-1):
+			b.WriteString("\\ ")
+		case r == '#' && i == 0:
+			b.WriteString("\\#")
+		case r < 0x20:
+			fmt.Fprintf(&b, "\\%02x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// The functions below implement just enough of the BER encoding (X.690) to
+// send a simple bind request and read the response.
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var l []byte
+	for ; n > 0; n >>= 8 {
+		l = append([]byte{byte(n)}, l...)
+	}
+	return append([]byte{0x80 | byte(len(l))}, l...)
+}
+
+func berTLV(tag byte, content []byte) []byte {
+	var b = append([]byte{tag}, berLength(len(content))...)
+	return append(b, content...)
+}
+
+func berInteger(tag byte, n int) []byte {
+	var c []byte
+	for {
+		c = append([]byte{byte(n)}, c...)
+		n >>= 8
+		if n == 0 && c[0] < 0x80 {
+			break
+		}
+	}
+	return berTLV(tag, c)
+}
+
+func ldapMessage(id int, op []byte) []byte {
+	return berTLV(0x30, append(berInteger(0x02, id), op...))
+}
+
+func ldapBindRequest(id int, dn, password string) []byte {
+	var req []byte
+	req = append(req, berInteger(0x02, 3)...)
+	req = append(req, berTLV(0x04, []byte(dn))...)
+	req = append(req, berTLV(0x80, []byte(password))...)
+	return ldapMessage(id, berTLV(0x60, req))
+}
+
+func ldapUnbindRequest(id int) []byte {
+	return ldapMessage(id, []byte{0x42, 0x00})
+}
+
+// berRead reads one BER element, returning its tag and content.
+func berRead(r io.ByteReader) (byte, []byte, error) {
+	var tag, err = r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var l byte
+	l, err = r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n = int(l)
+	if l&0x80 != 0 {
+		if l&0x7f > 4 {
+			return 0, nil, errors.New("BER length too long")
+		}
+		n = 0
+		for i := 0; i < int(l&0x7f); i++ {
+			var b byte
+			if b, err = r.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	if n > ldapMaxMessage {
+		return 0, nil, fmt.Errorf("BER element too long: %d bytes", n)
+	}
+	var content = make([]byte, n)
+	for i := range content {
+		if content[i], err = r.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+	}
+	return tag, content, nil
+}
+
+type berBuffer struct {
+	b []byte
+}
+
+func (bb *berBuffer) ReadByte() (byte, error) {
+	if len(bb.b) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var c = bb.b[0]
+	bb.b = bb.b[1:]
+	return c, nil
+}
+
+func berInt(content []byte) int {
+	var n = 0
+	for _, c := range content {
+		n = n<<8 | int(c)
+	}
+	return n
+}
+
+// ldapReadBindResponse reads a BindResponse and returns its result code and
+// diagnostic message.
+func ldapReadBindResponse(r io.ByteReader) (int, string, error) {
+	var tag, msg, err = berRead(r)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != 0x30 {
+		return 0, "", errors.New("Malformed LDAP message")
+	}
+	var m = &berBuffer{b: msg}
+	if _, _, err = berRead(m); err != nil { // messageID
+		return 0, "", err
+	}
+	var op []byte
+	tag, op, err = berRead(m)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != 0x61 {
+		return 0, "", fmt.Errorf("Unexpected LDAP response: 0x%02x", tag)
+	}
+	var o = &berBuffer{b: op}
+	var code, diag []byte
+	_, code, err = berRead(o)
+	if err != nil {
+		return 0, "", err
+	}
+	if _, _, err = berRead(o); err != nil { // matchedDN
+		return 0, "", err
+	}
+	_, diag, err = berRead(o)
+	if err != nil {
+		return 0, "", err
+	}
+	return berInt(code), string(diag), nil
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestBerRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 255, 256, 65000} {
+		content := bytes.Repeat([]byte{'x'}, n)
+		tag, got, err := berRead(bufio.NewReader(bytes.NewReader(
+			berTLV(0x04, content))))
+		if err != nil {
+			t.Fatalf("length %d: %v", n, err)
+		}
+		if tag != 0x04 || !bytes.Equal(got, content) {
+			t.Errorf("length %d: read tag 0x%02x, %d bytes", n, tag,
+				len(got))
+		}
+	}
+	for _, n := range []int{0, 1, 127, 128, 255, 256, 65535, 1 << 20} {
+		_, c, err := berRead(&berBuffer{b: berInteger(0x02, n)})
+		if err != nil {
+			t.Fatalf("integer %d: %v", n, err)
+		}
+		if berInt(c) != n {
+			t.Errorf("integer %d: read %d", n, berInt(c))
+		}
+	}
+}
+
+func TestBerReadLimits(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x30, 0x84, 0xff, 0xff, 0xff, 0xff},
+		{0x30, 0x83, 0x10, 0x00, 0x00},
+		{0x30, 0x85, 0x01, 0x00, 0x00, 0x00, 0x00},
+		{0x30, 0x05, 0x01},
+		{0x30},
+	} {
+		if _, _, err := berRead(&berBuffer{b: b}); err == nil {
+			t.Errorf("% x: no error", b)
+		}
+	}
+}
+
+func TestLDAPEscapeDN(t *testing.T) {
+	for _, c := range []struct{ in, out string }{
+		{"alice", "alice"},
+		{"a,b", `a\,b`},
+		{"#x", `\#x`},
+		{" x ", `\ x\ `},
+		{`a+b=c"d\e<f>g;`, `a\+b\=c\"d\\e\<f\>g\;`},
+		{"a\x00b", `a\00b`},
+	} {
+		if got := ldapEscapeDN(c.in); got != c.out {
+			t.Errorf("ldapEscapeDN(%q) = %q, want %q", c.in, got,
+				c.out)
+		}
+	}
+}
+
+// ldapResponder is an in-process directory server that answers simple bind
+// requests, accepting the passwords in passwords, keyed by DN.
+func ldapResponder(t *testing.T, passwords map[string]string,
+	respond func(id int, code int) []byte) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				tag, msg, err := berRead(bufio.NewReader(conn))
+				if err != nil || tag != 0x30 {
+					return
+				}
+				m := &berBuffer{b: msg}
+				_, id, _ := berRead(m)
+				_, op, _ := berRead(m)
+				o := &berBuffer{b: op}
+				berRead(o) // version
+				_, dn, _ := berRead(o)
+				_, password, _ := berRead(o)
+				code := ldapResultInvalidCredentials
+				if p, ok := passwords[string(dn)]; ok &&
+					p == string(password) {
+					code = ldapResultSuccess
+				}
+				conn.Write(respond(berInt(id), code))
+			}(conn)
+		}
+	}()
+	return "ldap://" + ln.Addr().String()
+}
+
+func ldapBindResponse(id int, code int) []byte {
+	var op []byte
+	op = append(op, berInteger(0x0a, code)...)
+	op = append(op, berTLV(0x04, nil)...)
+	op = append(op, berTLV(0x04, []byte("diagnostic"))...)
+	return ldapMessage(id, berTLV(0x61, op))
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	url := ldapResponder(t, map[string]string{
+		"uid=alice,ou=people,dc=example,dc=org": "secret",
+		`uid=a\,b,ou=people,dc=example,dc=org`:  "comma",
+	}, ldapBindResponse)
+	a := &ldapAuthenticator{
+		url:    url,
+		bindDN: "uid=%s,ou=people,dc=example,dc=org",
+	}
+	for _, c := range []struct {
+		username, password string
+		ok                 bool
+		subject            string
+	}{
+		{"alice", "secret", true,
+			"uid=alice,ou=people,dc=example,dc=org"},
+		{"alice", "wrong", false, ""},
+		{"alice", "", false, ""},
+		{"a,b", "comma", true, `uid=a\,b,ou=people,dc=example,dc=org`},
+		{"alice,ou=people,dc=example,dc=org", "secret", false, ""},
+	} {
+		id, ok, err := a.Authenticate(c.username, c.password)
+		if err != nil {
+			t.Fatalf("%s: %v", c.username, err)
+		}
+		if ok != c.ok || id.Subject != c.subject {
+			t.Errorf("%s/%s: ok = %v, subject = %q", c.username,
+				c.password, ok, id.Subject)
+		}
+		if ok && id.Username != c.username {
+			t.Errorf("%s: username = %q", c.username, id.Username)
+		}
+	}
+}
+
+func TestLDAPAuthenticateHostileServer(t *testing.T) {
+	url := ldapResponder(t, nil, func(id int, code int) []byte {
+		return []byte{0x30, 0x84, 0xff, 0xff, 0xff, 0xff}
+	})
+	a := &ldapAuthenticator{url: url, bindDN: "uid=%s"}
+	_, ok, err := a.Authenticate("alice", "secret")
+	if err == nil || ok {
+		t.Fatalf("ok = %v, err = %v", ok, err)
+	}
+	if !strings.Contains(err.Error(), "too long") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -3,23 +3,22 @@ package server
 import (
 	"encoding/json"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"strings"
 
 	"github.com/glintdb/glintweb/api"
 )
 
 func (srv *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		var m = "HTTP method " + r.Method +
-			" is not supported by this URL"
-		http.Error(w, m, http.StatusMethodNotAllowed)
-		log.Println(m)
+		writeMethodNotAllowed(w, r, "POST")
 		return
 	}
-	// Authenticate user.
+	// Authenticate user.  A session token cannot be used to obtain
+	// another, or sessions would never expire.
+	var user string
 	var ok bool
-	_, ok = srv.handleBasicAuth(w, r)
+	user, ok = srv.authenticateRequest(w, r, false)
 	if !ok {
 		return
 	}
@@ -37,16 +36,50 @@ func (srv *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		handleError(w, err, http.StatusBadRequest)
 		return
 	}
-	// Write the json response.
+	// Issue a session token.
 	var resp api.LoginResponse
-	resp.SessionId = "0"
+	resp.SessionId, resp.Expires, err = newSessionToken(srv.storage, user)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	// Write the json response.
 	var respbody []byte
 	respbody, err = json.Marshal(resp)
 	if err != nil {
-		// TODO Handle error.
+		handleError(w, err, http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	w.Write(respbody)
 }
+
+// handleLogout revokes the session token used to authenticate the request.
+func (srv *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+	var auth = r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		writeError(w, http.StatusBadRequest,
+			"Logging out requires a session token")
+		return
+	}
+	// Authenticate user.
+	var ok bool
+	_, ok = srv.handleBasicAuth(w, r)
+	if !ok {
+		return
+	}
+	// Revoke the session.
+	var err error
+	err = srv.storage.DeleteSession(hashToken(
+		strings.TrimSpace(auth[len("Bearer "):])))
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
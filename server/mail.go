@@ -0,0 +1,55 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MailSender delivers email messages to users.
+type MailSender interface {
+	Send(to string, subject string, body string) error
+}
+
+// FileMailSender is a MailSender that writes each message as a file in Dir,
+// for delivery by a local mail system or for inspection by an administrator.
+type FileMailSender struct {
+	// Dir is the directory that messages are written to.
+	Dir string
+
+	// From is the address that messages are sent from.
+	From string
+}
+
+// Send writes a message to a new file in the drop directory.  The file is
+// written under a temporary name and renamed once complete, so that a
+// process watching the directory never sees a partial message.
+func (m *FileMailSender) Send(to string, subject string, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("Invalid mail header")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&b, "\r\n")
+	b.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	var r [8]byte
+	if _, err := rand.Read(r[:]); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"),
+		hex.EncodeToString(r[:]))
+	tmp := filepath.Join(m.Dir, "."+name)
+	if err := os.WriteFile(tmp, []byte(b.String()), fileModeRW); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.Dir, name))
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// metadataKeys lists the keys of attribute metadata in the order in which
+// they are rendered.
+var metadataKeys = []string{
+	"term", "label", "description", "unit", "datatype", "missing",
+}
+
+// metadataField returns a pointer to the field of md named by key, or nil if
+// the key is not known.
+func metadataField(md *api.AttributeMetadata, key string) *string {
+	switch key {
+	case "term":
+		return &md.Term
+	case "label":
+		return &md.Label
+	case "description":
+		return &md.Description
+	case "unit":
+		return &md.Unit
+	case "datatype":
+		return &md.Datatype
+	case "missing":
+		return &md.Missing
+	}
+	return nil
+}
+
+// setMetadata changes the fields of md named by the keys of set.  An empty
+// value removes a field.
+func setMetadata(md *api.AttributeMetadata, set map[string]string) error {
+	for k, v := range set {
+		var f *string = metadataField(md, k)
+		if f == nil {
+			return fmt.Errorf("Unknown metadata key: %s", k)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("Metadata value for '%s' contains a "+
+				"line break", k)
+		}
+		if k == "datatype" && v != "" && !validColumnType(v) {
+			return fmt.Errorf("Unknown datatype: %s", v)
+		}
+		if k == "unit" && strings.TrimSpace(v) != "" {
+			if _, err := parseUnit(strings.TrimSpace(v)); err != nil {
+				return fmt.Errorf("%s (units are written in UCUM, "+
+					"e.g. Cel or hPa)", err)
+			}
+		}
+		*f = strings.TrimSpace(v)
+	}
+	return nil
+}
+
+func validColumnType(name string) bool {
+	for _, t := range columnTypes {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeMetadata reads attribute metadata as stored in the database.
+// Metadata were originally stored as a single term, which is still
+// accepted.
+func decodeMetadata(s string) api.AttributeMetadata {
+	var md api.AttributeMetadata
+	if s == "" {
+		return md
+	}
+	if strings.HasPrefix(s, "{") && json.Unmarshal([]byte(s), &md) == nil {
+		return md
+	}
+	return api.AttributeMetadata{Term: s}
+}
+
+// encodeMetadata returns attribute metadata in the form stored in the
+// database, which is "" if there are none.
+func encodeMetadata(md *api.AttributeMetadata) (string, error) {
+	if *md == (api.AttributeMetadata{}) {
+		return "", nil
+	}
+	b, err := json.Marshal(md)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// headerEscaper escapes characters that would end a metadata field or
+// cell in a CSV header.
+var headerEscaper = strings.NewReplacer(
+	"%", "%25", ",", "%2C", ";", "%3B", "=", "%3D", "{", "%7B", "}", "%7D",
+	"\"", "%22")
+
+// formatHeaderMetadata returns attribute metadata in the form appended to
+// a column name in a CSV header by md(), e.g. "{dc:date}" or
+// "{yamz:h1295;unit=Cel;label=Air temperature}".  The term comes first
+// without a key, so that a column having only a term is written as it
+// always has been.
+func formatHeaderMetadata(md *api.AttributeMetadata) string {
+	if *md == (api.AttributeMetadata{}) {
+		return ""
+	}
+	var fields []string
+	fields = append(fields, headerEscaper.Replace(md.Term))
+	for _, k := range metadataKeys[1:] {
+		var v string = *metadataField(md, k)
+		if v != "" {
+			fields = append(fields, k+"="+headerEscaper.Replace(v))
+		}
+	}
+	return "{" + strings.Join(fields, ";") + "}"
+}
+
+// headerUnescaper reverses headerEscaper.
+var headerUnescaper = strings.NewReplacer(
+	"%25", "%", "%2C", ",", "%3B", ";", "%3D", "=", "%7B", "{", "%7D", "}",
+	"%22", "\"")
+
+// parseHeaderMetadata splits a column of a CSV header written with md()
+// into the column name and its metadata.
+func parseHeaderMetadata(h string) (string, api.AttributeMetadata) {
+	var md api.AttributeMetadata
+	var x int = strings.IndexByte(h, '{')
+	if x < 0 || !strings.HasSuffix(h, "}") {
+		return h, md
+	}
+	var fields []string = strings.Split(h[x+1:len(h)-1], ";")
+	md.Term = headerUnescaper.Replace(fields[0])
+	for _, f := range fields[1:] {
+		var kv []string = strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if p := metadataField(&md, kv[0]); p != nil {
+			*p = headerUnescaper.Replace(kv[1])
+		}
+	}
+	return h[:x], md
+}
+
+// htmlMetadata returns attribute metadata for a table heading, with the
+// term and unit shown and the other fields in a tooltip.
+func htmlMetadata(md *api.AttributeMetadata) string {
+	if *md == (api.AttributeMetadata{}) {
+		return "&nbsp;"
+	}
+	var title []string
+	for _, k := range []string{"label", "description", "datatype",
+		"missing"} {
+		var v string = *metadataField(md, k)
+		if v != "" {
+			title = append(title, k+": "+v)
+		}
+	}
+	var s string = template.HTMLEscapeString(md.Term)
+	if md.Unit != "" {
+		if s != "" {
+			s += " "
+		}
+		s += "[" + template.HTMLEscapeString(md.Unit) + "]"
+	}
+	if s == "" {
+		s = "&nbsp;"
+	}
+	if len(title) == 0 {
+		return s
+	}
+	return "<span title=\"" +
+		template.HTMLEscapeString(strings.Join(title, "\n")) + "\">" +
+		s + "</span>"
+}
+
+// validateDatasetMetadata checks the descriptive metadata of a data set.
+func validateDatasetMetadata(md *api.DatasetMetadata) error {
+	if strings.ContainsAny(md.Title, "\r\n") {
+		return errors.New("Title contains a line break")
+	}
+	if md.License != "" && !validLicenseId(md.License) {
+		return fmt.Errorf("License must be an SPDX license identifier: %s",
+			md.License)
+	}
+	for _, c := range md.Creators {
+		if strings.TrimSpace(c.Name) == "" {
+			return errors.New("Creator name not specified")
+		}
+	}
+	if t := md.Temporal; t != nil {
+		var start, end time.Time
+		var err error
+		if start, err = parseCoverageTime(t.Start); err != nil {
+			return fmt.Errorf("Invalid temporal coverage start: %s",
+				t.Start)
+		}
+		if end, err = parseCoverageTime(t.End); err != nil {
+			return fmt.Errorf("Invalid temporal coverage end: %s", t.End)
+		}
+		if !start.IsZero() && !end.IsZero() && end.Before(start) {
+			return errors.New("Temporal coverage ends before it starts")
+		}
+	}
+	if s := md.Spatial; s != nil && len(s.Bbox) != 0 {
+		if len(s.Bbox) != 4 {
+			return errors.New("Spatial coverage bounding box must be " +
+				"[west, south, east, north]")
+		}
+		var west, south, east, north = s.Bbox[0], s.Bbox[1], s.Bbox[2],
+			s.Bbox[3]
+		if west < -180 || west > 180 || east < -180 || east > 180 ||
+			south < -90 || north > 90 || south > north {
+			return errors.New("Spatial coverage bounding box is " +
+				"out of range")
+		}
+	}
+	return nil
+}
+
+// validLicenseId reports whether id has the form of an SPDX license
+// identifier, e.g. "CC-BY-4.0" or "LicenseRef-Internal".
+func validLicenseId(id string) bool {
+	id = strings.TrimSuffix(id, "+")
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCoverageTime parses a date or date and time in ISO 8601 format.  An
+// empty string is the zero time.
+func parseCoverageTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	var t time.Time
+	var err error
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
+// htmlDatasetMetadata returns the descriptive metadata of a data set for
+// its HTML page.
+func htmlDatasetMetadata(md *api.DatasetMetadata) string {
+	var esc = template.HTMLEscapeString
+	var b strings.Builder
+	b.WriteString("<div class=\"metadata\">\n")
+	if md.Title != "" {
+		fmt.Fprintf(&b, "<h2>%s</h2>\n", esc(md.Title))
+	}
+	if md.Abstract != "" {
+		fmt.Fprintf(&b, "<p>%s</p>\n", esc(md.Abstract))
+	}
+	b.WriteString("<dl>\n")
+	var item = func(term, desc string) {
+		if desc != "" {
+			fmt.Fprintf(&b, "<dt>%s</dt><dd>%s</dd>\n", term, desc)
+		}
+	}
+	var creators []string
+	for _, c := range md.Creators {
+		var s string = esc(c.Name)
+		if strings.HasPrefix(c.Id, "https://") ||
+			strings.HasPrefix(c.Id, "http://") {
+			s = "<a href=\"" + esc(c.Id) + "\">" + s + "</a>"
+		}
+		if c.Affiliation != "" {
+			s += " (" + esc(c.Affiliation) + ")"
+		}
+		creators = append(creators, s)
+	}
+	item("Creators", strings.Join(creators, "; "))
+	var funders []string
+	for _, f := range md.Funders {
+		funders = append(funders, esc(f))
+	}
+	item("Funders", strings.Join(funders, "; "))
+	var keywords []string
+	for _, k := range md.Keywords {
+		keywords = append(keywords, esc(k))
+	}
+	item("Keywords", strings.Join(keywords, ", "))
+	if md.License != "" {
+		item("License", "<a href=\"https://spdx.org/licenses/"+
+			esc(strings.TrimSuffix(md.License, "+"))+".html\">"+
+			esc(md.License)+"</a>")
+	}
+	if t := md.Temporal; t != nil && (t.Start != "" || t.End != "") {
+		item("Temporal coverage", esc(t.Start)+" &ndash; "+esc(t.End))
+	}
+	if s := md.Spatial; s != nil {
+		var desc string = esc(s.Place)
+		if len(s.Bbox) == 4 {
+			var bbox = fmt.Sprintf("W %g, S %g, E %g, N %g", s.Bbox[0],
+				s.Bbox[1], s.Bbox[2], s.Bbox[3])
+			if desc != "" {
+				desc += " (" + bbox + ")"
+			} else {
+				desc = bbox
+			}
+		}
+		item("Spatial coverage", desc)
+	}
+	b.WriteString("</dl>\n</div>\n")
+	return b.String()
+}
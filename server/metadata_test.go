@@ -0,0 +1,378 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// metadataStorage is a sessionStorage that keeps the attribute metadata of
+// one data set, "ocean", in memory.
+type metadataStorage struct {
+	*sessionStorage
+	attrs map[string]*api.AttributeMetadata
+}
+
+func (s *metadataStorage) LookupPersonId(username string) (int64, error) {
+	return 1, nil
+}
+
+func (s *metadataStorage) AddMetadataBatch(personId int64, path string,
+	merge MetadataMerge) error {
+	if path != "ocean" {
+		return sql.ErrNoRows
+	}
+	var current = make(map[string]*api.AttributeMetadata)
+	for attr, md := range s.attrs {
+		var m = *md
+		current[attr] = &m
+	}
+	var metadata, err = merge(current)
+	if err != nil {
+		return err
+	}
+	for attr, md := range metadata {
+		s.attrs[attr] = md
+	}
+	return nil
+}
+
+func (s *metadataStorage) LookupMetadata(personId int64, path string,
+	attribute string) (*api.AttributeMetadata, error) {
+	md, ok := s.attrs[attribute]
+	if path != "ocean" || !ok {
+		return nil, sql.ErrNoRows
+	}
+	m := *md
+	return &m, nil
+}
+
+func (s *metadataStorage) AddMetadata(personId int64, path string,
+	attribute string, metadata *api.AttributeMetadata) error {
+	if _, ok := s.attrs[attribute]; path != "ocean" || !ok {
+		return sql.ErrNoRows
+	}
+	s.attrs[attribute] = metadata
+	return nil
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	for _, c := range []struct {
+		stored string
+		md     api.AttributeMetadata
+	}{
+		{"", api.AttributeMetadata{}},
+		// Metadata were once stored as a single term.
+		{"dc:date", api.AttributeMetadata{Term: "dc:date"}},
+		{"{not json", api.AttributeMetadata{Term: "{not json"}},
+		{`{"term":"dc:date","unit":"s","label":"Time"}`,
+			api.AttributeMetadata{Term: "dc:date", Unit: "s",
+				Label: "Time"}},
+	} {
+		if md := decodeMetadata(c.stored); md != c.md {
+			t.Errorf("decodeMetadata(%q) = %+v, want %+v", c.stored,
+				md, c.md)
+		}
+	}
+	for _, md := range []api.AttributeMetadata{
+		{},
+		{Term: "dc:date"},
+		{Label: "Salinity", Description: "Practical salinity",
+			Datatype: "number", Missing: "-99"},
+	} {
+		s, err := encodeMetadata(&md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decodeMetadata(s); got != md {
+			t.Errorf("%+v stored as %q read as %+v", md, s, got)
+		}
+	}
+	if s, _ := encodeMetadata(&api.AttributeMetadata{}); s != "" {
+		t.Errorf("empty metadata stored as %q", s)
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	md := api.AttributeMetadata{Term: "dc:date", Label: "Old"}
+	err := setMetadata(&md, map[string]string{
+		"label":       " Time ",
+		"description": "When measured",
+		"datatype":    "date",
+		"term":        "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := api.AttributeMetadata{Label: "Time",
+		Description: "When measured", Datatype: "date"}
+	if md != want {
+		t.Errorf("got %+v, want %+v", md, want)
+	}
+	for _, set := range []map[string]string{
+		{"colour": "red"},
+		{"label": "two\nlines"},
+		{"datatype": "float"},
+	} {
+		md := api.AttributeMetadata{}
+		if err := setMetadata(&md, set); err == nil {
+			t.Errorf("%v: no error", set)
+		}
+	}
+}
+
+func TestHeaderMetadata(t *testing.T) {
+	for _, c := range []struct {
+		md     api.AttributeMetadata
+		header string
+	}{
+		{api.AttributeMetadata{}, ""},
+		// A column with only a term is written as before.
+		{api.AttributeMetadata{Term: "dc:date"}, "{dc:date}"},
+		{api.AttributeMetadata{Term: "yamz:h1295", Unit: "Cel",
+			Label: "Air temperature"},
+			"{yamz:h1295;label=Air temperature;unit=Cel}"},
+		{api.AttributeMetadata{Label: "a,b;c={d}", Missing: "%"},
+			"{;label=a%2Cb%3Bc%3D%7Bd%7D;missing=%25}"},
+	} {
+		h := formatHeaderMetadata(&c.md)
+		if h != c.header {
+			t.Errorf("%+v: header %q, want %q", c.md, h, c.header)
+		}
+		name, md := parseHeaderMetadata("t" + h)
+		if name != "t" || md != c.md {
+			t.Errorf("%q read as %q %+v", "t"+h, name, md)
+		}
+	}
+}
+
+func TestHtmlMetadata(t *testing.T) {
+	for _, c := range []struct {
+		md   api.AttributeMetadata
+		html string
+	}{
+		{api.AttributeMetadata{}, "&nbsp;"},
+		{api.AttributeMetadata{Term: "dc:date"}, "dc:date"},
+		{api.AttributeMetadata{Unit: "Cel"}, "[Cel]"},
+		{api.AttributeMetadata{Term: "ex:<t>", Unit: "Cel",
+			Label: "Air \"temp\""},
+			`<span title="label: Air &#34;temp&#34;">ex:&lt;t&gt; ` +
+				`[Cel]</span>`},
+		{api.AttributeMetadata{Description: "Notes"},
+			`<span title="description: Notes">&nbsp;</span>`},
+	} {
+		if h := htmlMetadata(&c.md); h != c.html {
+			t.Errorf("%+v: %q, want %q", c.md, h, c.html)
+		}
+	}
+}
+
+func TestMetadataPut(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	srv, st, _ := newSessionServer(t)
+	mst := &metadataStorage{sessionStorage: st,
+		attrs: map[string]*api.AttributeMetadata{
+			"t": {Term: "dc:date", Unit: "s"},
+		}}
+	srv.storage = mst
+	var err error
+	srv.vocab, err = newVocabulary("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		path, body string
+		code       int
+		want       api.AttributeMetadata
+	}{
+		// Fields given are changed and the others kept.
+		{"/alice/ocean.t", `{"set":{"label":"Time"}}`, http.StatusOK,
+			api.AttributeMetadata{Term: "dc:date", Unit: "s",
+				Label: "Time"}},
+		{"/alice/ocean.t", `{"set":{"unit":""}}`, http.StatusOK,
+			api.AttributeMetadata{Term: "dc:date", Label: "Time"}},
+		// A metadata string sets the term, as it always has.
+		{"/alice/ocean.t", `{"metadata":"dc:title"}`, http.StatusOK,
+			api.AttributeMetadata{Term: "dc:title", Label: "Time"}},
+		{"/alice/ocean.t", `{"set":{"colour":"red"}}`,
+			http.StatusBadRequest,
+			api.AttributeMetadata{Term: "dc:title", Label: "Time"}},
+		{"/alice/ocean.x", `{"set":{"label":"X"}}`, http.StatusNotFound,
+			api.AttributeMetadata{Term: "dc:title", Label: "Time"}},
+		{"/alice/ocean", `{"set":{"label":"X"}}`, http.StatusBadRequest,
+			api.AttributeMetadata{Term: "dc:title", Label: "Time"}},
+	} {
+		r := httptest.NewRequest("PUT", c.path, strings.NewReader(c.body))
+		r.SetBasicAuth("alice", "secret")
+		w := httptest.NewRecorder()
+		srv.handleMetadataPut(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s %s: status %d, want %d: %s", c.path, c.body,
+				w.Code, c.code, w.Body)
+		}
+		if !reflect.DeepEqual(*mst.attrs["t"], c.want) {
+			t.Errorf("%s %s: t = %+v, want %+v", c.path, c.body,
+				*mst.attrs["t"], c.want)
+		}
+	}
+}
+
+func TestMetadataBatchPut(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	srv, st, _ := newSessionServer(t)
+	mst := &metadataStorage{sessionStorage: st,
+		attrs: map[string]*api.AttributeMetadata{
+			"t": {Term: "dc:date", Unit: "s"},
+			"s": {},
+		}}
+	srv.storage = mst
+	var err error
+	srv.vocab, err = newVocabulary("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/alice/ocean", `{"attributes":{"t":{"unit":"min"},` +
+			`"s":{"label":"Salinity"}}}`, http.StatusOK},
+		{"/alice/ocean", `{"attributes":{"t":{"unit":""},` +
+			`"x":{"label":"X"}}}`, http.StatusUnprocessableEntity},
+		{"/alice/ocean", `{"attributes":{"t":{"term":"dc:dated"}}}`,
+			http.StatusBadRequest},
+		{"/alice/river", `{"attributes":{"t":{"unit":""}}}`,
+			http.StatusNotFound},
+	} {
+		r := httptest.NewRequest("PUT", c.path+"?md()",
+			strings.NewReader(c.body))
+		r.SetBasicAuth("alice", "secret")
+		w := httptest.NewRecorder()
+		srv.handleMetadataBatchPut(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s: status %d, want %d: %s", c.body, w.Code,
+				c.code, w.Body)
+		}
+	}
+	if md := mst.attrs["t"]; md.Term != "dc:date" || md.Unit != "min" {
+		t.Errorf("t: %+v", md)
+	}
+	if md := mst.attrs["s"]; md.Label != "Salinity" {
+		t.Errorf("s: %+v", md)
+	}
+}
+
+func TestValidateDatasetMetadata(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		md   api.DatasetMetadata
+		ok   bool
+	}{
+		{"empty", api.DatasetMetadata{}, true},
+		{"complete", api.DatasetMetadata{
+			Title:    "Ocean temperature",
+			License:  "CC-BY-4.0",
+			Creators: []api.Creator{{Name: "Izzy"}},
+			Temporal: &api.TemporalCoverage{Start: "2020-01-01",
+				End: "2020-12-31T23:59:59Z"},
+			Spatial: &api.SpatialCoverage{
+				Bbox: []float64{-130, 30, -120, 40}},
+		}, true},
+		{"open-ended coverage", api.DatasetMetadata{
+			Temporal: &api.TemporalCoverage{Start: "2020-01-01"}}, true},
+		{"license or later", api.DatasetMetadata{License: "GPL-2.0+"},
+			true},
+		{"license reference", api.DatasetMetadata{
+			License: "LicenseRef-Internal"}, true},
+		{"license name", api.DatasetMetadata{
+			License: "Creative Commons"}, false},
+		{"license plus", api.DatasetMetadata{License: "+"}, false},
+		{"title line break", api.DatasetMetadata{Title: "a\nb"}, false},
+		{"creator without name", api.DatasetMetadata{
+			Creators: []api.Creator{{Id: "https://orcid.org/x"}}},
+			false},
+		{"invalid start", api.DatasetMetadata{
+			Temporal: &api.TemporalCoverage{Start: "01/02/2020"}},
+			false},
+		{"invalid end", api.DatasetMetadata{
+			Temporal: &api.TemporalCoverage{End: "2020-13-01"}}, false},
+		{"ends before start", api.DatasetMetadata{
+			Temporal: &api.TemporalCoverage{Start: "2020-02-01",
+				End: "2020-01-01"}}, false},
+		{"short bounding box", api.DatasetMetadata{
+			Spatial: &api.SpatialCoverage{
+				Bbox: []float64{1, 2, 3}}}, false},
+		{"bounding box out of range", api.DatasetMetadata{
+			Spatial: &api.SpatialCoverage{
+				Bbox: []float64{-190, 30, -120, 40}}}, false},
+		{"south of north", api.DatasetMetadata{
+			Spatial: &api.SpatialCoverage{
+				Bbox: []float64{-130, 40, -120, 30}}}, false},
+	} {
+		err := validateDatasetMetadata(&c.md)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: error %v", c.name, err)
+		}
+	}
+}
+
+func TestDecodeDatasetMetadata(t *testing.T) {
+	for _, s := range []string{"", "{not json"} {
+		if md := decodeDatasetMetadata(s); md != nil {
+			t.Errorf("decodeDatasetMetadata(%q) = %+v", s, md)
+		}
+	}
+	md := decodeDatasetMetadata(`{"title":"Ocean",` +
+		`"creators":[{"name":"Izzy"}],"temporal":{"start":"2020"}}`)
+	want := &api.DatasetMetadata{Title: "Ocean",
+		Creators: []api.Creator{{Name: "Izzy"}},
+		Temporal: &api.TemporalCoverage{Start: "2020"}}
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("got %+v, want %+v", md, want)
+	}
+}
+
+func TestHtmlDatasetMetadata(t *testing.T) {
+	h := htmlDatasetMetadata(&api.DatasetMetadata{
+		Title:   "Ocean <temperature>",
+		License: "GPL-2.0+",
+		Creators: []api.Creator{
+			{Name: "Izzy", Id: "https://orcid.org/0000-0001",
+				Affiliation: "UCSD"},
+			{Name: "Bob", Id: "javascript:alert(1)"},
+		},
+		Keywords: []string{"ocean", "temperature"},
+		Temporal: &api.TemporalCoverage{Start: "2020-01-01"},
+		Spatial: &api.SpatialCoverage{Place: "Pacific",
+			Bbox: []float64{-130, 30, -120, 40}},
+	})
+	for _, want := range []string{
+		"<h2>Ocean &lt;temperature&gt;</h2>",
+		"<dd><a href=\"https://orcid.org/0000-0001\">Izzy</a> (UCSD); " +
+			"Bob</dd>",
+		"<dd>ocean, temperature</dd>",
+		"<a href=\"https://spdx.org/licenses/GPL-2.0.html\">GPL-2.0+</a>",
+		"<dd>2020-01-01 &ndash; </dd>",
+		"<dd>Pacific (W -130, S 30, E -120, N 40)</dd>",
+	} {
+		if !strings.Contains(h, want) {
+			t.Errorf("missing %q in:\n%s", want, h)
+		}
+	}
+	for _, absent := range []string{"<p>", "Funders", "javascript"} {
+		if strings.Contains(h, absent) {
+			t.Errorf("unexpected %q in:\n%s", absent, h)
+		}
+	}
+	if h := htmlDatasetMetadata(&api.DatasetMetadata{}); h !=
+		"<div class=\"metadata\">\n<dl>\n</dl>\n</div>\n" {
+		t.Errorf("empty metadata: %q", h)
+	}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcTimeout limits the time spent waiting for the OpenID provider.
+const oidcTimeout = 10 * time.Second
+
+// oidcAuthenticator authenticates users against an OpenID Connect provider.
+// Passwords are verified with the resource owner password credentials grant,
+// and bearer tokens issued by the provider are verified with its token
+// introspection endpoint (RFC 7662), which must show that the token was
+// issued for this client.  The user's claims are read from the userinfo
+// endpoint; the account name is the configured username claim, and the
+// account is bound to the "sub" claim.  The provider's endpoints are read
+// from its discovery document the first time they are needed.
+type oidcAuthenticator struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	usernameClaim string
+
+	mu     sync.Mutex
+	config *oidcConfig
+}
+
+// oidcConfig holds the endpoints read from a provider's discovery
+// document.
+type oidcConfig struct {
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+}
+
+func (a *oidcAuthenticator) Name() string {
+	return "oidc"
+}
+
+func (a *oidcAuthenticator) client() *http.Client {
+	return &http.Client{Timeout: oidcTimeout}
+}
+
+// discover reads the provider configuration from the issuer's well-known
+// discovery URL.
+func (a *oidcAuthenticator) discover() (*oidcConfig, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.config != nil {
+		return a.config, nil
+	}
+	var u = strings.TrimRight(a.issuer, "/") +
+		"/.well-known/openid-configuration"
+	var resp, err = a.client().Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OpenID discovery: %s: %s", u,
+			resp.Status)
+	}
+	var conf oidcConfig
+	if err = json.NewDecoder(resp.Body).Decode(&conf); err != nil {
+		return nil, fmt.Errorf("OpenID discovery: %v", err)
+	}
+	if conf.TokenEndpoint == "" || conf.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("OpenID discovery: %s: token or "+
+			"userinfo endpoint not specified", u)
+	}
+	a.config = &conf
+	return a.config, nil
+}
+
+// post sends a form to an endpoint of the provider, authenticating as the
+// client, and decodes the JSON response into v.
+func (a *oidcAuthenticator) post(endpoint string, form url.Values,
+	v interface{}) (*http.Response, error) {
+	var req, err = http.NewRequest(http.MethodPost, endpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(a.clientID),
+		url.QueryEscape(a.clientSecret))
+	var resp *http.Response
+	resp, err = a.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(v)
+	return resp, nil
+}
+
+func (a *oidcAuthenticator) Authenticate(username, password string) (
+	Identity, bool, error) {
+
+	if username == "" || password == "" {
+		return Identity{}, false, nil
+	}
+	var conf, err = a.discover()
+	if err != nil {
+		return Identity{}, false, err
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	var resp *http.Response
+	resp, err = a.post(conf.TokenEndpoint, url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+		"scope":      {"openid profile email"},
+	}, &tok)
+	if err != nil {
+		return Identity{}, false, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK && tok.AccessToken != "":
+	case tok.Error == "invalid_grant":
+		return Identity{}, false, nil
+	default:
+		return Identity{}, false, fmt.Errorf("OpenID token request: %s %s",
+			resp.Status, tok.Error)
+	}
+	// The token was issued to this client in response to its own
+	// request, so only the user's claims are needed.
+	return a.userinfo(conf, tok.AccessToken, "")
+}
+
+// AuthenticateToken verifies an access token by introspection, accepting it
+// only if it is active and was issued for this client, and then reads the
+// user's claims.
+func (a *oidcAuthenticator) AuthenticateToken(token string) (Identity, bool,
+	error) {
+
+	var conf, err = a.discover()
+	if err != nil {
+		return Identity{}, false, err
+	}
+	if conf.IntrospectionEndpoint == "" {
+		return Identity{}, false, fmt.Errorf("OpenID provider has no " +
+			"introspection endpoint; bearer tokens cannot be verified")
+	}
+	var info struct {
+		Active   bool            `json:"active"`
+		Audience json.RawMessage `json:"aud"`
+		Azp      string          `json:"azp"`
+		ClientId string          `json:"client_id"`
+		Subject  string          `json:"sub"`
+	}
+	var resp *http.Response
+	resp, err = a.post(conf.IntrospectionEndpoint, url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}, &info)
+	if err != nil {
+		return Identity{}, false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, false, fmt.Errorf(
+			"OpenID introspection request: %s", resp.Status)
+	}
+	if !info.Active || !(info.Azp == a.clientID ||
+		info.ClientId == a.clientID ||
+		audienceContains(info.Audience, a.clientID)) {
+		return Identity{}, false, nil
+	}
+	return a.userinfo(conf, token, info.Subject)
+}
+
+// audienceContains reports whether an "aud" claim, which may be a string or
+// an array of strings, includes id.
+func audienceContains(aud json.RawMessage, id string) bool {
+	var one string
+	if json.Unmarshal(aud, &one) == nil {
+		return one == id
+	}
+	var many []string
+	if json.Unmarshal(aud, &many) == nil {
+		for _, s := range many {
+			if s == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// userinfo reads the claims of the user who owns an access token.  If
+// subject is not empty, the "sub" claim must match it.
+func (a *oidcAuthenticator) userinfo(conf *oidcConfig, token string,
+	subject string) (Identity, bool, error) {
+	var req, err = http.NewRequest(http.MethodGet, conf.UserinfoEndpoint, nil)
+	if err != nil {
+		return Identity{}, false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var resp *http.Response
+	resp, err = a.client().Do(req)
+	if err != nil {
+		return Identity{}, false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return Identity{}, false, nil
+	default:
+		return Identity{}, false, fmt.Errorf("OpenID userinfo request: %s",
+			resp.Status)
+	}
+	var claims map[string]interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return Identity{}, false, fmt.Errorf("OpenID userinfo: %v", err)
+	}
+	var claim = a.usernameClaim
+	if claim == "" {
+		claim = "preferred_username"
+	}
+	var str = func(k string) string {
+		var s, _ = claims[k].(string)
+		return s
+	}
+	if str("sub") == "" || (subject != "" && str("sub") != subject) {
+		return Identity{}, false, nil
+	}
+	return Identity{
+		Username: str(claim),
+		Subject:  str("sub"),
+		Fullname: str("name"),
+		Email:    str("email"),
+	}, true, nil
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// oidcProvider starts an OpenID Connect provider that knows the users
+// alice (who may log in as "alice" or "alice@example.org") and bob, and
+// issues tokens for the clients "glint" and "other".
+func oidcProvider(t *testing.T, introspection bool) *httptest.Server {
+	type token struct {
+		sub, username, client string
+	}
+	tokens := map[string]token{
+		"tok-alice": {"s-alice", "alice", "glint"},
+		"tok-bob":   {"s-bob", "bob", "other"},
+	}
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	writeJSON := func(w http.ResponseWriter, code int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+	client := func(r *http.Request) bool {
+		id, secret, ok := r.BasicAuth()
+		return ok && id == "glint" && secret == "s3cret"
+	}
+	mux.HandleFunc("/.well-known/openid-configuration",
+		func(w http.ResponseWriter, r *http.Request) {
+			conf := map[string]string{
+				"issuer":            srv.URL,
+				"token_endpoint":    srv.URL + "/token",
+				"userinfo_endpoint": srv.URL + "/userinfo",
+			}
+			if introspection {
+				conf["introspection_endpoint"] = srv.URL +
+					"/introspect"
+			}
+			writeJSON(w, http.StatusOK, conf)
+		})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if !client(r) {
+			writeJSON(w, http.StatusUnauthorized,
+				map[string]string{"error": "invalid_client"})
+			return
+		}
+		u, p := r.PostFormValue("username"), r.PostFormValue("password")
+		if (u == "alice" || u == "alice@example.org") && p == "secret" {
+			writeJSON(w, http.StatusOK, map[string]string{
+				"access_token": "tok-alice",
+				"token_type":   "Bearer",
+			})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest,
+			map[string]string{"error": "invalid_grant"})
+	})
+	mux.HandleFunc("/introspect",
+		func(w http.ResponseWriter, r *http.Request) {
+			if !client(r) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tok, ok := tokens[r.PostFormValue("token")]
+			if !ok {
+				writeJSON(w, http.StatusOK,
+					map[string]bool{"active": false})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"active":    true,
+				"aud":       []string{"account", tok.client},
+				"client_id": tok.client,
+				"sub":       tok.sub,
+			})
+		})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		tok, ok := tokens[strings.TrimPrefix(
+			r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{
+			"sub":                tok.sub,
+			"preferred_username": tok.username,
+			"name":               strings.Title(tok.username),
+		})
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	p := oidcProvider(t, true)
+	a := &oidcAuthenticator{issuer: p.URL, clientID: "glint",
+		clientSecret: "s3cret"}
+	for _, c := range []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"alice", "secret", true},
+		{"alice@example.org", "secret", true},
+		{"alice", "wrong", false},
+		{"bob", "secret", false},
+	} {
+		id, ok, err := a.Authenticate(c.username, c.password)
+		if err != nil {
+			t.Fatalf("%s: %v", c.username, err)
+		}
+		if ok != c.ok {
+			t.Errorf("%s/%s: ok = %v", c.username, c.password, ok)
+		}
+		// The account is named by the claim, not by what was typed.
+		if ok && (id.Username != "alice" || id.Subject != "s-alice" ||
+			id.Fullname != "Alice") {
+			t.Errorf("%s: identity = %+v", c.username, id)
+		}
+	}
+}
+
+func TestOIDCAuthenticateToken(t *testing.T) {
+	p := oidcProvider(t, true)
+	a := &oidcAuthenticator{issuer: p.URL, clientID: "glint",
+		clientSecret: "s3cret"}
+	id, ok, err := a.AuthenticateToken("tok-alice")
+	if err != nil || !ok {
+		t.Fatalf("tok-alice: ok = %v, err = %v", ok, err)
+	}
+	if id.Username != "alice" || id.Subject != "s-alice" {
+		t.Errorf("tok-alice: identity = %+v", id)
+	}
+	// A token issued to another client is refused, even though the
+	// userinfo endpoint accepts it.
+	for _, tok := range []string{"tok-bob", "unknown"} {
+		_, ok, err = a.AuthenticateToken(tok)
+		if err != nil || ok {
+			t.Errorf("%s: ok = %v, err = %v", tok, ok, err)
+		}
+	}
+}
+
+func TestOIDCAuthenticateTokenWithoutIntrospection(t *testing.T) {
+	p := oidcProvider(t, false)
+	a := &oidcAuthenticator{issuer: p.URL, clientID: "glint",
+		clientSecret: "s3cret"}
+	if _, ok, err := a.AuthenticateToken("tok-alice"); err == nil || ok {
+		t.Errorf("ok = %v, err = %v", ok, err)
+	}
+}
+
+func TestAudienceContains(t *testing.T) {
+	for _, c := range []struct {
+		aud string
+		ok  bool
+	}{
+		{`"glint"`, true},
+		{`["account","glint"]`, true},
+		{`"other"`, false},
+		{`["other"]`, false},
+		{`null`, false},
+		{``, false},
+	} {
+		if audienceContains(json.RawMessage(c.aud), "glint") != c.ok {
+			t.Errorf("aud %s: want %v", c.aud, c.ok)
+		}
+	}
+}
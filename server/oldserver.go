@@ -1,13 +1,20 @@
 package server
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/glintdb/glintweb/api"
 )
@@ -59,53 +66,133 @@ func setContentTypeTextPlain(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 }
 
-// Authenticate user provided via HTTP basic authentication, returning the
-// username if possible.
+// Authenticate user provided via HTTP basic authentication, or via a bearer
+// token if an authentication provider supports tokens, returning the
+// username if possible.  Missing or invalid credentials result in 401
+// Unauthorized with authentication challenges; 403 Forbidden is reserved for
+// users who authenticated but are not allowed access.  Repeated failures
+// from the same user or client address are throttled.
 func (srv *Server) handleBasicAuth(w http.ResponseWriter, r *http.Request) (
 	string, bool) {
+	return srv.authenticateRequest(w, r, true)
+}
+
+// authenticateRequest authenticates a request as handleBasicAuth does.
+// Session tokens issued by /login are accepted as bearer tokens only if
+// sessions is true; bearer tokens of external providers are always
+// accepted.
+func (srv *Server) authenticateRequest(w http.ResponseWriter,
+	r *http.Request, sessions bool) (string, bool) {
+	var ip = remoteIP(r)
+	var auth = r.Header.Get("Authorization")
+	var bearer = strings.HasPrefix(auth, "Bearer ")
 	var user, password string
 	var ok bool
-	user, password, ok = r.BasicAuth()
-	if !ok {
-		var m = "Unauthorized: Invalid HTTP Basic Authentication"
-		log.Println(m)
-		//w.Header().Set("WWW-Authenticate", "Basic")
-		http.Error(w, m, http.StatusForbidden)
+	if !bearer {
+		user, password, ok = r.BasicAuth()
+		if !ok {
+			srv.writeUnauthorized(w,
+				"Authentication required", false)
+			return user, false
+		}
+	}
+	var wait time.Duration
+	var locked bool
+	wait, locked = srv.loginWait(user, ip)
+	if wait > 0 {
+		var m string
+		if locked {
+			m = "Too many failed login attempts; account temporarily " +
+				"locked"
+		} else {
+			m = "Too many failed login attempts; try again later"
+		}
+		log.Printf("Login throttled (user '%s', address %s)", user, ip)
+		w.Header().Set("Retry-After",
+			strconv.Itoa(int(wait/time.Second)+1))
+		writeError(w, http.StatusTooManyRequests, m)
 		return user, false
 	}
 	var match bool
 	var err error
-	match, err = srv.storage.Authenticate(user, password)
+	if bearer {
+		user, match, err = srv.authenticateToken(
+			strings.TrimSpace(auth[len("Bearer "):]), sessions)
+	} else {
+		var account string
+		account, match, err = srv.authenticate(user, password)
+		if match {
+			user = account
+		}
+	}
 	if err != nil {
-		var m = "Unauthorized (user '" + user + "')"
-		log.Println(m + ": " + err.Error())
-		//w.Header().Set("WWW-Authenticate", "Basic")
-		http.Error(w, m, http.StatusForbidden)
+		log.Printf("Authentication error (user '%s'): %v", user, err)
+		writeError(w, http.StatusServiceUnavailable,
+			"Authentication service unavailable")
 		return user, false
 	}
 	if !match {
-		var m = "Unauthorized (user '" + user + "'): " +
-			"Unable to authenticate username/password"
-		log.Println(m)
-		//w.Header().Set("WWW-Authenticate", "Basic")
-		http.Error(w, m, http.StatusForbidden)
+		srv.loginFailed(user, ip)
+		srv.addAuditEvent(&AuditEvent{
+			Actor:   user,
+			IP:      ip,
+			Action:  AuditLoginFailed,
+			Target:  r.URL.Path,
+			Outcome: AuditFailure,
+		})
+		if bearer {
+			srv.writeUnauthorized(w,
+				"Unable to authenticate bearer token", true)
+		} else {
+			srv.writeUnauthorized(w, "Unable to authenticate "+
+				"username/password (user '"+user+"')", false)
+		}
+		return user, false
+	}
+	var disabled bool
+	disabled, err = srv.storage.LookupAccountDisabled(user)
+	if err != nil {
+		handleError(w, fmt.Errorf("Unable to look up account "+
+			"(user '%s'): %v", user, err),
+			http.StatusInternalServerError)
+		return user, false
+	}
+	if disabled {
+		writeError(w, http.StatusForbidden,
+			"Account disabled (user '"+user+"')")
+		return user, false
+	}
+	srv.loginSucceeded(user, ip)
+	setAuditActor(w, user)
+	return user, true
+}
+
+// requireUser authenticates the request and checks that the authenticated
+// user is pathUser, the owner of the requested resource.
+func (srv *Server) requireUser(w http.ResponseWriter, r *http.Request,
+	pathUser string) (string, bool) {
+	var user string
+	var ok bool
+	user, ok = srv.handleBasicAuth(w, r)
+	if !ok {
+		return user, false
+	}
+	if pathUser != user {
+		writeError(w, http.StatusForbidden, "User '"+user+
+			"' is not allowed to modify data belonging to '"+
+			pathUser+"'")
 		return user, false
 	}
 	return user, true
 }
 
 func handleError(w http.ResponseWriter, err error, statusCode int) {
-	var m string = err.Error()
-	log.Println(m)
-	http.Error(w, m, statusCode)
+	writeError(w, statusCode, err.Error())
 }
 
 func (srv *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		var m = "HTTP method " + r.Method +
-			" is not supported by this URL"
-		http.Error(w, m, http.StatusMethodNotAllowed)
-		log.Println(m)
+		writeMethodNotAllowed(w, r, "POST")
 		return
 	}
 	// Authenticate user.
@@ -129,12 +216,40 @@ func (srv *Server) handleChangePassword(w http.ResponseWriter, r *http.Request)
 		handleError(w, err, http.StatusBadRequest)
 		return
 	}
-	// Set the new password.
+	// A session token is not enough to change the password; the current
+	// password must be given with basic authentication or in the request.
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		var ip = remoteIP(r)
+		if p.CurrentPassword == "" {
+			writeError(w, http.StatusForbidden, "The current "+
+				"password is required to change the password")
+			return
+		}
+		if wait, _ := srv.loginWait(user, ip); wait > 0 {
+			w.Header().Set("Retry-After",
+				strconv.Itoa(int(wait/time.Second)+1))
+			writeError(w, http.StatusTooManyRequests,
+				"Too many failed login attempts; try again later")
+			return
+		}
+		var match bool
+		match, err = srv.storage.Authenticate(user, p.CurrentPassword)
+		if err != nil && err != sql.ErrNoRows {
+			handleError(w, err, http.StatusInternalServerError)
+			return
+		}
+		if !match {
+			srv.loginFailed(user, ip)
+			writeError(w, http.StatusForbidden,
+				"Current password is incorrect (user '"+user+"')")
+			return
+		}
+	}
+	// Set the new password.  All sessions of the user are revoked.
 	err = srv.storage.ChangePassword(user, p.Password)
 	if err != nil {
-		var m = "Unable to update password: " + err.Error()
-		http.Error(w, m, http.StatusBadRequest)
-		log.Println(m)
+		writeError(w, http.StatusBadRequest,
+			"Unable to update password: "+err.Error())
 		return
 	}
 	// Respond with success.
@@ -214,73 +329,119 @@ func (srv *Server) fprintData(w http.ResponseWriter, html bool, thp map[string][
 		fmt.Fprintf(w, "%s", header())
 		fmt.Fprintf(w, "<h1><a href=\"/%s\">%s</a> / %s</h1>\n",
 			user, user, path)
+		if path != "" {
+			var f *FileInfo
+			var err error
+			f, err = srv.storage.LookupFileInfo(personId, path)
+			if err == nil && f.Metadata != nil {
+				fmt.Fprintf(w, "%s", htmlDatasetMetadata(f.Metadata))
+			}
+			if err == nil && f.Ark != "" {
+				fmt.Fprintf(w, "<p class=\"ark\">Cite as: "+
+					"<a href=\"%s\">%s</a></p>\n",
+					arkURL(f.Ark), f.Ark)
+			}
+			if err == nil {
+				if d := srv.lookupDerivation(personId, f); d != nil {
+					fmt.Fprintf(w, "%s", htmlDerivation(d))
+				}
+				fmt.Fprintf(w, "%s", htmlSchemaOrg(f))
+			}
+			fmt.Fprintf(w, "%s", htmlDataTabs(user, path, "data"))
+		}
 		fmt.Fprintf(w, "<table>\n")
 	}
-	var rows []string = strings.Split(data, "\n")
-	var r int
-	for r = range rows {
-		if strings.TrimSpace(rows[r]) == "" {
-			continue
+	// Converted attributes are shown with their new units.
+	var units map[string]string
+	if thp["units"] != nil {
+		units, _ = thumpParseUnits(thp["units"])
+	}
+	var columnMetadata = func(attr string) *api.AttributeMetadata {
+		var md *api.AttributeMetadata = srv.lookupMetadata(personId,
+			path, attr)
+		if u, ok := units[attr]; ok {
+			md.Unit = u
 		}
-		var cells []string = strings.Split(rows[r], ",")
-		if html {
-			fmt.Fprintf(w, "<tr>")
+		return md
+	}
+	var rows [][]string
+	var err error
+	rows, err = readCSV(data)
+	if err != nil {
+		srv.log("Error reading data set '%s/%s': %v", user, path, err)
+	}
+	if !html {
+		var cw *csv.Writer = csv.NewWriter(w)
+		if thp["as"] != nil && thp["as"][0] == "tsv" {
+			cw.Comma = '\t'
+		}
+		var r int
+		for r = range rows {
+			if r == 0 && thp["md"] != nil {
+				var header = make([]string, len(rows[r]))
+				var c int
+				var name string
+				for c, name = range rows[r] {
+					header[c] = name + formatHeaderMetadata(
+						columnMetadata(name))
+				}
+				cw.Write(header)
+				continue
+			}
+			cw.Write(rows[r])
 		}
+		cw.Flush()
+		return
+	}
+	var esc = template.HTMLEscapeString
+	var r int
+	for r = range rows {
+		var cells []string = rows[r]
+		fmt.Fprintf(w, "<tr>")
 		var c int
 		for c = range cells {
-			if html {
-				if r == 0 {
-					var md string
-					if thp["md"] != nil {
-						md, _ = srv.storage.LookupMetadata(
-							personId, path,
-							cells[c])
-					}
-					if md == "" {
-						md = "&nbsp;"
-					}
-					fmt.Fprintf(w,
-						"<th><div>%s</div><div>%s</div></th>",
-						cells[c], md)
-				} else {
-					if path == "" {
-						fmt.Fprintf(w, "<td>"+
-							"<a href=\"/%s/%s\">"+
-							"%s"+
-							"</a>"+
-							"</td>",
-							user, cells[c],
-							cells[c])
-					} else {
-						fmt.Fprintf(w, "<td>%s</td>",
-							cells[c])
-					}
+			if r == 0 {
+				var md string = "&nbsp;"
+				if thp["md"] != nil {
+					md = htmlMetadata(columnMetadata(cells[c]))
 				}
+				fmt.Fprintf(w, "<th><div>%s</div><div>%s</div></th>",
+					esc(cells[c]), md)
+			} else if path == "" {
+				fmt.Fprintf(w, "<td><a href=\"/%s/%s\">%s</a></td>",
+					esc(user), esc(cells[c]), esc(cells[c]))
 			} else {
-				if c > 0 {
-					fmt.Fprintf(w, ",")
-				}
-				fmt.Fprintf(w, "%s", cells[c])
-				if r == 0 && thp["md"] != nil {
-					var md string
-					md, _ = srv.storage.LookupMetadata(personId,
-						path, cells[c])
-					fmt.Fprintf(w, "%s", md)
-				}
+				fmt.Fprintf(w, "<td>%s</td>", esc(cells[c]))
 			}
 		}
-		if html {
-			fmt.Fprintf(w, "</tr>")
-		}
-		fmt.Fprintf(w, "\n")
+		fmt.Fprintf(w, "</tr>\n")
 	}
-	if html {
-		fmt.Fprintf(w, "</table>\n")
-		fmt.Fprintf(w, "%s", footer())
+	fmt.Fprintf(w, "</table>\n")
+	fmt.Fprintf(w, "%s", footer())
+}
+
+// lookupMetadata returns the metadata of an attribute, which are empty if
+// they cannot be read.
+func (srv *Server) lookupMetadata(personId int64, path string,
+	attribute string) *api.AttributeMetadata {
+	var md *api.AttributeMetadata
+	var err error
+	md, err = srv.storage.LookupMetadata(personId, path, attribute)
+	if err != nil {
+		return &api.AttributeMetadata{}
 	}
+	return md
 }
 
-func writeStatusCode(w http.ResponseWriter, code int) {
+// writeStatusCode writes an error response for a data request, as an HTML
+// page if the client accepts HTML or otherwise as JSON.
+func writeStatusCode(w http.ResponseWriter, r *http.Request, code int,
+	message string) {
+	if !acceptsHtml(r) {
+		writeError(w, code, message)
+		return
+	}
+	log.Println(message)
 	setContentTypeTextHtml(w)
 	w.WriteHeader(code)
 	fmt.Fprintf(w, "%d %s\n", code, http.StatusText(code))
@@ -292,7 +453,7 @@ func (srv *Server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 	var err error
 	pathUser, pathDataName, err = parsePathBasic(r)
 	if err != nil {
-		writeStatusCode(w, http.StatusBadRequest)
+		writeStatusCode(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -301,7 +462,22 @@ func (srv *Server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 	var personId int64
 	personId, err = srv.storage.LookupPersonId(pathUser)
 	if err != nil {
-		writeStatusCode(w, http.StatusNotFound)
+		writeStatusCode(w, r, http.StatusNotFound,
+			"User '"+pathUser+"' not found")
+		return
+	}
+
+	if pathDataName == "" && !acceptsHtml(r) && (acceptsJSON(r) ||
+		(thp["as"] != nil && thp["as"][0] == "json")) {
+		srv.writeDataList(w, r, pathUser, personId)
+		return
+	}
+	if pathDataName != "" && thp["info"] != nil {
+		srv.writeDataInfo(w, r, pathUser, personId, pathDataName)
+		return
+	}
+	if pathDataName != "" && thp["prov"] != nil {
+		srv.writeProvenance(w, r, pathUser, personId, pathDataName)
 		return
 	}
 
@@ -309,19 +485,50 @@ func (srv *Server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 	if pathDataName == "" {
 		data, err = srv.storage.LookupDataList(personId)
 		if err != nil {
-			writeStatusCode(w, http.StatusNotFound)
+			writeStatusCode(w, r, http.StatusNotFound,
+				"Unable to list data sets: "+err.Error())
 			return
 		}
 	} else {
 		data, err = srv.storage.LookupData(personId, pathDataName)
 		if err != nil {
-			writeStatusCode(w, http.StatusNotFound)
+			writeStatusCode(w, r, http.StatusNotFound,
+				"Data set '"+pathUser+"/"+pathDataName+
+					"' not found")
+			return
+		}
+		// The ETag is the hash of the source file and applies only
+		// to the data set as a whole.
+		if r.URL.RawQuery == "" && !srv.checkETag(w, r, personId,
+			pathDataName) {
 			return
 		}
 	}
 
-	if thp["show"] != nil {
-		data = thumpShowBasic(data, thp["show"])
+	data, err = thumpApply(data, thp, func(attr string) string {
+		return srv.lookupMetadata(personId, pathDataName, attr).Unit
+	})
+	if err != nil {
+		writeStatusCode(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if pathDataName != "" && thp["dict"] != nil {
+		srv.writeDataDict(w, r, thp, personId, pathUser, pathDataName,
+			data)
+		return
+	}
+	if thp["as"] != nil && thp["as"][0] == "json" && !acceptsHtml(r) {
+		var b []byte
+		b, err = thumpAsJSON(data)
+		if err != nil {
+			writeStatusCode(w, r, http.StatusInternalServerError,
+				err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+		return
 	}
 	if acceptsHtml(r) {
 		setContentTypeTextHtml(w)
@@ -335,9 +542,6 @@ func (srv *Server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 		}
 		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		if thp["as"] != nil && thp["as"][0] == "tsv" {
-			data = strings.Replace(data, ",", "\t", -1)
-		}
 	}
 	srv.fprintData(w, acceptsHtml(r), thp, personId, pathUser, pathDataName,
 		data)
@@ -350,25 +554,28 @@ func handleCss(w http.ResponseWriter, r *http.Request) {
 }
 
 func (srv *Server) handleMetadataPut(w http.ResponseWriter, r *http.Request) {
-	// Authenticate user.
-	var user string
-	var ok bool
-	user, ok = srv.handleBasicAuth(w, r)
-	if !ok {
-		return
-	}
-
 	var pathUser, pathDataName string
 	var err error
 	pathUser, pathDataName, err = parsePathBasic(r)
 	if err != nil {
-		// TODO Handle error.
+		handleError(w, err, http.StatusBadRequest)
+		return
 	}
-	if pathUser != user {
-		// TODO Handle error.
+
+	// Authenticate user.
+	var user string
+	var ok bool
+	user, ok = srv.requireUser(w, r, pathUser)
+	if !ok {
+		return
 	}
 
 	var sp []string = strings.Split(pathDataName, ".")
+	if len(sp) != 2 || sp[0] == "" || sp[1] == "" {
+		writeError(w, http.StatusBadRequest,
+			"Path not supported: "+r.URL.Path)
+		return
+	}
 	var path = sp[0]
 	var attribute = sp[1]
 
@@ -389,15 +596,36 @@ func (srv *Server) handleMetadataPut(w http.ResponseWriter, r *http.Request) {
 	var personId int64
 	personId, err = srv.storage.LookupPersonId(user)
 	if err != nil {
-		log.Print(err)
-		// TODO Handle error.
+		handleError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	err = srv.storage.AddMetadata(personId, path, attribute, req.Metadata)
+	// A request with only a metadata string sets the term, as in
+	// earlier versions.  Otherwise the fields in set are changed and
+	// the others are kept.
+	var set map[string]string = req.Set
+	if set == nil {
+		set = map[string]string{"term": req.Metadata}
+	}
+	var md *api.AttributeMetadata
+	md, err = srv.storage.LookupMetadata(personId, path, attribute)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Unable to add metadata to '"+
+			pathUser+"/"+pathDataName+"': "+err.Error())
+		return
+	}
+	err = setMetadata(md, set)
+	if err == nil && set["term"] != "" {
+		md.Term, err = srv.vocab.validate(md.Term)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	err = srv.storage.AddMetadata(personId, path, attribute, md)
 	if err != nil {
-		log.Print(err)
-		// TODO Handle error.
+		writeError(w, http.StatusNotFound, "Unable to add metadata to '"+
+			pathUser+"/"+pathDataName+"': "+err.Error())
 		return
 	}
 
@@ -406,7 +634,7 @@ func (srv *Server) handleMetadataPut(w http.ResponseWriter, r *http.Request) {
 	var respbody []byte
 	respbody, err = json.Marshal(resp)
 	if err != nil {
-		// TODO Handle error.
+		handleError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -416,24 +644,127 @@ func (srv *Server) handleMetadataPut(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (srv *Server) handleDataPut(w http.ResponseWriter, r *http.Request) {
+// handleMetadataBatchPut changes the metadata of several attributes of a
+// data set at once.  Either all of the changes are made or, if any is
+// invalid or names an unknown attribute, none are.
+func (srv *Server) handleMetadataBatchPut(w http.ResponseWriter,
+	r *http.Request) {
+	var pathUser, pathDataName string
+	var err error
+	pathUser, pathDataName, err = parsePathBasic(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	if pathDataName == "" {
+		writeError(w, http.StatusBadRequest, "Data set name not specified")
+		return
+	}
+
 	// Authenticate user.
 	var user string
 	var ok bool
-	user, ok = srv.handleBasicAuth(w, r)
+	user, ok = srv.requireUser(w, r, pathUser)
 	if !ok {
 		return
 	}
 
+	// Read the json request.
+	var body []byte
+	body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	var req api.MetadataBatchRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var personId int64
+	personId, err = srv.storage.LookupPersonId(user)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// As for a single attribute, fields that are not given are kept.  The
+	// changes are merged with the current metadata while they are locked,
+	// so that concurrent changes to other fields are not lost.
+	var status int
+	err = srv.storage.AddMetadataBatch(personId, pathDataName,
+		func(current map[string]*api.AttributeMetadata) (
+			map[string]*api.AttributeMetadata, error) {
+			var unknown []string
+			for attr := range req.Attributes {
+				if current[attr] == nil {
+					unknown = append(unknown, attr)
+				}
+			}
+			if len(unknown) > 0 {
+				sort.Strings(unknown)
+				status = http.StatusUnprocessableEntity
+				return nil, fmt.Errorf("Attributes not found in "+
+					"'%s/%s': %s", pathUser, pathDataName,
+					strings.Join(unknown, ", "))
+			}
+			var metadata = make(map[string]*api.AttributeMetadata)
+			for attr, set := range req.Attributes {
+				var md = *current[attr]
+				var err = setMetadata(&md, set)
+				if err == nil && set["term"] != "" {
+					md.Term, err = srv.vocab.validate(md.Term)
+				}
+				if err != nil {
+					status = http.StatusBadRequest
+					return nil, fmt.Errorf("%s: %v", attr, err)
+				}
+				metadata[attr] = &md
+			}
+			return metadata, nil
+		})
+	if err == sql.ErrNoRows && status == 0 {
+		writeError(w, http.StatusNotFound, "Data set '"+pathUser+"/"+
+			pathDataName+"' not found")
+		return
+	}
+	if err != nil && status != 0 {
+		writeError(w, status, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, "Unable to add metadata to '"+
+			pathUser+"/"+pathDataName+"': "+err.Error())
+		return
+	}
+
+	var resp api.PostResponse
+	resp.Url = joinURLPath(glintbaseurl, pathUser+"/"+pathDataName)
+	writeJSON(w, resp)
+}
+
+func (srv *Server) handleDataPut(w http.ResponseWriter, r *http.Request) {
 	var pathUser string
 	var pathDataName string
 	var err error
 	pathUser, pathDataName, err = parsePathBasic(r)
 	if err != nil {
-		// TODO Handle error.
+		handleError(w, err, http.StatusBadRequest)
+		return
 	}
-	if pathUser != user {
-		// TODO Handle error.
+	if pathDataName == "" {
+		writeError(w, http.StatusBadRequest, "Data set name not specified")
+		return
+	}
+
+	// Authenticate user.
+	var user string
+	var ok bool
+	user, ok = srv.requireUser(w, r, pathUser)
+	if !ok {
+		return
 	}
 
 	// Read the json request.
@@ -453,79 +784,148 @@ func (srv *Server) handleDataPut(w http.ResponseWriter, r *http.Request) {
 	var personId int64
 	personId, err = srv.storage.LookupPersonId(user)
 	if err != nil {
-		log.Print(err)
-		// TODO Handle error.
+		handleError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	var data string = strings.Replace(req.Data, "\\n", "\n", -1)
+	if req.Source != "" {
+		srv.deriveData(w, user, personId, pathDataName, &req)
+		return
+	}
 
-	var id int64
-	id, err = srv.storage.AddFile(personId, pathDataName, data)
+	var raw []byte
+	raw, err = decodeRequestData(req.Data, req.DataEncoding)
 	if err != nil {
-		log.Print(err)
-		// TODO Handle error.
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	var sp []string = strings.Split(data, "\n")
-	var attrs = strings.Split(sp[0], ",")
+	srv.storeData(w, pathUser, personId, pathDataName, raw, &req, nil)
+}
 
-	err = srv.storage.AddAttributes(id, attrs)
+// storeData converts raw file contents using the options in req, stores
+// them as the data set name belonging to personId, and writes the response.
+// If the data were derived from another data set, derived describes how,
+// and is recorded with the new revision.  It returns true if the data set
+// was stored.
+func (srv *Server) storeData(w http.ResponseWriter, pathUser string,
+	personId int64, pathDataName string, raw []byte, req *api.PostRequest,
+	derived *derivedData) bool {
+	var err error
+	if req.Metadata != nil {
+		err = validateDatasetMetadata(req.Metadata)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+	}
+
+	var data string
+	var conv *conversion
+	data, conv, err = convertData(raw, req.Type, req.NoHeader,
+		req.Columns)
 	if err != nil {
-		log.Print(err)
-		// TODO Handle error.
-		return
+		// Empty input is a bad request; data that were sent but
+		// cannot be read are unprocessable.
+		var status = http.StatusUnprocessableEntity
+		if err == errNoData || err == errNoColumns {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, "Unable to read data: "+err.Error())
+		return false
+	}
+
+	// The hash identifies the source file, so that clients can tell
+	// whether a local copy has changed.
+	var sum = sha256.Sum256(raw)
+	var hash = hex.EncodeToString(sum[:])
+
+	// The data, metadata, revision, and derivation are stored together,
+	// so that a failure leaves the data set unchanged.  Metadata are kept
+	// when a data set is replaced without new ones.
+	var f = StoredFile{
+		PersonId:   personId,
+		Path:       pathDataName,
+		Data:       data,
+		Hash:       hash,
+		Attributes: conv.Columns,
+		Metadata:   req.Metadata,
+		Mint:       srv.mintArk,
+	}
+	if derived != nil {
+		f.Derivation = &derived.derivation
+		f.AttributeMetadata = derivedMetadata(conv.Columns, derived)
+	}
+	var status = http.StatusCreated
+	var id int64
+	id, err = srv.storage.LookupFileId(personId, pathDataName)
+	if err == nil && req.Overwrite {
+		setAuditAction(w, AuditOverwrite)
+		f.FileId = id
+		status = http.StatusOK
+	}
+	var ark string
+	_, ark, err = srv.storage.StoreFile(&f)
+	if err != nil && f.FileId == 0 {
+		writeError(w, http.StatusConflict,
+			"Unable to add data set '"+pathUser+"/"+pathDataName+
+				"': "+err.Error())
+		return false
+	}
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return false
 	}
 
 	var resp api.PostResponse
 	resp.Url = joinURLPath(glintbaseurl, pathUser+"/"+pathDataName)
+	resp.Ark = ark
+	resp.Type = conv.Type
+	resp.Delimiter = conv.Delimiter
+	resp.Encoding = conv.Encoding
+	resp.Columns = conv.Columns
 	var respbody []byte
 	respbody, err = json.Marshal(resp)
 	if err != nil {
-		// TODO Handle error.
-		return
+		handleError(w, err, http.StatusInternalServerError)
+		return false
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	// TODO Return http.StatusOK if updated rather than created.
+	w.WriteHeader(status)
 	w.Write(respbody)
-
+	return true
 }
 
 func (srv *Server) handleDataDelete(w http.ResponseWriter, r *http.Request) {
-	// Authenticate user.
-	var user string
-	var ok bool
-	user, ok = srv.handleBasicAuth(w, r)
-	if !ok {
-		return
-	}
-
 	var pathUser string
 	var pathDataName string
 	var err error
 	pathUser, pathDataName, err = parsePathBasic(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		handleError(w, err, http.StatusBadRequest)
 		return
 	}
-	if pathUser != user {
-		w.WriteHeader(http.StatusForbidden)
+
+	// Authenticate user.
+	var user string
+	var ok bool
+	user, ok = srv.requireUser(w, r, pathUser)
+	if !ok {
 		return
 	}
 
 	var personId int64
 	personId, err = srv.storage.LookupPersonId(user)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		handleError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	err = srv.storage.DeleteFile(personId, pathDataName)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "Data set '"+pathUser+"/"+
+			pathDataName+"' not found")
 		return
 	}
 
@@ -535,21 +935,29 @@ func (srv *Server) handleDataDelete(w http.ResponseWriter, r *http.Request) {
 func (srv *Server) dataHandler(w http.ResponseWriter, r *http.Request) {
 	srv.logRequest(r, 0)
 	switch r.Method {
-	case http.MethodGet:
+	case http.MethodGet, http.MethodHead:
 		srv.handleDataGet(w, r)
 	case http.MethodPut:
 		if strings.ContainsRune(r.URL.Path, '.') {
-			srv.handleMetadataPut(w, r)
+			srv.audit(AuditMetadata, srv.handleMetadataPut)(w, r)
+		} else if thumpParseBasic(r)["md"] != nil {
+			srv.audit(AuditMetadata, srv.handleMetadataBatchPut)(w, r)
+		} else {
+			srv.audit(AuditPost, srv.handleDataPut)(w, r)
+		}
+	case http.MethodPost:
+		if strings.ContainsRune(r.URL.Path, '.') {
+			writeMethodNotAllowed(w, r, "PUT")
 		} else {
-			srv.handleDataPut(w, r)
+			srv.audit(AuditAppend, srv.handleDataAppend)(w, r)
 		}
 	case http.MethodDelete:
 		if strings.ContainsRune(r.URL.Path, '.') {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			writeMethodNotAllowed(w, r, "PUT")
 		} else {
-			srv.handleDataDelete(w, r)
+			srv.audit(AuditDelete, srv.handleDataDelete)(w, r)
 		}
 	default:
-		// TODO Access error for non-GET/PUT requests.
+		writeMethodNotAllowed(w, r, "GET, HEAD, PUT, POST, DELETE")
 	}
 }
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// bcryptMaxBytes is the maximum length of a password that bcrypt can hash.
+const bcryptMaxBytes = 72
+
+// PasswordPolicy specifies the requirements for new passwords.  Lengths are
+// measured in Unicode characters, and passwords are normalized to NFC before
+// they are checked or hashed.
+type PasswordPolicy struct {
+	// MinLength and MaxLength are the minimum and maximum number of
+	// characters.  MaxLength is further limited by bcrypt to 72 bytes.
+	MinLength int
+	MaxLength int
+
+	// MinClasses is the number of character classes (lowercase letters,
+	// uppercase letters, digits, and other characters) that a password
+	// must contain.
+	MinClasses int
+
+	// blocked contains common or breached passwords in lowercase, and
+	// blockedSHA1 contains passwords given as uppercase hex SHA-1 hashes.
+	blocked     map[string]bool
+	blockedSHA1 map[string]bool
+}
+
+// DefaultPasswordPolicy returns the policy used if none is configured.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:  8,
+		MaxLength:  64,
+		MinClasses: 1,
+	}
+}
+
+var passwordPolicy = DefaultPasswordPolicy()
+
+// SetPasswordPolicy sets the policy that new passwords are validated
+// against.
+func SetPasswordPolicy(p *PasswordPolicy) {
+	passwordPolicy = p
+}
+
+// LoadBlocklist reads a file of passwords that are not allowed, one per
+// line.  A line may contain either a password, which is compared without
+// regard to case, or a SHA-1 hash of a password in hex, optionally followed
+// by ":" and a count as in the Pwned Passwords downloads.
+func (p *PasswordPolicy) LoadBlocklist(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if p.blocked == nil {
+		p.blocked = make(map[string]bool)
+	}
+	if p.blockedSHA1 == nil {
+		p.blockedSHA1 = make(map[string]bool)
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if h := strings.SplitN(line, ":", 2)[0]; isSHA1Hex(h) {
+			p.blockedSHA1[strings.ToUpper(h)] = true
+			continue
+		}
+		p.blocked[strings.ToLower(norm.NFC.String(line))] = true
+	}
+	return scanner.Err()
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// normalizePassword returns the NFC normalization of password, so that the
+// same passphrase typed on different systems hashes the same way.
+func normalizePassword(password string) string {
+	return norm.NFC.String(password)
+}
+
+// Validate checks a normalized password against the policy.
+func (p *PasswordPolicy) Validate(password string) error {
+	if !utf8.ValidString(password) {
+		return errors.New("Password must be valid UTF-8")
+	}
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsControl(r):
+			return errors.New("Password must not contain control " +
+				"characters")
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	if strings.TrimSpace(password) != password {
+		return errors.New("Password must not begin or end with a space")
+	}
+	n := utf8.RuneCountInString(password)
+	if p.MaxLength == 0 && n < p.MinLength {
+		return fmt.Errorf("Password must contain at least %d characters",
+			p.MinLength)
+	}
+	if p.MaxLength > 0 && (n < p.MinLength || n > p.MaxLength) {
+		return fmt.Errorf(
+			"Password must contain between %d and %d characters",
+			p.MinLength, p.MaxLength)
+	}
+	if len(password) > bcryptMaxBytes {
+		return fmt.Errorf("Password must not be longer than %d bytes",
+			bcryptMaxBytes)
+	}
+	classes := 0
+	for _, c := range []bool{lower, upper, digit, other} {
+		if c {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		return fmt.Errorf("Password must contain at least %d of: "+
+			"lowercase letters, uppercase letters, digits, "+
+			"and other characters", p.MinClasses)
+	}
+	if p.blocked[strings.ToLower(password)] {
+		return errors.New("Password is too common")
+	}
+	if len(p.blockedSHA1) > 0 {
+		sum := sha1.Sum([]byte(password))
+		if p.blockedSHA1[strings.ToUpper(hex.EncodeToString(sum[:]))] {
+			return errors.New("Password has appeared in a data " +
+				"breach")
+		}
+	}
+	return nil
+}
+
+// externalPasswordError returns the error for an attempt to set the password
+// of an account that is authenticated by an external provider, whose
+// password is managed by the provider.
+func externalPasswordError(username, provider string) error {
+	return fmt.Errorf("User '%s' is authenticated by %s; the password "+
+		"must be changed there", username, provider)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 8, MaxLength: 12, MinClasses: 2}
+	for _, c := range []struct {
+		password, err string
+	}{
+		{"abcdefg1", ""},
+		{"naïve café 9", ""},
+		{"abc1", "between 8 and 12"},
+		{"abcdefghijk12", "between 8 and 12"},
+		{"abcdefgh", "at least 2 of"},
+		{" abcdefg1", "begin or end"},
+		{"abcd\tefg1", "control"},
+		{"abc\xffdefg1", "UTF-8"},
+	} {
+		err := p.Validate(c.password)
+		if (err == nil) != (c.err == "") ||
+			(err != nil && !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%q: error %v, want %q", c.password, err, c.err)
+		}
+	}
+	// Without a maximum, only the minimum is mentioned.
+	p = &PasswordPolicy{MinLength: 8}
+	if err := p.Validate("abc"); err == nil ||
+		err.Error() != "Password must contain at least 8 characters" {
+		t.Errorf("no maximum: error %v", err)
+	}
+	if err := p.Validate(strings.Repeat("a", 70)); err != nil {
+		t.Errorf("no maximum: error %v", err)
+	}
+	if err := p.Validate(strings.Repeat("a", 73)); err == nil {
+		t.Errorf("longer than bcrypt allows: no error")
+	}
+}
+
+func TestRequestPasswordResetExternal(t *testing.T) {
+	st := &personStorage{people: map[string]*testPerson{
+		"carol": {provider: "ldap", subject: "uid=carol"},
+	}}
+	_, err := RequestPasswordReset(st, nil, "carol")
+	if err == nil || !strings.Contains(err.Error(), "ldap") {
+		t.Errorf("carol: error %v", err)
+	}
+	if _, err = RequestPasswordReset(st, nil, "nobody"); err == nil {
+		t.Errorf("nobody: no error")
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// passwordResetExpiry is how long a password reset token remains valid.
+const passwordResetExpiry = 24 * time.Hour
+
+// ErrInvalidResetToken is returned by Storage.ResetPassword if the token does
+// not exist or has expired.
+var ErrInvalidResetToken = errors.New("Invalid or expired password reset token")
+
+// hashToken returns the hash under which a secret token, such as a password
+// reset or session token, is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestPasswordReset issues a password reset token for a user and sends it
+// to the user's email address.  Only a hash of the token is stored, so the
+// token cannot be recovered from the database.  Any earlier token for the
+// user is revoked.  Accounts authenticated by an external provider have no
+// password to reset.
+func RequestPasswordReset(storage Storage, mail MailSender,
+	username string) (string, error) {
+
+	provider, _, err := storage.LookupPersonProvider(username)
+	if err != nil {
+		return "", fmt.Errorf("User '%s' not found", username)
+	}
+	if provider != "" {
+		return "", externalPasswordError(username, provider)
+	}
+	email, err := storage.LookupEmail(username)
+	if err != nil {
+		return "", fmt.Errorf("User '%s' not found", username)
+	}
+	if email == "" {
+		return "", fmt.Errorf("User '%s' has no email address", username)
+	}
+	var b [32]byte
+	if _, err = rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b[:])
+	expires := time.Now().Add(passwordResetExpiry)
+	err = storage.AddPasswordReset(username, hashToken(token), expires)
+	if err != nil {
+		return "", err
+	}
+	body := fmt.Sprintf("A password reset was requested for the Glint "+
+		"account '%s'.\n\n"+
+		"To choose a new password, run:\n\n"+
+		"    glint passwd --reset-token %s\n\n"+
+		"This token expires at %s.\n",
+		username, token, expires.Format(time.RFC1123))
+	err = mail.Send(email, "Glint password reset", body)
+	if err != nil {
+		return "", fmt.Errorf("Error sending mail: %v", err)
+	}
+	return email, nil
+}
+
+func (srv *Server) handlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeMethodNotAllowed(w, r, "POST")
+		return
+	}
+	// Reset tokens are not guessable, but throttle clients that keep
+	// presenting invalid ones.
+	ip := remoteIP(r)
+	if wait, _ := srv.ipDelay(ip); wait > 0 {
+		w.Header().Set("Retry-After",
+			strconv.Itoa(int(wait/time.Second)+1))
+		writeError(w, http.StatusTooManyRequests,
+			"Too many failed attempts; try again later")
+		return
+	}
+	// Read the json request.
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	var p api.PasswordResetRequest
+	err = json.Unmarshal(body, &p)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	// Set the new password.
+	user, err := srv.storage.ResetPassword(hashToken(p.Token),
+		p.Password)
+	if err != nil {
+		if err == ErrInvalidResetToken {
+			srv.ipThrottle.fail(ip)
+		}
+		writeError(w, http.StatusBadRequest,
+			"Unable to reset password: "+err.Error())
+		return
+	}
+	srv.log("Password reset for user '%s'", user)
+	setAuditActor(w, user)
+	w.WriteHeader(http.StatusCreated)
+}
@@ -3,12 +3,15 @@ package server
 //package main
 
 import (
+	"crypto/sha256"
 	"database/sql"
-	"errors"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
 
+	"github.com/glintdb/glintweb/api"
 	// Blank import, temporary for PostgreSQL.
 	_ "github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
@@ -55,19 +58,7 @@ func (pg *Postgres) Close() error {
 }
 
 func validatePassword(password string) error {
-	// Check if all characters are ASCII printable.
-	for _, r := range password {
-		if r < 33 || r > 126 {
-			return errors.New("Password must consist of ASCII " +
-				"printable characters")
-		}
-	}
-	// Check password length.
-	if len(password) < 8 || len(password) > 32 {
-		return errors.New(
-			"Password must contain between 8 and 32 characters")
-	}
-	return nil
+	return passwordPolicy.Validate(password)
 }
 
 func (pg *Postgres) Connect(host, port, user, password, dbname string) error {
@@ -88,19 +79,48 @@ func (pg *Postgres) Connect(host, port, user, password, dbname string) error {
 }
 
 func schemaExists() (bool, error) {
+	return tableExists("person")
+}
+
+func tableExists(table string) (bool, error) {
 	var st *sql.Stmt
 	var err error
 	st, err = glintdb.Prepare(`
 		select table_name
 		    from information_schema.tables
-		    where table_schema = 'public' and table_name = 'person';
+		    where table_schema = 'public' and table_name = $1;
 		`)
 	if err != nil {
 		return false, err
 	}
 	defer st.Close()
 	var tableName string
-	err = st.QueryRow().Scan(&tableName)
+	err = st.QueryRow(table).Scan(&tableName)
+	switch err {
+	case nil:
+		return true, nil
+	case sql.ErrNoRows:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func columnExists(table string, column string) (bool, error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select column_name
+		    from information_schema.columns
+		    where table_schema = 'public' and table_name = $1 and
+		        column_name = $2;
+		`)
+	if err != nil {
+		return false, err
+	}
+	defer st.Close()
+	var columnName string
+	err = st.QueryRow(table, column).Scan(&columnName)
 	switch err {
 	case nil:
 		return true, nil
@@ -149,7 +169,7 @@ func (pg *Postgres) Authenticate(username string, password string) (bool, error)
 	}
 	// Hash password and compare with password_hash in database.
 	err = bcrypt.CompareHashAndPassword([]byte(password_hash),
-		[]byte(password))
+		[]byte(normalizePassword(password)))
 	if err != nil {
 		// The password hashes did not match.
 		return false, nil
@@ -170,7 +190,9 @@ func (pg *Postgres) CreateTablePerson(tx *sql.Tx) error {
 		    fullname text not null default '',
 		    email text not null default '',
 		    password_hash text not null default '',
-		    acct_disabled boolean not null default false
+		    acct_disabled boolean not null default false,
+		    auth_provider text not null default '',
+		    auth_subject text not null default ''
 		);
 		`)
 	if err != nil {
@@ -186,6 +208,7 @@ func (pg *Postgres) CreateTablePerson(tx *sql.Tx) error {
 
 func validateAndHashPassword(password string) (string, error) {
 	// Validate the new password.
+	password = normalizePassword(password)
 	var err = validatePassword(password)
 	if err != nil {
 		return "", err
@@ -200,8 +223,10 @@ func validateAndHashPassword(password string) (string, error) {
 	return string(hash), nil
 }
 
+// AddMetadata replaces the metadata of an attribute.  It returns
+// sql.ErrNoRows if the file has no such attribute.
 func (pg *Postgres) AddMetadata(personId int64, path string, attribute string,
-	metadata string) error {
+	metadata *api.AttributeMetadata) error {
 
 	var fileId int64
 	var err error
@@ -210,8 +235,11 @@ func (pg *Postgres) AddMetadata(personId int64, path string, attribute string,
 		return err
 	}
 
-	// TODO Check that user exists in table, because update does not
-	// consider 0 updates to be an error.
+	var md string
+	md, err = encodeMetadata(metadata)
+	if err != nil {
+		return err
+	}
 
 	var st *sql.Stmt
 	st, err = glintdb.Prepare(`
@@ -223,17 +251,109 @@ func (pg *Postgres) AddMetadata(personId int64, path string, attribute string,
 		return err
 	}
 	defer st.Close()
-	_, err = st.Exec(metadata, fileId, attribute)
+	var res sql.Result
+	res, err = st.Exec(md, fileId, attribute)
 	if err != nil {
 		return err
 	}
+	var n int64
+	n, err = res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
 
-func (pg *Postgres) ChangePassword(username string, password string) error {
+// AddMetadataBatch changes the metadata of several attributes of a file
+// within a transaction, so that either all or none are changed.  The
+// attributes are locked and merge is called with their current metadata,
+// keyed by attribute name; it returns the metadata to be replaced, or an
+// error, which is returned without changing anything.  AddMetadataBatch
+// returns sql.ErrNoRows if the file lacks any of the attributes returned.
+func (pg *Postgres) AddMetadataBatch(personId int64, path string,
+	merge MetadataMerge) error {
+	var fileId int64
+	var err error
+	fileId, err = pg.LookupFileId(personId, path)
+	if err != nil {
+		return err
+	}
+	var tx *sql.Tx
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	var rows *sql.Rows
+	rows, err = tx.Query(`
+		select attr, metadata
+		    from attribute
+		    where file_id = $1
+		    for update;
+		`, fileId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var current = make(map[string]*api.AttributeMetadata)
+	for rows.Next() {
+		var attr, md string
+		if err = rows.Scan(&attr, &md); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		var m = decodeMetadata(md)
+		current[attr] = &m
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var metadata map[string]*api.AttributeMetadata
+	metadata, err = merge(current)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for attr, m := range metadata {
+		var md string
+		md, err = encodeMetadata(m)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		var res sql.Result
+		res, err = tx.Exec(`
+			update attribute
+			    set metadata = $1
+			    where file_id = $2 and attr = $3;
+			`, md, fileId, attr)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		var n int64
+		n, err = res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n == 0 {
+			tx.Rollback()
+			return sql.ErrNoRows
+		}
+	}
+	return tx.Commit()
+}
 
-	// TODO Check that user exists in table, because update does not
-	// consider 0 updates to be an error.
+// ChangePassword sets the password of a user and revokes the user's
+// sessions.  The passwords of users who are authenticated by an external
+// provider cannot be set.
+func (pg *Postgres) ChangePassword(username string, password string) error {
 
 	// Validate and hash password.
 	var hash string
@@ -243,21 +363,48 @@ func (pg *Postgres) ChangePassword(username string, password string) error {
 		return err
 	}
 	// Store in the database.
-	var st *sql.Stmt
-	st, err = glintdb.Prepare(`
+	var tx *sql.Tx
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	var provider string
+	err = tx.QueryRow(`
+		select auth_provider
+		    from person
+		    where username = $1
+		    for update;
+		`, username).Scan(&provider)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return fmt.Errorf("User '%s' not found", username)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if provider != "" {
+		tx.Rollback()
+		return externalPasswordError(username, provider)
+	}
+	_, err = tx.Exec(`
 		update person
 		    set password_hash = $1
 		    where username = $2;
-		`)
+		`, hash, username)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-	defer st.Close()
-	_, err = st.Exec(hash, username)
+	_, err = tx.Exec(`
+		delete from session
+		    where person_id = (select id from person where username = $1);
+		`, username)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
 func (pg *Postgres) LookupPersonId(username string) (int64, error) {
@@ -313,6 +460,87 @@ func (pg *Postgres) AddPerson(username string, fullname string, email string,
 	// TODO Return id.
 }
 
+// AddExternalPerson adds a user who is authenticated by an external provider,
+// recording the provider and the user's subject identifier there.  No
+// password hash is stored, so the user cannot log in with a local password.
+func (pg *Postgres) AddExternalPerson(username string, fullname string,
+	email string, provider string, subject string) error {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		insert into person (username, fullname, email, auth_provider,
+		        auth_subject)
+		values ($1, $2, $3, $4, $5);
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec(username, fullname, email, provider, subject)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// LookupPersonProvider returns the external provider that authenticates a
+// user and the user's subject identifier there, which are empty for a local
+// user.
+func (pg *Postgres) LookupPersonProvider(username string) (string, string,
+	error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select auth_provider, auth_subject
+		    from person
+		    where username = $1;
+		`)
+	if err != nil {
+		return "", "", err
+	}
+	defer st.Close()
+	var provider, subject string
+	err = st.QueryRow(username).Scan(&provider, &subject)
+	if err != nil {
+		return "", "", err
+	}
+	return provider, subject, nil
+}
+
+// BindExternalPerson binds an account to an external provider and subject,
+// for users who were provisioned before they were recorded.  Only an account
+// with no provider and no local password can be bound; sql.ErrNoRows is
+// returned otherwise.
+func (pg *Postgres) BindExternalPerson(username string, provider string,
+	subject string) error {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		update person
+		    set auth_provider = $2, auth_subject = $3
+		    where username = $1 and auth_provider = '' and
+		          password_hash = '';
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	var res sql.Result
+	res, err = st.Exec(username, provider, subject)
+	if err != nil {
+		return err
+	}
+	var n int64
+	n, err = res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (pg *Postgres) LookupFileId(personId int64, path string) (int64, error) {
 	var st *sql.Stmt
 	var err error
@@ -337,14 +565,14 @@ func (pg *Postgres) LookupFileId(personId int64, path string) (int64, error) {
 	}
 }
 
-func (pg *Postgres) LookupMetadata(personId int64, path string, attribute string) (string,
-	error) {
+func (pg *Postgres) LookupMetadata(personId int64, path string, attribute string) (
+	*api.AttributeMetadata, error) {
 
 	var fileId int64
 	var err error
 	fileId, err = pg.LookupFileId(personId, path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	var st *sql.Stmt
@@ -354,22 +582,16 @@ func (pg *Postgres) LookupMetadata(personId int64, path string, attribute string
 		    where file_id = $1 and attr = $2;
 		`)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer st.Close()
 	var metadata string
 	err = st.QueryRow(fileId, attribute).Scan(&metadata)
-	switch err {
-	case nil:
-		if metadata == "" {
-			return "", nil
-		}
-		return "{" + metadata + "}", nil
-	case sql.ErrNoRows:
-		return "", err
-	default:
-		return "", err
+	if err != nil {
+		return nil, err
 	}
+	var md api.AttributeMetadata = decodeMetadata(metadata)
+	return &md, nil
 }
 
 func (pg *Postgres) LookupData(person_id int64, path string) (string, error) {
@@ -428,13 +650,14 @@ func (pg *Postgres) LookupDataList(person_id int64) (string, error) {
 	return b.String(), nil
 }
 
-func (pg *Postgres) AddFile(person_id int64, path string, data string) (int64, error) {
+func (pg *Postgres) AddFile(person_id int64, path string, data string,
+	hash string) (int64, error) {
 	// Store in the database.
 	var st *sql.Stmt
 	var err error
 	st, err = glintdb.Prepare(`
-                insert into file (person_id, path, data)
-                values ($1, $2, $3)
+                insert into file (person_id, path, data, hash, size, nrows)
+                values ($1, $2, $3, $4, $5, $6)
                 returning id;
 		`)
 	if err != nil {
@@ -442,7 +665,8 @@ func (pg *Postgres) AddFile(person_id int64, path string, data string) (int64, e
 	}
 	defer st.Close()
 	var id int64
-	err = st.QueryRow(person_id, path, data).Scan(&id)
+	err = st.QueryRow(person_id, path, data, hash, len(data),
+		countRows(data)).Scan(&id)
 	switch err {
 	case nil:
 		return id, nil
@@ -453,6 +677,224 @@ func (pg *Postgres) AddFile(person_id int64, path string, data string) (int64, e
 	}
 }
 
+// StoreFile adds a file, or replaces an existing one, with its attributes,
+// descriptive metadata, and derivation, and records a new revision, all
+// within one transaction.  It returns the id of the file and the ARK of the
+// revision.  Metadata are kept for replaced attributes that have the same
+// name as before.
+func (pg *Postgres) StoreFile(f *StoredFile) (int64, string, error) {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	var id int64 = f.FileId
+	if id == 0 {
+		err = tx.QueryRow(`
+			insert into file (person_id, path, data, hash, size,
+			        nrows)
+			values ($1, $2, $3, $4, $5, $6)
+			returning id;
+			`, f.PersonId, f.Path, f.Data, f.Hash, len(f.Data),
+			countRows(f.Data)).Scan(&id)
+		if err != nil {
+			tx.Rollback()
+			return 0, "", err
+		}
+		err = addAttributes(tx, id, f.Attributes)
+	} else {
+		err = replaceFile(tx, id, f.Data, f.Hash, f.Attributes)
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, "", err
+	}
+	if f.Metadata != nil {
+		err = setDatasetMetadata(tx, id, f.Metadata)
+		if err != nil {
+			tx.Rollback()
+			return 0, "", err
+		}
+	}
+	var ark string
+	ark, err = addRevision(tx, id, f.Mint)
+	if err != nil {
+		tx.Rollback()
+		return 0, "", err
+	}
+	if f.Derivation != nil {
+		var d api.Derivation = *f.Derivation
+		d.Ark = ark
+		err = addDerivation(tx, id, &d)
+		if err != nil {
+			tx.Rollback()
+			return 0, "", err
+		}
+	}
+	for attr, metadata := range f.AttributeMetadata {
+		var md string
+		md, err = encodeMetadata(metadata)
+		if err == nil {
+			_, err = tx.Exec(`
+				update attribute
+				    set metadata = $1
+				    where file_id = $2 and attr = $3;
+				`, md, id, attr)
+		}
+		if err != nil {
+			tx.Rollback()
+			return 0, "", err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, "", err
+	}
+	return id, ark, nil
+}
+
+// ReplaceFile replaces the data and attributes of an existing file.
+// Metadata are kept for attributes that have the same name as before.
+func (pg *Postgres) ReplaceFile(fileId int64, data string, hash string,
+	attrs []string) error {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	err = replaceFile(tx, fileId, data, hash, attrs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceFile replaces the data and attributes of an existing file within
+// a transaction, as in ReplaceFile.
+func replaceFile(tx *sql.Tx, fileId int64, data string, hash string,
+	attrs []string) error {
+	var err error
+	_, err = tx.Exec(`
+		update file
+		    set data = $1, hash = $2, modified = current_timestamp,
+		        size = $4, nrows = $5
+		    where id = $3;
+		`, data, hash, fileId, len(data), countRows(data))
+	if err != nil {
+		return err
+	}
+	var rows *sql.Rows
+	rows, err = tx.Query(`
+		select attr, metadata from attribute where file_id = $1;
+		`, fileId)
+	if err != nil {
+		return err
+	}
+	var metadata = make(map[string]string)
+	for rows.Next() {
+		var attr, md string
+		if err = rows.Scan(&attr, &md); err != nil {
+			rows.Close()
+			return err
+		}
+		metadata[attr] = md
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	// Attributes are reinserted so that their order matches the data.
+	_, err = tx.Exec(`
+		delete from attribute where file_id = $1;
+		`, fileId)
+	if err != nil {
+		return err
+	}
+	var x int
+	for x = range attrs {
+		_, err = tx.Exec(`
+			insert into attribute (file_id, attr, metadata)
+			values ($1, $2, $3);
+			`, fileId, attrs[x], metadata[attrs[x]])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendFile adds rows to a file within a transaction, so that concurrent
+// appends are not lost.  If key is not empty, rows whose key value is
+// already present are skipped.  The number of rows added is returned.  The
+// data no longer match a source file, so the hash of the file becomes the
+// hash of the stored data, which still changes whenever the data do.
+func (pg *Postgres) AppendFile(fileId int64, rows [][]string, key string) (int,
+	error) {
+	var added int
+	var err error
+	added, _, err = pg.StoreAppend(fileId, rows, key, nil)
+	return added, err
+}
+
+// StoreAppend adds rows to a file as AppendFile does.  If any rows are
+// added and mint is not nil, a revision is recorded with an ARK from mint
+// in the same transaction.  The number of rows added and the ARK are
+// returned.
+func (pg *Postgres) StoreAppend(fileId int64, rows [][]string, key string,
+	mint func() (string, error)) (int, string, error) {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	var data string
+	err = tx.QueryRow(`
+		select data from file where id = $1 for update;
+		`, fileId).Scan(&data)
+	if err != nil {
+		tx.Rollback()
+		return 0, "", err
+	}
+	var added int
+	var ark string
+	data, added, err = appendRows(data, rows, key)
+	if err != nil {
+		tx.Rollback()
+		return 0, "", err
+	}
+	if added > 0 {
+		var sum = sha256.Sum256([]byte(data))
+		_, err = tx.Exec(`
+			update file
+			    set data = $1, hash = $5,
+			        modified = current_timestamp,
+			        size = $3, nrows = $4
+			    where id = $2;
+			`, data, fileId, len(data), countRows(data),
+			hex.EncodeToString(sum[:]))
+		if err != nil {
+			tx.Rollback()
+			return 0, "", err
+		}
+		if mint != nil {
+			ark, err = addRevision(tx, fileId, mint)
+		}
+		if err != nil {
+			tx.Rollback()
+			return 0, "", err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, "", err
+	}
+	return added, ark, nil
+}
+
 func deleteFromAttribute(fileId int64) error {
 	var st *sql.Stmt
 	var err error
@@ -507,32 +949,67 @@ func (pg *Postgres) DeleteFile(personId int64, path string) error {
 	return nil
 }
 
+// AddDatasetMetadata replaces the descriptive metadata of a file.
+func (pg *Postgres) AddDatasetMetadata(fileId int64,
+	metadata *api.DatasetMetadata) error {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	err = setDatasetMetadata(tx, fileId, metadata)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// setDatasetMetadata replaces the descriptive metadata of a file within a
+// transaction.
+func setDatasetMetadata(tx *sql.Tx, fileId int64,
+	metadata *api.DatasetMetadata) error {
+	var b []byte
+	var err error
+	b, err = json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		update file
+		    set metadata = $1
+		    where id = $2;
+		`, string(b), fileId)
+	return err
+}
+
 func (pg *Postgres) AddAttributes(file_id int64, attrs []string) error {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	err = addAttributes(tx, file_id, attrs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func addAttributes(tx *sql.Tx, fileId int64, attrs []string) error {
+	var err error
 	var x int
 	for x = range attrs {
-		// Store in the database.
-		var st *sql.Stmt
-		var err error
-		st, err = glintdb.Prepare(`
-                        insert into attribute
-                            (file_id, attr)
-                            values ($1, $2)
-                            returning id;
-		`)
+		_, err = tx.Exec(`
+			insert into attribute (file_id, attr)
+			values ($1, $2);
+			`, fileId, attrs[x])
 		if err != nil {
 			return err
 		}
-		defer st.Close()
-		var id int64
-		err = st.QueryRow(file_id, attrs[x]).Scan(&id)
-		switch err {
-		case nil:
-			continue
-		case sql.ErrNoRows:
-			return err
-		default:
-			return err
-		}
 	}
 	return nil
 }
@@ -576,7 +1053,13 @@ func (pg *Postgres) CreateTableFile(tx *sql.Tx) error {
 		        check (path <> ''),
 		    unique (person_id, path),
 		    data text not null,
-		        check (data <> '')
+		        check (data <> ''),
+		    modified timestamp with time zone not null
+		        default current_timestamp,
+		    hash text not null default '',
+		    metadata text not null default '',
+		    size bigint not null default -1,
+		    nrows bigint not null default -1
 		);
 		`)
 	if err != nil {
@@ -640,6 +1123,150 @@ func (pg *Postgres) Setup() error {
 			return err
 		}
 	}
+	// Create any tables that have been added since the schema was
+	// created.
+	err = pg.createMissingTables()
+	if err != nil {
+		return err
+	}
+	err = pg.addMissingColumns()
+	if err != nil {
+		return err
+	}
+	err = pg.addMissingFileStats()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// createMissingTables creates tables that were added to the schema after
+// the initial version, so that existing databases are upgraded in place.
+func (pg *Postgres) createMissingTables() error {
+	var tables = []struct {
+		name   string
+		create func(tx *sql.Tx) error
+	}{
+		{"login_failure", pg.createTableLoginFailure},
+		{"login_unlock", pg.createTableLoginUnlock},
+		{"password_reset", pg.createTablePasswordReset},
+		{"audit_event", pg.createTableAuditEvent},
+		{"session", pg.createTableSession},
+		{"revision", pg.createTableRevision},
+		{"derivation", pg.createTableDerivation},
+	}
+	var x int
+	for x = range tables {
+		var exists bool
+		var err error
+		exists, err = tableExists(tables[x].name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		log.Printf("Creating table %s", tables[x].name)
+		var tx *sql.Tx
+		tx, err = glintdb.Begin()
+		if err != nil {
+			return err
+		}
+		err = tables[x].create(tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMissingColumns adds columns that were added to existing tables after
+// the initial version of the schema.
+func (pg *Postgres) addMissingColumns() error {
+	var columns = []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"file", "modified", "timestamp with time zone not null " +
+			"default current_timestamp"},
+		{"file", "hash", "text not null default ''"},
+		{"file", "metadata", "text not null default ''"},
+		{"file", "size", "bigint not null default -1"},
+		{"file", "nrows", "bigint not null default -1"},
+		{"person", "auth_provider", "text not null default ''"},
+		{"person", "auth_subject", "text not null default ''"},
+	}
+	var x int
+	for x = range columns {
+		var exists bool
+		var err error
+		exists, err = columnExists(columns[x].table, columns[x].column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		log.Printf("Adding column %s.%s", columns[x].table,
+			columns[x].column)
+		_, err = glintdb.Exec("alter table " + columns[x].table +
+			" add column " + columns[x].column + " " +
+			columns[x].definition + ";")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMissingFileStats stores the size and number of rows of files that were
+// written before they were stored.
+func (pg *Postgres) addMissingFileStats() error {
+	var rows *sql.Rows
+	var err error
+	rows, err = glintdb.Query(`
+		select id from file where size < 0 or nrows < 0;
+		`)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		log.Printf("Counting rows of %d data sets", len(ids))
+	}
+	for _, id := range ids {
+		var data string
+		err = glintdb.QueryRow(`
+			select data from file where id = $1;
+			`, id).Scan(&data)
+		if err != nil {
+			return err
+		}
+		_, err = glintdb.Exec(`
+			update file set size = $1, nrows = $2 where id = $3;
+			`, len(data), countRows(data), id)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func (pg *Postgres) createTableRevision(tx *sql.Tx) error {
+	var st *sql.Stmt
+	var err error
+	st, err = tx.Prepare(`
+		create table revision (
+		    id bigserial not null,
+		        primary key (id),
+		    ark text not null,
+		        unique (ark),
+		    file_id bigint,
+		        foreign key (file_id) references file (id)
+		            on delete set null,
+		    person_id bigint not null,
+		        foreign key (person_id) references person (id),
+		    path text not null,
+		    hash text not null default '',
+		    created timestamp with time zone not null
+		        default current_timestamp
+		);
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		create index on revision (file_id);
+		`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddRevision records a revision of a file, identified by an ARK from
+// mint, with the file's current path and hash, and returns the ARK.
+func (pg *Postgres) AddRevision(fileId int64,
+	mint func() (string, error)) (string, error) {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return "", err
+	}
+	var ark string
+	ark, err = addRevision(tx, fileId, mint)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	return ark, nil
+}
+
+// addRevision records a revision of a file within a transaction, as in
+// AddRevision.  A new ARK is tried if the first one happens to be in use.
+func addRevision(tx *sql.Tx, fileId int64,
+	mint func() (string, error)) (string, error) {
+	var try int
+	for try = 0; try < 3; try++ {
+		var ark string
+		var err error
+		ark, err = mint()
+		if err != nil {
+			return "", err
+		}
+		var used bool
+		err = tx.QueryRow(`
+			select exists (select 1 from revision where ark = $1);
+			`, ark).Scan(&used)
+		if err != nil {
+			return "", err
+		}
+		if used {
+			continue
+		}
+		var res sql.Result
+		res, err = tx.Exec(`
+			insert into revision (ark, file_id, person_id, path,
+			        hash)
+			    select $1, id, person_id, path, hash
+			        from file
+			        where id = $2;
+			`, ark, fileId)
+		if err != nil {
+			return "", err
+		}
+		var n int64
+		n, err = res.RowsAffected()
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			return "", sql.ErrNoRows
+		}
+		return ark, nil
+	}
+	return "", fmt.Errorf("Unable to mint an unused ARK")
+}
+
+// LookupRevision returns the revision identified by ark.
+func (pg *Postgres) LookupRevision(ark string) (*Revision, error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select r.ark,
+		       p.username,
+		       coalesce(f.path, r.path),
+		       r.hash,
+		       r.created,
+		       f.id is null,
+		       coalesce((select l.ark
+		                     from revision l
+		                     where l.file_id = r.file_id
+		                     order by l.id desc
+		                     limit 1), r.ark),
+		       coalesce(f.metadata, '')
+		    from revision r
+		        join person p on p.id = r.person_id
+		        left join file f on f.id = r.file_id
+		    where r.ark = $1;
+		`)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	var rev Revision
+	var metadata string
+	err = st.QueryRow(ark).Scan(&rev.Ark, &rev.User, &rev.Path, &rev.Hash,
+		&rev.Created, &rev.Deleted, &rev.Latest, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	rev.Metadata = decodeDatasetMetadata(metadata)
+	return &rev, nil
+}
+
+// LookupFilesWithoutRevision returns the ids of files for which no
+// revision has been recorded, such as files added before revisions were.
+func (pg *Postgres) LookupFilesWithoutRevision() ([]int64, error) {
+	var rows *sql.Rows
+	var err error
+	rows, err = glintdb.Query(`
+		select f.id
+		    from file f
+		    where not exists (select 1
+		                          from revision r
+		                          where r.file_id = f.id)
+		    order by f.id;
+		`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// createTableAuditEvent creates the audit_event table.  Rules prevent rows
+// from being updated or deleted, so that the table is append-only.
+func (pg *Postgres) createTableAuditEvent(tx *sql.Tx) error {
+	var stmts = []string{`
+		create table audit_event (
+		    id bigserial not null,
+		        primary key (id),
+		    time timestamp with time zone not null
+		        default current_timestamp,
+		    actor text not null default '',
+		    ip text not null default '',
+		    action text not null,
+		    target text not null default '',
+		    outcome text not null,
+		    detail text not null default ''
+		);
+		`, `
+		create index on audit_event (time);
+		`, `
+		create rule audit_event_no_update as
+		    on update to audit_event do instead nothing;
+		`, `
+		create rule audit_event_no_delete as
+		    on delete to audit_event do instead nothing;
+		`}
+	var x int
+	for x = range stmts {
+		var err error
+		_, err = tx.Exec(stmts[x])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pg *Postgres) AddAuditEvent(e *AuditEvent) error {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		insert into audit_event
+		    (actor, ip, action, target, outcome, detail)
+		    values ($1, $2, $3, $4, $5, $6)
+		    returning id, time;
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	err = st.QueryRow(e.Actor, e.IP, e.Action, e.Target, e.Outcome,
+		e.Detail).Scan(&e.Id, &e.Time)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// LookupAuditEvents returns the audit events selected by f, most recent
+// first.
+func (pg *Postgres) LookupAuditEvents(f *AuditFilter) ([]AuditEvent, error) {
+	var where []string
+	var args []interface{}
+	var cond = func(c string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(c, len(args)))
+	}
+	if f.Actor != "" {
+		cond("actor = $%d", f.Actor)
+	}
+	if f.Action != "" {
+		cond("action = $%d", f.Action)
+	}
+	if f.Target != "" {
+		var r = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+		cond("target like $%d", r.Replace(f.Target)+"%")
+	}
+	if !f.Since.IsZero() {
+		cond("time >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		cond("time < $%d", f.Until)
+	}
+	var q = "select id, time, actor, ip, action, target, outcome, detail " +
+		"from audit_event"
+	if len(where) > 0 {
+		q += " where " + strings.Join(where, " and ")
+	}
+	q += " order by time desc, id desc"
+	if f.Limit > 0 {
+		q += fmt.Sprintf(" limit %d", f.Limit)
+	}
+	var rows *sql.Rows
+	var err error
+	rows, err = glintdb.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		err = rows.Scan(&e.Id, &e.Time, &e.Actor, &e.IP, &e.Action,
+			&e.Target, &e.Outcome, &e.Detail)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// fileInfoQuery selects file statistics and attributes, for all users if
+// the person id is 0.  Files are selected in pages of $3 files starting at
+// offset $4, or all files if $3 is 0.
+const fileInfoQuery = `
+	with page as (
+	    select f.id
+	        from file f
+	            join person p on p.id = f.person_id
+	        where ($1 = 0 or f.person_id = $1) and
+	              ($2 = '' or f.path = $2)
+	        order by p.username, f.path
+	        limit nullif($3::bigint, 0) offset $4
+	)
+	select f.id,
+	       p.username,
+	       f.path,
+	       f.size,
+	       f.nrows,
+	       f.modified,
+	       f.hash,
+	       f.metadata,
+	       coalesce((select r.ark
+	                     from revision r
+	                     where r.file_id = f.id
+	                     order by r.id desc
+	                     limit 1), ''),
+	       coalesce(a.attr, ''),
+	       coalesce(a.metadata, '')
+	    from page
+	        join file f on f.id = page.id
+	        join person p on p.id = f.person_id
+	        left join attribute a on a.file_id = f.id
+	    order by p.username, f.path, a.id;
+	`
+
+func lookupFileInfo(personId int64, path string, offset, limit int) (
+	[]FileInfo, error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(fileInfoQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	var rows *sql.Rows
+	rows, err = st.Query(personId, path, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var files []FileInfo
+	for rows.Next() {
+		var user, p, hash, fileMetadata, ark, attr, metadata string
+		var id, size, nrows int64
+		var modified time.Time
+		err = rows.Scan(&id, &user, &p, &size, &nrows, &modified, &hash,
+			&fileMetadata, &ark, &attr, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 || files[len(files)-1].Id != id {
+			files = append(files, FileInfo{
+				Id:       id,
+				User:     user,
+				Path:     p,
+				Size:     size,
+				Rows:     nrows,
+				Modified: modified,
+				Hash:     hash,
+				Metadata: decodeDatasetMetadata(fileMetadata),
+				Ark:      ark,
+			})
+		}
+		if attr != "" {
+			var f *FileInfo = &files[len(files)-1]
+			f.Attributes = append(f.Attributes, AttributeInfo{
+				Name:     attr,
+				Metadata: decodeMetadata(metadata),
+			})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// LookupFileInfoList returns statistics and attributes for all of a user's
+// files, ordered by path.
+func (pg *Postgres) LookupFileInfoList(personId int64) ([]FileInfo, error) {
+	return lookupFileInfo(personId, "", 0, 0)
+}
+
+// LookupAllFileInfo returns statistics and attributes for the files of all
+// users, ordered by user and path.
+func (pg *Postgres) LookupAllFileInfo() ([]FileInfo, error) {
+	return lookupFileInfo(0, "", 0, 0)
+}
+
+// LookupFileInfoPage returns statistics and attributes for limit files of
+// all users starting at offset, ordered by user and path, and the total
+// number of files.
+func (pg *Postgres) LookupFileInfoPage(offset, limit int) ([]FileInfo, int,
+	error) {
+	var total int
+	var err error
+	err = glintdb.QueryRow(`
+		select count(*) from file;
+		`).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	var files []FileInfo
+	files, err = lookupFileInfo(0, "", offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
+
+// LookupFileInfo returns statistics and attributes for a file.
+func (pg *Postgres) LookupFileInfo(personId int64, path string) (*FileInfo,
+	error) {
+	if path == "" {
+		return nil, sql.ErrNoRows
+	}
+	var files []FileInfo
+	var err error
+	files, err = lookupFileInfo(personId, path, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &files[0], nil
+}
+
+// decodeDatasetMetadata reads the descriptive metadata of a file as stored
+// in the database, returning nil if there are none.
+func decodeDatasetMetadata(s string) *api.DatasetMetadata {
+	if s == "" {
+		return nil
+	}
+	var md api.DatasetMetadata
+	if json.Unmarshal([]byte(s), &md) != nil {
+		return nil
+	}
+	return &md
+}
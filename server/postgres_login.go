@@ -0,0 +1,501 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (pg *Postgres) createTableLoginFailure(tx *sql.Tx) error {
+	var st *sql.Stmt
+	var err error
+	st, err = tx.Prepare(`
+		create table login_failure (
+		    username text not null,
+		        primary key (username),
+		    failures integer not null default 0,
+		    last_failure timestamp with time zone not null
+		        default current_timestamp
+		);
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// LookupLoginFailures returns the number of consecutive failed logins for a
+// username and the time of the most recent one.  A username with no failed
+// logins returns 0.
+func (pg *Postgres) LookupLoginFailures(username string) (int, time.Time,
+	error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select failures, last_failure
+		    from login_failure
+		    where username = $1;
+		`)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer st.Close()
+	var failures int
+	var last time.Time
+	err = st.QueryRow(username).Scan(&failures, &last)
+	switch err {
+	case nil:
+		return failures, last, nil
+	case sql.ErrNoRows:
+		return 0, time.Time{}, nil
+	default:
+		return 0, time.Time{}, err
+	}
+}
+
+// RecordLoginFailure increments the count of consecutive failed logins for a
+// username.  Nothing is recorded for usernames that have no account, so that
+// guessed usernames do not fill the table.
+func (pg *Postgres) RecordLoginFailure(username string) error {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	var res sql.Result
+	res, err = tx.Exec(`
+		update login_failure
+		    set failures = failures + 1,
+		        last_failure = current_timestamp
+		    where username = $1;
+		`, username)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var n int64
+	n, err = res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		_, err = tx.Exec(`
+			insert into login_failure (username, failures)
+			    select username, 1
+			        from person
+			        where username = $1;
+			`, username)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ResetLoginFailures clears the failed login count for a username, which
+// also removes any lockout.
+func (pg *Postgres) ResetLoginFailures(username string) error {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		delete from login_failure where username = $1;
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec(username)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *Postgres) createTableLoginUnlock(tx *sql.Tx) error {
+	var st *sql.Stmt
+	var err error
+	st, err = tx.Prepare(`
+		create table login_unlock (
+		    address text not null,
+		        primary key (address),
+		    unlocked timestamp with time zone not null
+		        default current_timestamp
+		);
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UnlockAddress records that failed logins from a client IP address before
+// now are to be forgotten.  The failures themselves are counted by the
+// server in memory.
+func (pg *Postgres) UnlockAddress(ip string) error {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		delete from login_unlock where address = $1;
+		`, ip)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`
+		insert into login_unlock (address) values ($1);
+		`, ip)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// LookupAddressUnlock returns the time a client IP address was last
+// unlocked, or the zero time if it never was.
+func (pg *Postgres) LookupAddressUnlock(ip string) (time.Time, error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select unlocked
+		    from login_unlock
+		    where address = $1;
+		`)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer st.Close()
+	var unlocked time.Time
+	err = st.QueryRow(ip).Scan(&unlocked)
+	switch err {
+	case nil:
+		return unlocked, nil
+	case sql.ErrNoRows:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, err
+	}
+}
+
+// LookupAccountDisabled returns true if the account for username has been
+// disabled.
+func (pg *Postgres) LookupAccountDisabled(username string) (bool, error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select acct_disabled
+		    from person
+		    where username = $1;
+		`)
+	if err != nil {
+		return false, err
+	}
+	defer st.Close()
+	var disabled bool
+	err = st.QueryRow(username).Scan(&disabled)
+	if err != nil {
+		return false, err
+	}
+	return disabled, nil
+}
+
+// SetAccountDisabled disables or re-enables the account for username.
+func (pg *Postgres) SetAccountDisabled(username string, disabled bool) error {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		update person
+		    set acct_disabled = $1
+		    where username = $2;
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	var res sql.Result
+	res, err = st.Exec(disabled, username)
+	if err != nil {
+		return err
+	}
+	var n int64
+	n, err = res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("User '" + username + "' not found")
+	}
+	return nil
+}
+
+func (pg *Postgres) createTablePasswordReset(tx *sql.Tx) error {
+	var st *sql.Stmt
+	var err error
+	st, err = tx.Prepare(`
+		create table password_reset (
+		    token_hash text not null,
+		        primary key (token_hash),
+		    person_id bigint not null,
+		        foreign key (person_id) references person (id),
+		    expires timestamp with time zone not null
+		);
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// LookupEmail returns the email address of a user.
+func (pg *Postgres) LookupEmail(username string) (string, error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select email
+		    from person
+		    where username = $1;
+		`)
+	if err != nil {
+		return "", err
+	}
+	defer st.Close()
+	var email string
+	err = st.QueryRow(username).Scan(&email)
+	if err != nil {
+		return "", err
+	}
+	return email, nil
+}
+
+// AddPasswordReset stores the hash of a password reset token for a user.
+// Any earlier tokens for the user are removed.
+func (pg *Postgres) AddPasswordReset(username string, tokenHash string,
+	expires time.Time) error {
+	var personId int64
+	var err error
+	personId, err = pg.LookupPersonId(username)
+	if err != nil {
+		return err
+	}
+	var tx *sql.Tx
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		delete from password_reset where person_id = $1;
+		`, personId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`
+		insert into password_reset (token_hash, person_id, expires)
+		values ($1, $2, $3);
+		`, tokenHash, personId, expires)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetPassword sets a new password for the user who was issued the password
+// reset token with hash tokenHash, provided that the token has not expired,
+// the account is not disabled, and the account is not authenticated by an
+// external provider.  The token can be used only once.  The username is
+// returned.
+func (pg *Postgres) ResetPassword(tokenHash string, password string) (string,
+	error) {
+	var hash string
+	var err error
+	hash, err = validateAndHashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	var tx *sql.Tx
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return "", err
+	}
+	var personId int64
+	var username string
+	var disabled bool
+	var provider string
+	err = tx.QueryRow(`
+		select p.id, p.username, p.acct_disabled, p.auth_provider
+		    from password_reset r
+		        join person p on r.person_id = p.id
+		    where r.token_hash = $1 and r.expires > current_timestamp
+		    for update;
+		`, tokenHash).Scan(&personId, &username, &disabled, &provider)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return "", ErrInvalidResetToken
+	}
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if disabled {
+		tx.Rollback()
+		return "", errors.New("Account disabled")
+	}
+	if provider != "" {
+		tx.Rollback()
+		return "", externalPasswordError(username, provider)
+	}
+	_, err = tx.Exec(`
+		delete from password_reset where person_id = $1;
+		`, personId)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	_, err = tx.Exec(`
+		update person
+		    set password_hash = $1
+		    where id = $2;
+		`, hash, personId)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	_, err = tx.Exec(`
+		delete from login_failure where username = $1;
+		`, username)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	_, err = tx.Exec(`
+		delete from session where person_id = $1;
+		`, personId)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+func (pg *Postgres) createTableSession(tx *sql.Tx) error {
+	var st *sql.Stmt
+	var err error
+	st, err = tx.Prepare(`
+		create table session (
+		    token_hash text not null,
+		        primary key (token_hash),
+		    person_id bigint not null,
+		        foreign key (person_id) references person (id),
+		    created timestamp with time zone not null
+		        default current_timestamp,
+		    expires timestamp with time zone not null
+		);
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddSession stores the hash of a session token for a user.  Expired
+// sessions of all users are removed at the same time.
+func (pg *Postgres) AddSession(username string, tokenHash string,
+	expires time.Time) error {
+	var personId int64
+	var err error
+	personId, err = pg.LookupPersonId(username)
+	if err != nil {
+		return err
+	}
+	var tx *sql.Tx
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		delete from session where expires <= current_timestamp;
+		`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`
+		insert into session (token_hash, person_id, expires)
+		values ($1, $2, $3);
+		`, tokenHash, personId, expires)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// LookupSession returns the username of the owner of a session token that
+// has not expired, or sql.ErrNoRows.
+func (pg *Postgres) LookupSession(tokenHash string) (string, error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select p.username
+		    from session s
+		        join person p on s.person_id = p.id
+		    where s.token_hash = $1 and s.expires > current_timestamp;
+		`)
+	if err != nil {
+		return "", err
+	}
+	defer st.Close()
+	var username string
+	err = st.QueryRow(tokenHash).Scan(&username)
+	if err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+// DeleteSession revokes a session token.
+func (pg *Postgres) DeleteSession(tokenHash string) error {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		delete from session where token_hash = $1;
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec(tokenHash)
+	return err
+}
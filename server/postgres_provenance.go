@@ -0,0 +1,131 @@
+package server
+
+import (
+	"database/sql"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+func (pg *Postgres) createTableDerivation(tx *sql.Tx) error {
+	var st *sql.Stmt
+	var err error
+	st, err = tx.Prepare(`
+		create table derivation (
+		    id bigserial not null,
+		        primary key (id),
+		    file_id bigint not null,
+		        foreign key (file_id) references file (id)
+		            on delete cascade,
+		    ark text not null,
+		    person_id bigint not null,
+		        foreign key (person_id) references person (id),
+		    source text not null,
+		    source_ark text not null default '',
+		    command text not null,
+		    started timestamp with time zone not null,
+		    ended timestamp with time zone not null
+		);
+		`)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	_, err = st.Exec()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		create index on derivation (file_id);
+		`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddDerivation records that the revision d.Ark of a file was derived by
+// the user d.Agent from the data set d.Source with d.Command.
+func (pg *Postgres) AddDerivation(fileId int64, d *api.Derivation) error {
+	var tx *sql.Tx
+	var err error
+	tx, err = glintdb.Begin()
+	if err != nil {
+		return err
+	}
+	err = addDerivation(tx, fileId, d)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// addDerivation records a derivation within a transaction, as in
+// AddDerivation.
+func addDerivation(tx *sql.Tx, fileId int64, d *api.Derivation) error {
+	var res sql.Result
+	var err error
+	res, err = tx.Exec(`
+		insert into derivation (file_id, ark, person_id, source,
+		        source_ark, command, started, ended)
+		    select $1, $2, p.id, $4, $5, $6, $7, $8
+		        from person p
+		        where p.username = $3;
+		`, fileId, d.Ark, d.Agent, d.Source, d.SourceArk, d.Command,
+		d.Started, d.Ended)
+	if err != nil {
+		return err
+	}
+	var n int64
+	n, err = res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// LookupDerivations returns the derivations recorded for a file, most
+// recent first.
+func (pg *Postgres) LookupDerivations(personId int64, path string) (
+	[]api.Derivation, error) {
+	var st *sql.Stmt
+	var err error
+	st, err = glintdb.Prepare(`
+		select d.ark,
+		       d.source,
+		       d.source_ark,
+		       d.command,
+		       p.username,
+		       d.started,
+		       d.ended
+		    from derivation d
+		        join file f on f.id = d.file_id
+		        join person p on p.id = d.person_id
+		    where f.person_id = $1 and f.path = $2
+		    order by d.id desc;
+		`)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	var rows *sql.Rows
+	rows, err = st.Query(personId, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var derivations []api.Derivation
+	for rows.Next() {
+		var d api.Derivation
+		err = rows.Scan(&d.Ark, &d.Source, &d.SourceArk, &d.Command,
+			&d.Agent, &d.Started, &d.Ended)
+		if err != nil {
+			return nil, err
+		}
+		derivations = append(derivations, d)
+	}
+	return derivations, rows.Err()
+}
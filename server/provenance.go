@@ -0,0 +1,322 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// derivedData describes data derived from another data set by a query,
+// which is recorded when the data are stored.
+type derivedData struct {
+	derivation api.Derivation
+
+	// attributes are the attributes of the source data set, whose
+	// metadata are copied to the attributes of the same name.
+	attributes []AttributeInfo
+}
+
+// deriveCommands lists the thump commands that can be used to derive a
+// data set.  Other commands only change how data are presented.
+var deriveCommands = []string{"where", "show", "units"}
+
+// parseSource splits the source of a derived data set, in the form
+// "user/dataset?commands", into the user, data set name, and commands.  The
+// source may also be given as a URL on this server.
+func parseSource(source string) (string, string, string, error) {
+	var s string = strings.TrimPrefix(source,
+		strings.TrimSuffix(glintbaseurl, "/"))
+	var query string
+	if x := strings.IndexByte(s, '?'); x >= 0 {
+		s, query = s[:x], s[x+1:]
+	}
+	var sp []string = strings.Split(strings.Trim(s, "/"), "/")
+	if len(sp) != 2 || sp[0] == "" || sp[1] == "" {
+		return "", "", "", fmt.Errorf("Invalid source data set: %s",
+			source)
+	}
+	return sp[0], sp[1], query, nil
+}
+
+// deriveData evaluates the query in req.Source and stores the result as the
+// data set pathDataName belonging to user, recording its provenance.
+func (srv *Server) deriveData(w http.ResponseWriter, user string,
+	personId int64, pathDataName string, req *api.PostRequest) {
+	var started = time.Now()
+	var sourceUser, sourcePath, query, err = parseSource(req.Source)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var thp map[string][]string = thumpParse(query)
+	for cmd := range thp {
+		if indexOf(deriveCommands, cmd) == -1 {
+			writeError(w, http.StatusBadRequest,
+				"Command not supported in a derived data set: "+cmd)
+			return
+		}
+	}
+
+	var source = sourceUser + "/" + sourcePath
+	var sourceId int64
+	sourceId, err = srv.storage.LookupPersonId(sourceUser)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "User '"+sourceUser+
+			"' not found")
+		return
+	}
+	var f *FileInfo
+	f, err = srv.storage.LookupFileInfo(sourceId, sourcePath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Data set '"+source+
+			"' not found")
+		return
+	}
+	var data string
+	data, err = srv.storage.LookupData(sourceId, sourcePath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Data set '"+source+
+			"' not found")
+		return
+	}
+	data, err = thumpApply(data, thp, func(attr string) string {
+		for _, a := range f.Attributes {
+			if a.Name == attr {
+				return a.Metadata.Unit
+			}
+		}
+		return ""
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Converted attributes are stored with their new units.
+	if thp["units"] != nil {
+		var units, _ = thumpParseUnits(thp["units"])
+		for x := range f.Attributes {
+			if u, ok := units[f.Attributes[x].Name]; ok {
+				f.Attributes[x].Metadata.Unit = u
+			}
+		}
+	}
+
+	var opts = *req
+	opts.Type = "csv"
+	opts.NoHeader = false
+	opts.Columns = nil
+	srv.storeData(w, user, personId, pathDataName, []byte(data), &opts,
+		&derivedData{
+			derivation: api.Derivation{
+				Source:    source,
+				SourceArk: f.Ark,
+				Command:   query,
+				Agent:     user,
+				Started:   started,
+				Ended:     time.Now(),
+			},
+			attributes: f.Attributes,
+		})
+}
+
+// derivedMetadata returns the metadata of the source attributes of derived
+// data that are among the derived attributes in columns, to be copied to
+// the attributes of the same name.
+func derivedMetadata(columns []string,
+	d *derivedData) map[string]*api.AttributeMetadata {
+	var metadata = make(map[string]*api.AttributeMetadata)
+	for _, a := range d.attributes {
+		if a.Metadata == (api.AttributeMetadata{}) ||
+			indexOf(columns, a.Name) == -1 {
+			continue
+		}
+		var md = a.Metadata
+		metadata[a.Name] = &md
+	}
+	return metadata
+}
+
+// lookupDerivation returns the derivation of the current revision of a
+// data set, or nil if it was not derived from another data set.
+func (srv *Server) lookupDerivation(personId int64,
+	f *FileInfo) *api.Derivation {
+	var ds, err = srv.storage.LookupDerivations(personId, f.Path)
+	if err != nil || len(ds) == 0 || ds[0].Ark != f.Ark {
+		return nil
+	}
+	return &ds[0]
+}
+
+// htmlDerivation returns the provenance of a data set for its HTML page.
+func htmlDerivation(d *api.Derivation) string {
+	var esc = template.HTMLEscapeString
+	var source string = "<a href=\"" +
+		esc(joinURLPath(glintbaseurl, d.Source)) + "\">" + esc(d.Source) +
+		"</a>"
+	if d.SourceArk != "" {
+		source += " (<a href=\"" + esc(arkURL(d.SourceArk)) + "\">" +
+			esc(d.SourceArk) + "</a>)"
+	}
+	var command string = esc(d.Source)
+	if d.Command != "" {
+		command = "<a href=\"" + esc(joinURLPath(glintbaseurl,
+			d.Source)+"?"+d.Command) + "\">" + esc(d.Source+"?"+
+			d.Command) + "</a>"
+	}
+	return fmt.Sprintf("<p class=\"provenance\">Derived from %s by %s on "+
+		"%s with the query <code>%s</code> "+
+		"(<a href=\"?prov\">PROV-JSON</a>)</p>\n", source,
+		esc(d.Agent), d.Ended.UTC().Format("2006-01-02 15:04:05 UTC"),
+		command)
+}
+
+// provId returns the PROV qualified name of a resource on this server.
+func provId(path string) string {
+	return "glint:" + path
+}
+
+// provJSON returns the provenance of a data set in PROV-JSON.  The data set
+// is attributed to its owner, and each recorded derivation is an activity
+// that used a revision of the source data set and generated a revision of
+// this one.
+func provJSON(user string, f *FileInfo,
+	derivations []api.Derivation) map[string]interface{} {
+	var doc = map[string]interface{}{
+		"prefix": map[string]string{
+			"glint": strings.TrimSuffix(glintbaseurl, "/") + "/",
+			"dcat":  nsDCAT,
+		},
+	}
+	var sections = []string{"entity", "activity", "agent",
+		"wasGeneratedBy", "used", "wasDerivedFrom",
+		"wasAssociatedWith", "wasAttributedTo", "specializationOf"}
+	var s = make(map[string]map[string]interface{})
+	for _, name := range sections {
+		s[name] = make(map[string]interface{})
+	}
+	var n int
+	var relation = func(name string, attrs map[string]interface{}) {
+		n++
+		s[name][fmt.Sprintf("_:%s%d", name, n)] = attrs
+	}
+	var agent = func(name string) string {
+		s["agent"][provId(name)] = map[string]interface{}{
+			"prov:type":  "prov:Person",
+			"prov:label": name,
+		}
+		return provId(name)
+	}
+	var revision = func(ark string, dataset string) string {
+		if s["entity"][provId(ark)] != nil {
+			return provId(ark)
+		}
+		s["entity"][provId(ark)] = map[string]interface{}{
+			"prov:label":    ark,
+			"prov:location": arkURL(ark),
+		}
+		relation("specializationOf", map[string]interface{}{
+			"prov:specificEntity": provId(ark),
+			"prov:generalEntity":  provId(dataset),
+		})
+		return provId(ark)
+	}
+
+	var dataset = user + "/" + f.Path
+	var entity = map[string]interface{}{
+		"prov:type":     "dcat:Dataset",
+		"prov:label":    datasetTitle(f),
+		"prov:location": joinURLPath(glintbaseurl, dataset),
+	}
+	s["entity"][provId(dataset)] = entity
+	relation("wasAttributedTo", map[string]interface{}{
+		"prov:entity": provId(dataset),
+		"prov:agent":  agent(user),
+	})
+	if f.Ark != "" {
+		revision(f.Ark, dataset)
+	}
+
+	for x := range derivations {
+		var d *api.Derivation = &derivations[x]
+		var activity = fmt.Sprintf("_:derivation%d", len(derivations)-x)
+		var query string = d.Source
+		if d.Command != "" {
+			query += "?" + d.Command
+		}
+		s["activity"][activity] = map[string]interface{}{
+			"prov:startTime": d.Started.UTC().Format(time.RFC3339Nano),
+			"prov:endTime":   d.Ended.UTC().Format(time.RFC3339Nano),
+			"prov:label":     "glint save " + query + " " + f.Path,
+			"glint:command":  d.Command,
+		}
+		var generated string = revision(d.Ark, dataset)
+		if s["entity"][provId(d.Source)] == nil {
+			s["entity"][provId(d.Source)] = map[string]interface{}{
+				"prov:type":     "dcat:Dataset",
+				"prov:location": joinURLPath(glintbaseurl, d.Source),
+			}
+		}
+		var used string = provId(d.Source)
+		if d.SourceArk != "" {
+			used = revision(d.SourceArk, d.Source)
+		}
+		relation("used", map[string]interface{}{
+			"prov:activity": activity,
+			"prov:entity":   used,
+			"prov:time":     d.Started.UTC().Format(time.RFC3339Nano),
+		})
+		relation("wasGeneratedBy", map[string]interface{}{
+			"prov:entity":   generated,
+			"prov:activity": activity,
+			"prov:time":     d.Ended.UTC().Format(time.RFC3339Nano),
+		})
+		relation("wasDerivedFrom", map[string]interface{}{
+			"prov:generatedEntity": generated,
+			"prov:usedEntity":      used,
+			"prov:activity":        activity,
+		})
+		relation("wasAssociatedWith", map[string]interface{}{
+			"prov:activity": activity,
+			"prov:agent":    agent(d.Agent),
+		})
+	}
+	for _, name := range sections {
+		if len(s[name]) > 0 {
+			doc[name] = s[name]
+		}
+	}
+	return doc
+}
+
+// writeProvenance writes the provenance of a data set in PROV-JSON.
+func (srv *Server) writeProvenance(w http.ResponseWriter, r *http.Request,
+	user string, personId int64, path string) {
+	f, err := srv.storage.LookupFileInfo(personId, path)
+	if err != nil {
+		writeStatusCode(w, r, http.StatusNotFound,
+			"Data set '"+user+"/"+path+"' not found")
+		return
+	}
+	var derivations []api.Derivation
+	derivations, err = srv.storage.LookupDerivations(personId, path)
+	if err != nil && err != sql.ErrNoRows {
+		writeStatusCode(w, r, http.StatusInternalServerError,
+			"Unable to read provenance: "+err.Error())
+		return
+	}
+	var b []byte
+	b, err = json.MarshalIndent(provJSON(user, f, derivations), "", "  ")
+	if err != nil {
+		writeStatusCode(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// storeStorage is a Storage that records the files stored.
+type storeStorage struct {
+	Storage
+	stored []StoredFile
+}
+
+func (s *storeStorage) LookupFileId(personId int64, path string) (int64,
+	error) {
+	if path == "ocean" {
+		return 7, nil
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (s *storeStorage) StoreFile(f *StoredFile) (int64, string, error) {
+	var ark, err = f.Mint()
+	if err != nil {
+		return 0, "", err
+	}
+	s.stored = append(s.stored, *f)
+	return 8, ark, nil
+}
+
+func TestStoreDerivedData(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	st := &storeStorage{}
+	srv := &Server{storage: st}
+	w := httptest.NewRecorder()
+	ok := srv.storeData(w, "alice", 1, "warm", []byte("t,s\n20,35\n"),
+		&api.PostRequest{Type: "csv"}, &derivedData{
+			derivation: api.Derivation{Source: "alice/ocean",
+				Command: "where(t>15)show(t,s)"},
+			attributes: []AttributeInfo{
+				{Name: "t", Metadata: api.AttributeMetadata{
+					Unit: "Cel"}},
+				{Name: "d", Metadata: api.AttributeMetadata{
+					Unit: "m"}},
+				{Name: "s"},
+			},
+		})
+	if !ok || w.Code != http.StatusCreated || len(st.stored) != 1 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	f := st.stored[0]
+	if f.FileId != 0 || f.Path != "warm" || f.Derivation == nil ||
+		f.Derivation.Source != "alice/ocean" {
+		t.Errorf("stored %+v", f)
+	}
+	if len(f.AttributeMetadata) != 1 ||
+		f.AttributeMetadata["t"].Unit != "Cel" {
+		t.Errorf("attribute metadata %v", f.AttributeMetadata)
+	}
+
+	// An existing data set is replaced only if requested.
+	for _, overwrite := range []bool{false, true} {
+		srv.storeData(httptest.NewRecorder(), "alice", 1, "ocean",
+			[]byte("t\n1\n"), &api.PostRequest{Overwrite: overwrite},
+			nil)
+		f = st.stored[len(st.stored)-1]
+		if (f.FileId == 7) != overwrite || f.Derivation != nil {
+			t.Errorf("overwrite %v: stored %+v", overwrite, f)
+		}
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	for _, c := range []struct {
+		source               string
+		user, path, commands string
+		ok                   bool
+	}{
+		{"alice/ocean", "alice", "ocean", "", true},
+		{"/alice/ocean/", "alice", "ocean", "", true},
+		{"alice/ocean?where(t>15)show(t)", "alice", "ocean",
+			"where(t>15)show(t)", true},
+		{"https://glint.example.org/alice/ocean?show(t)", "alice",
+			"ocean", "show(t)", true},
+		{"ocean", "", "", "", false},
+		{"alice/", "", "", "", false},
+		{"alice/ocean/extra", "", "", "", false},
+		{"?show(t)", "", "", "", false},
+	} {
+		user, path, commands, err := parseSource(c.source)
+		if (err == nil) != c.ok {
+			t.Errorf("%q: error %v", c.source, err)
+			continue
+		}
+		if user != c.user || path != c.path || commands != c.commands {
+			t.Errorf("%q: %q %q %q", c.source, user, path, commands)
+		}
+	}
+}
+
+func TestDerivedMetadata(t *testing.T) {
+	md := derivedMetadata([]string{"t", "s", "x"}, &derivedData{
+		attributes: []AttributeInfo{
+			{Name: "t", Metadata: api.AttributeMetadata{Unit: "Cel"}},
+			{Name: "d", Metadata: api.AttributeMetadata{Unit: "m"}},
+			{Name: "s"},
+		},
+	})
+	want := map[string]*api.AttributeMetadata{"t": {Unit: "Cel"}}
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("got %v, want %v", md, want)
+	}
+}
+
+// derivation returns a derivation of izzy/warm from alice/ocean.
+func derivation() api.Derivation {
+	return api.Derivation{
+		Ark:       "ark:/99999/fk4new",
+		Source:    "alice/ocean",
+		SourceArk: "ark:/99999/fk4src",
+		Command:   "where(t>15)",
+		Agent:     "izzy",
+		Started:   time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Ended:     time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC),
+	}
+}
+
+func TestHtmlDerivation(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	d := derivation()
+	d.Agent = "<izzy>"
+	h := htmlDerivation(&d)
+	for _, want := range []string{
+		`<a href="https://glint.example.org/alice/ocean">alice/ocean</a>`,
+		` (<a href="https://glint.example.org/ark:/99999/fk4src">` +
+			`ark:/99999/fk4src</a>)`,
+		"by &lt;izzy&gt; on 2021-03-04 05:06:08 UTC",
+		`<code><a href="https://glint.example.org/alice/ocean?` +
+			`where(t&gt;15)">alice/ocean?where(t&gt;15)</a></code>`,
+	} {
+		if !strings.Contains(h, want) {
+			t.Errorf("missing %q in:\n%s", want, h)
+		}
+	}
+	d.SourceArk, d.Command = "", ""
+	h = htmlDerivation(&d)
+	if strings.Contains(h, "ark:") ||
+		!strings.Contains(h, "<code>alice/ocean</code>") {
+		t.Errorf("without a source ARK or command:\n%s", h)
+	}
+}
+
+func TestProvJSON(t *testing.T) {
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	f := &FileInfo{User: "izzy", Path: "warm", Ark: "ark:/99999/fk4new"}
+	doc := roundTrip(t, provJSON("izzy", f, []api.Derivation{derivation()}))
+	for _, c := range []struct {
+		path []interface{}
+		want interface{}
+	}{
+		{[]interface{}{"prefix", "glint"}, "https://glint.example.org/"},
+		{[]interface{}{"entity", "glint:izzy/warm", "prov:location"},
+			"https://glint.example.org/izzy/warm"},
+		{[]interface{}{"entity", "glint:ark:/99999/fk4new",
+			"prov:location"},
+			"https://glint.example.org/ark:/99999/fk4new"},
+		{[]interface{}{"entity", "glint:ark:/99999/fk4src", "prov:label"},
+			"ark:/99999/fk4src"},
+		{[]interface{}{"entity", "glint:alice/ocean", "prov:type"},
+			"dcat:Dataset"},
+		{[]interface{}{"activity", "_:derivation1", "prov:label"},
+			"glint save alice/ocean?where(t>15) warm"},
+		{[]interface{}{"activity", "_:derivation1", "prov:endTime"},
+			"2021-03-04T05:06:08Z"},
+		{[]interface{}{"agent", "glint:izzy", "prov:type"},
+			"prov:Person"},
+	} {
+		if got := jsonPath(doc, c.path...); !reflect.DeepEqual(got,
+			c.want) {
+			t.Errorf("%v = %v, want %v", c.path, got, c.want)
+		}
+	}
+	// The derivation used the source revision and generated the
+	// current revision, which is recorded once.
+	derived, _ := jsonPath(doc, "wasDerivedFrom").(map[string]interface{})
+	if len(derived) != 1 {
+		t.Fatalf("wasDerivedFrom %v", derived)
+	}
+	for _, r := range derived {
+		if jsonPath(r, "prov:generatedEntity") !=
+			"glint:ark:/99999/fk4new" ||
+			jsonPath(r, "prov:usedEntity") != "glint:ark:/99999/fk4src" {
+			t.Errorf("wasDerivedFrom %v", r)
+		}
+	}
+	if s, _ := jsonPath(doc,
+		"specializationOf").(map[string]interface{}); len(s) != 2 {
+		t.Errorf("specializationOf %v", s)
+	}
+
+	// A data set that was not derived is only attributed to its owner.
+	f.Ark = ""
+	doc = roundTrip(t, provJSON("izzy", f, nil))
+	for _, k := range []string{"activity", "used", "wasDerivedFrom",
+		"specializationOf"} {
+		if v := jsonPath(doc, k); v != nil {
+			t.Errorf("%s = %v", k, v)
+		}
+	}
+	if a, _ := jsonPath(doc,
+		"wasAttributedTo").(map[string]interface{}); len(a) != 1 {
+		t.Errorf("wasAttributedTo %v", a)
+	}
+}
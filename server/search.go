@@ -0,0 +1,668 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// Weights of the fields of a data set in search results.  A word in a data
+// set's name or title counts for more than one in its abstract.
+const (
+	weightName    = 3
+	weightKeyword = 2
+	weightText    = 1
+)
+
+// maxSearchResults is the default and maximum number of data sets returned
+// by a search.
+const maxSearchResults = 100
+
+// maxFacetValues is the number of values of each facet returned by a
+// search, most frequent first.
+const maxFacetValues = 20
+
+// searchFacets lists the facets of search results.  Time coverage is
+// faceted by decade, e.g. "1990s".
+var searchFacets = []string{"owner", "license", "term", "decade"}
+
+// searchIndex is an in-memory inverted index of the names and metadata of
+// all data sets.  It is built when the server starts and updated by
+// indexedStorage as data sets are stored.
+type searchIndex struct {
+	mu sync.RWMutex
+
+	// files maps file ids to the indexed data sets.  A FileInfo is
+	// replaced, never modified, when a data set changes.
+	files map[int64]*FileInfo
+
+	// postings maps each token to the files containing it and the
+	// weight of the token in each file.
+	postings map[string]map[int64]int
+
+	// tokens maps file ids to the tokens indexed for each file.
+	tokens map[int64]map[string]int
+
+	// sorted lists the tokens in postings in order, so that the tokens
+	// beginning with a prefix can be found by binary search.
+	sorted []string
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		files:    make(map[int64]*FileInfo),
+		postings: make(map[string]map[int64]int),
+		tokens:   make(map[int64]map[string]int),
+	}
+}
+
+// tokenize splits text into lower case words, separated by anything other
+// than letters and digits.  A term such as "cf:sea_water_temperature" is
+// split into "cf", "sea", "water", and "temperature".
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// fileTokens returns the tokens indexed for a data set, with their
+// weights.
+func fileTokens(f *FileInfo) map[string]int {
+	var tokens = make(map[string]int)
+	var add = func(s string, weight int) {
+		for _, t := range tokenize(s) {
+			if tokens[t] < weight {
+				tokens[t] = weight
+			}
+		}
+	}
+	add(f.Path, weightName)
+	if md := f.Metadata; md != nil {
+		add(md.Title, weightName)
+		add(md.Abstract, weightText)
+		for _, k := range md.Keywords {
+			add(k, weightKeyword)
+		}
+		for _, c := range md.Creators {
+			add(c.Name, weightText)
+		}
+		if md.Spatial != nil {
+			add(md.Spatial.Place, weightText)
+		}
+	}
+	for _, a := range f.Attributes {
+		add(a.Name, weightKeyword)
+		add(a.Metadata.Term, weightKeyword)
+		add(a.Metadata.Label, weightText)
+		add(a.Metadata.Description, weightText)
+	}
+	return tokens
+}
+
+// update adds a data set to the index, replacing any earlier version.
+func (idx *searchIndex) update(f *FileInfo) {
+	var tokens = fileTokens(f)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(f.Id)
+	for _, t := range idx.addLocked(f, tokens) {
+		var x int = sort.SearchStrings(idx.sorted, t)
+		idx.sorted = append(idx.sorted, "")
+		copy(idx.sorted[x+1:], idx.sorted[x:])
+		idx.sorted[x] = t
+	}
+}
+
+// build adds data sets to an empty index, sorting the tokens once rather
+// than inserting each in turn.
+func (idx *searchIndex) build(files []FileInfo) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for x := range files {
+		var f *FileInfo = &files[x]
+		idx.sorted = append(idx.sorted, idx.addLocked(f, fileTokens(f))...)
+	}
+	sort.Strings(idx.sorted)
+}
+
+// addLocked adds a data set that is not in the index, and returns the
+// tokens that were not in the index before.
+func (idx *searchIndex) addLocked(f *FileInfo,
+	tokens map[string]int) []string {
+	var added []string
+	idx.files[f.Id] = f
+	idx.tokens[f.Id] = tokens
+	for t, weight := range tokens {
+		if idx.postings[t] == nil {
+			idx.postings[t] = make(map[int64]int)
+			added = append(added, t)
+		}
+		idx.postings[t][f.Id] = weight
+	}
+	return added
+}
+
+// remove removes a data set from the index.
+func (idx *searchIndex) remove(fileId int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(fileId)
+}
+
+func (idx *searchIndex) removeLocked(fileId int64) {
+	for t := range idx.tokens[fileId] {
+		delete(idx.postings[t], fileId)
+		if len(idx.postings[t]) == 0 {
+			delete(idx.postings, t)
+			var x int = sort.SearchStrings(idx.sorted, t)
+			idx.sorted = append(idx.sorted[:x], idx.sorted[x+1:]...)
+		}
+	}
+	delete(idx.tokens, fileId)
+	delete(idx.files, fileId)
+}
+
+// lookup returns the indexed data set with a file id, or nil.
+func (idx *searchIndex) lookup(fileId int64) *FileInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.files[fileId]
+}
+
+// match returns the score of each data set containing a token that begins
+// with t.  A whole token scores twice as much as a prefix.
+func (idx *searchIndex) match(t string) map[int64]float64 {
+	var scores = make(map[int64]float64)
+	for x := sort.SearchStrings(idx.sorted, t); x < len(idx.sorted) &&
+		strings.HasPrefix(idx.sorted[x], t); x++ {
+		var token string = idx.sorted[x]
+		var factor float64 = 0.5
+		if token == t {
+			factor = 1
+		}
+		for id, weight := range idx.postings[token] {
+			if s := factor * float64(weight); s > scores[id] {
+				scores[id] = s
+			}
+		}
+	}
+	return scores
+}
+
+// searchQuery is a search for data sets.  Each token of the text must match
+// the data set, and each facet that is given must have one of the values
+// listed.
+type searchQuery struct {
+	text     string
+	owners   []string
+	licenses []string
+	terms    []string
+
+	// from and to select data sets whose time coverage overlaps the
+	// period, given as dates or their prefixes, e.g. "1990" or "1990-06".
+	from string
+	to   string
+}
+
+// searchMatch is a data set found by a search.
+type searchMatch struct {
+	file  *FileInfo
+	score float64
+}
+
+// search returns the data sets matching a query, best matches first.  If
+// the query has no text, all data sets with the facet values match.
+func (idx *searchIndex) search(q *searchQuery) []searchMatch {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var scores map[int64]float64
+	var tokens []string = tokenize(q.text)
+	if len(tokens) == 0 {
+		scores = make(map[int64]float64, len(idx.files))
+		for id := range idx.files {
+			scores[id] = 0
+		}
+	}
+	for x, t := range tokens {
+		var s = idx.match(t)
+		if x == 0 {
+			scores = s
+			continue
+		}
+		for id := range scores {
+			if _, ok := s[id]; ok {
+				scores[id] += s[id]
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	var matches []searchMatch
+	for id, score := range scores {
+		var f *FileInfo = idx.files[id]
+		if q.filter(f) {
+			matches = append(matches, searchMatch{file: f, score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		var a, b = matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.file.User != b.file.User {
+			return a.file.User < b.file.User
+		}
+		return a.file.Path < b.file.Path
+	})
+	return matches
+}
+
+// filter reports whether a data set has the facet values of a query.
+func (q *searchQuery) filter(f *FileInfo) bool {
+	if len(q.owners) > 0 && indexOf(q.owners, f.User) == -1 {
+		return false
+	}
+	if len(q.licenses) > 0 {
+		if f.Metadata == nil ||
+			indexOf(q.licenses, f.Metadata.License) == -1 {
+			return false
+		}
+	}
+	if len(q.terms) > 0 {
+		var found bool
+		for _, a := range f.Attributes {
+			if indexOf(q.terms, a.Metadata.Term) != -1 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.from != "" || q.to != "" {
+		if f.Metadata == nil || f.Metadata.Temporal == nil {
+			return false
+		}
+		// Dates compare as strings once truncated to the precision
+		// of the query.  Coverage without an end is ongoing.
+		var t *api.TemporalCoverage = f.Metadata.Temporal
+		if q.from != "" && t.End != "" &&
+			truncate(t.End, len(q.from)) < q.from {
+			return false
+		}
+		if q.to != "" && t.Start != "" &&
+			truncate(t.Start, len(q.to)) > q.to {
+			return false
+		}
+	}
+	return true
+}
+
+// facetValues returns the values of each facet of a data set.
+func facetValues(f *FileInfo) map[string][]string {
+	var values = map[string][]string{
+		"owner": {f.User},
+	}
+	for _, a := range f.Attributes {
+		if a.Metadata.Term != "" &&
+			indexOf(values["term"], a.Metadata.Term) == -1 {
+			values["term"] = append(values["term"], a.Metadata.Term)
+		}
+	}
+	if f.Metadata == nil {
+		return values
+	}
+	if f.Metadata.License != "" {
+		values["license"] = []string{f.Metadata.License}
+	}
+	if t := f.Metadata.Temporal; t != nil {
+		var start, err1 = strconv.Atoi(truncate(t.Start, 4))
+		var end, err2 = strconv.Atoi(truncate(t.End, 4))
+		if err1 != nil {
+			start = end
+		}
+		if err2 != nil || end < start {
+			end = start
+		}
+		if err1 == nil || err2 == nil {
+			for d := start - start%10; d <= end; d += 10 {
+				values["decade"] = append(values["decade"],
+					fmt.Sprintf("%ds", d))
+			}
+		}
+	}
+	return values
+}
+
+// truncate returns the first n bytes of s, or s if it is shorter.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// searchFacetCounts counts the data sets found by a search that have each
+// facet value.
+func searchFacetCounts(matches []searchMatch) map[string][]api.FacetCount {
+	var counts = make(map[string]map[string]int)
+	for _, m := range matches {
+		for facet, values := range facetValues(m.file) {
+			if counts[facet] == nil {
+				counts[facet] = make(map[string]int)
+			}
+			for _, v := range values {
+				counts[facet][v]++
+			}
+		}
+	}
+	var facets = make(map[string][]api.FacetCount)
+	for _, facet := range searchFacets {
+		var fc = []api.FacetCount{}
+		for v, n := range counts[facet] {
+			fc = append(fc, api.FacetCount{Value: v, Count: n})
+		}
+		sort.Slice(fc, func(i, j int) bool {
+			if fc[i].Count != fc[j].Count {
+				return fc[i].Count > fc[j].Count
+			}
+			return fc[i].Value < fc[j].Value
+		})
+		if len(fc) > maxFacetValues {
+			fc = fc[:maxFacetValues]
+		}
+		facets[facet] = fc
+	}
+	return facets
+}
+
+// searchHit returns a data set found by a search as it is returned to the
+// client.
+func searchHit(m searchMatch) api.SearchHit {
+	var f *FileInfo = m.file
+	var hit = api.SearchHit{
+		Dataset:  f.User + "/" + f.Path,
+		Url:      joinURLPath(glintbaseurl, f.User+"/"+f.Path),
+		Ark:      f.Ark,
+		Modified: f.Modified,
+		Score:    m.score,
+	}
+	if md := f.Metadata; md != nil {
+		hit.Title = md.Title
+		hit.Abstract = md.Abstract
+		hit.License = md.License
+		hit.Keywords = md.Keywords
+		hit.Temporal = md.Temporal
+	}
+	for _, a := range f.Attributes {
+		if a.Metadata.Term != "" &&
+			indexOf(hit.Terms, a.Metadata.Term) == -1 {
+			hit.Terms = append(hit.Terms, a.Metadata.Term)
+		}
+	}
+	return hit
+}
+
+// indexedStorage is a Storage that keeps a search index up to date with the
+// data sets it stores.
+type indexedStorage struct {
+	Storage
+	index *searchIndex
+}
+
+// setupSearch builds the search index from the stored data sets and
+// arranges for it to be updated as data sets change.
+func (srv *Server) setupSearch() error {
+	var files, err = srv.storage.LookupAllFileInfo()
+	if err != nil {
+		return err
+	}
+	srv.index = newSearchIndex()
+	srv.index.build(files)
+	srv.storage = &indexedStorage{Storage: srv.storage, index: srv.index}
+	return nil
+}
+
+// refresh reindexes a data set.  The change has already been stored, so
+// if the data set cannot be read the index is left as it was.
+func (s *indexedStorage) refresh(personId int64, path string) {
+	var f, err = s.Storage.LookupFileInfo(personId, path)
+	if err == nil {
+		s.index.update(f)
+	}
+}
+
+// refreshFile reindexes a data set given its file id.
+func (s *indexedStorage) refreshFile(fileId int64) {
+	var f *FileInfo = s.index.lookup(fileId)
+	if f == nil {
+		return
+	}
+	var personId, err = s.Storage.LookupPersonId(f.User)
+	if err == nil {
+		s.refresh(personId, f.Path)
+	}
+}
+
+func (s *indexedStorage) AddFile(personId int64, path string, data string,
+	hash string) (int64, error) {
+	var id, err = s.Storage.AddFile(personId, path, data, hash)
+	if err == nil {
+		s.refresh(personId, path)
+	}
+	return id, err
+}
+
+func (s *indexedStorage) ReplaceFile(fileId int64, data string, hash string,
+	attrs []string) error {
+	var err = s.Storage.ReplaceFile(fileId, data, hash, attrs)
+	if err == nil {
+		s.refreshFile(fileId)
+	}
+	return err
+}
+
+func (s *indexedStorage) StoreFile(f *StoredFile) (int64, string, error) {
+	var id, ark, err = s.Storage.StoreFile(f)
+	if err == nil {
+		s.refresh(f.PersonId, f.Path)
+	}
+	return id, ark, err
+}
+
+func (s *indexedStorage) AppendFile(fileId int64, rows [][]string,
+	key string) (int, error) {
+	var added, err = s.Storage.AppendFile(fileId, rows, key)
+	if err == nil && added > 0 {
+		s.refreshFile(fileId)
+	}
+	return added, err
+}
+
+func (s *indexedStorage) StoreAppend(fileId int64, rows [][]string,
+	key string, mint func() (string, error)) (int, string, error) {
+	var added, ark, err = s.Storage.StoreAppend(fileId, rows, key, mint)
+	if err == nil && added > 0 {
+		s.refreshFile(fileId)
+	}
+	return added, ark, err
+}
+
+func (s *indexedStorage) DeleteFile(personId int64, path string) error {
+	var id, lookupErr = s.Storage.LookupFileId(personId, path)
+	var err = s.Storage.DeleteFile(personId, path)
+	if err == nil && lookupErr == nil {
+		s.index.remove(id)
+	}
+	return err
+}
+
+func (s *indexedStorage) AddAttributes(fileId int64, attrs []string) error {
+	var err = s.Storage.AddAttributes(fileId, attrs)
+	if err == nil {
+		s.refreshFile(fileId)
+	}
+	return err
+}
+
+func (s *indexedStorage) AddDatasetMetadata(fileId int64,
+	metadata *api.DatasetMetadata) error {
+	var err = s.Storage.AddDatasetMetadata(fileId, metadata)
+	if err == nil {
+		s.refreshFile(fileId)
+	}
+	return err
+}
+
+func (s *indexedStorage) AddMetadata(personId int64, path string,
+	attribute string, metadata *api.AttributeMetadata) error {
+	var err = s.Storage.AddMetadata(personId, path, attribute, metadata)
+	if err == nil {
+		s.refresh(personId, path)
+	}
+	return err
+}
+
+func (s *indexedStorage) AddMetadataBatch(personId int64, path string,
+	merge MetadataMerge) error {
+	var err = s.Storage.AddMetadataBatch(personId, path, merge)
+	if err == nil {
+		s.refresh(personId, path)
+	}
+	return err
+}
+
+// searchDate matches the dates, or prefixes of dates, accepted by the from
+// and to parameters of a search.
+var searchDate = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+
+// handleSearch finds data sets whose names or metadata contain the words
+// in the query q, optionally restricted to facet values, and returns them
+// in JSON with the facet counts of all matching data sets.
+func (srv *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	srv.logRequest(r, 0)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeMethodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+	var v = r.URL.Query()
+	var q = searchQuery{
+		text:     v.Get("q"),
+		owners:   v["owner"],
+		licenses: v["license"],
+		from:     v.Get("from"),
+		to:       v.Get("to"),
+	}
+	for _, t := range v["term"] {
+		if id, err := srv.vocab.validate(t); err == nil {
+			t = id
+		}
+		q.terms = append(q.terms, t)
+	}
+	for _, d := range []string{q.from, q.to} {
+		if d != "" && !searchDate.MatchString(d) {
+			writeStatusCode(w, r, http.StatusBadRequest,
+				"Invalid date: "+d+" (expected YYYY, YYYY-MM, or "+
+					"YYYY-MM-DD)")
+			return
+		}
+	}
+	var offset, limit, err = pageParams(v, maxSearchResults,
+		maxSearchResults)
+	if err != nil {
+		writeStatusCode(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var matches = srv.index.search(&q)
+	var result = api.SearchResult{
+		Query:   q.text,
+		Total:   len(matches),
+		Results: []api.SearchHit{},
+		Facets:  searchFacetCounts(matches),
+	}
+	for x := offset; x < len(matches) && x < offset+limit; x++ {
+		result.Results = append(result.Results, searchHit(matches[x]))
+	}
+	if acceptsHtml(r) {
+		setContentTypeTextHtml(w)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "%s%s%s", header(), htmlSearch(v, &result),
+			footer())
+		return
+	}
+	writeJSON(w, &result)
+}
+
+// htmlSearch returns a search form and the results of a search, with
+// links that restrict the search to each facet value.
+func htmlSearch(v url.Values, result *api.SearchResult) string {
+	var esc = template.HTMLEscapeString
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h1>Search</h1>\n<form action=\"/search\" "+
+		"method=\"get\">\n<input type=\"text\" name=\"q\" value=\"%s\">\n",
+		esc(result.Query))
+	for _, name := range []string{"owner", "license", "term", "from",
+		"to"} {
+		for _, s := range v[name] {
+			fmt.Fprintf(&b, "<input type=\"hidden\" name=\"%s\" "+
+				"value=\"%s\">\n", name, esc(s))
+		}
+	}
+	b.WriteString("<input type=\"submit\" value=\"Search\">\n</form>\n")
+
+	b.WriteString("<div class=\"facets\">\n")
+	for _, facet := range searchFacets {
+		if len(result.Facets[facet]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "<h3>%s</h3>\n<ul>\n", esc(facet))
+		for _, fc := range result.Facets[facet] {
+			var link = url.Values{}
+			for k, s := range v {
+				if k != "offset" {
+					link[k] = s
+				}
+			}
+			if facet == "decade" {
+				var d, _ = strconv.Atoi(strings.TrimSuffix(fc.Value,
+					"s"))
+				link.Set("from", strconv.Itoa(d))
+				link.Set("to", strconv.Itoa(d+9))
+			} else {
+				link.Set(facet, fc.Value)
+			}
+			fmt.Fprintf(&b, "<li><a href=\"/search?%s\">%s</a> (%d)"+
+				"</li>\n", esc(link.Encode()), esc(fc.Value),
+				fc.Count)
+		}
+		b.WriteString("</ul>\n")
+	}
+	b.WriteString("</div>\n")
+
+	fmt.Fprintf(&b, "<p>%d data sets found</p>\n<dl class=\"results\">\n",
+		result.Total)
+	for _, hit := range result.Results {
+		fmt.Fprintf(&b, "<dt><a href=\"%s\">%s</a>", esc(hit.Url),
+			esc(hit.Dataset))
+		if hit.Title != "" {
+			fmt.Fprintf(&b, ": %s", esc(hit.Title))
+		}
+		b.WriteString("</dt>\n")
+		if hit.Abstract != "" {
+			fmt.Fprintf(&b, "<dd>%s</dd>\n", esc(hit.Abstract))
+		}
+	}
+	b.WriteString("</dl>\n")
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestSearchIndexPrefix(t *testing.T) {
+	idx := newSearchIndex()
+	idx.build([]FileInfo{
+		{Id: 1, User: "izzy", Path: "ocean"},
+		{Id: 2, User: "izzy", Path: "oceanic_temp"},
+	})
+	idx.update(&FileInfo{Id: 3, User: "alice", Path: "occult"})
+	if !sort.StringsAreSorted(idx.sorted) {
+		t.Fatalf("tokens not sorted: %v", idx.sorted)
+	}
+	for _, c := range []struct {
+		q   string
+		ids []int64
+	}{
+		{"ocean", []int64{1, 2}},
+		{"oc", []int64{1, 2, 3}},
+		{"temp", []int64{2}},
+		{"oceans", nil},
+		{"z", nil},
+	} {
+		s := idx.match(c.q)
+		if len(s) != len(c.ids) {
+			t.Errorf("match(%q) = %v, want %v", c.q, s, c.ids)
+			continue
+		}
+		for _, id := range c.ids {
+			if _, ok := s[id]; !ok {
+				t.Errorf("match(%q) = %v, want %v", c.q, s, c.ids)
+			}
+		}
+	}
+	if s := idx.match("ocean"); s[1] != weightName || s[2] != weightName/2.0 {
+		t.Errorf("match(ocean) = %v, want whole token scored higher", s)
+	}
+}
+
+func TestSearchIndexRemove(t *testing.T) {
+	idx := newSearchIndex()
+	idx.build([]FileInfo{
+		{Id: 1, User: "izzy", Path: "ocean"},
+		{Id: 2, User: "izzy", Path: "ocean_temp"},
+	})
+	idx.remove(2)
+	if len(idx.match("temp")) != 0 {
+		t.Errorf("removed data set still matches")
+	}
+	idx.update(&FileInfo{Id: 1, User: "izzy", Path: "lake"})
+	if len(idx.match("ocean")) != 0 || len(idx.match("lake")) != 1 {
+		t.Errorf("updated data set matches old tokens")
+	}
+	if len(idx.sorted) != 1 || idx.sorted[0] != "lake" {
+		t.Errorf("sorted = %v, want [lake]", idx.sorted)
+	}
+	if len(idx.sorted) != len(idx.postings) {
+		t.Errorf("sorted has %d tokens, postings %d", len(idx.sorted),
+			len(idx.postings))
+	}
+}
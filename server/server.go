@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/rs/cors"
 )
@@ -14,6 +15,9 @@ import (
 // fileModeRWX is the umask "-rwx------".
 const fileModeRWX = 0700
 
+// fileModeRW is the umask "-rw-------".
+const fileModeRW = 0600
+
 // Server defines parameters for running a Glint server.
 type Server struct {
 
@@ -35,6 +39,11 @@ type Server struct {
 	// for the server.
 	TLSKeyFile string
 
+	// CACertFile is the name of a file containing certificate authorities
+	// to trust, in addition to the system's authorities, when the server
+	// retrieves data from other servers.
+	CACertFile string
+
 	// Logger optionally specifies a logger for the server.  If nil, the
 	// log package's standard logger is used.
 	Logger *log.Logger
@@ -54,6 +63,58 @@ type Server struct {
 
 	DebugAllowInsecureCORS bool
 
+	// PasswordPolicy optionally specifies the requirements for new
+	// passwords.  If nil, DefaultPasswordPolicy() is used.
+	PasswordPolicy *PasswordPolicy
+
+	// AuthProviders is a comma-separated list of authentication providers
+	// to try in order: "password", "ldap", and/or "oidc".  If empty, only
+	// "password" is used.
+	AuthProviders string
+
+	// Admins is a comma-separated list of users who are allowed to use
+	// administrative functions such as reading the audit log.
+	Admins string
+
+	// LDAPURL is the ldap:// or ldaps:// URL of a directory server used by
+	// the "ldap" authentication provider.
+	LDAPURL string
+
+	// LDAPBindDN is a template for the distinguished name that users bind
+	// as, in which "%s" is replaced by the username.
+	LDAPBindDN string
+
+	// OIDCIssuer is the issuer URL of an OpenID Connect provider used by
+	// the "oidc" authentication provider.
+	OIDCIssuer string
+
+	// OIDCClientID and OIDCClientSecret are the client credentials
+	// registered with the OpenID Connect provider.
+	OIDCClientID     string
+	OIDCClientSecret string
+
+	// OIDCUsernameClaim is the userinfo claim that contains the username.
+	// The default is "preferred_username".
+	OIDCUsernameClaim string
+
+	// ArkNAAN is the Name Assigning Authority Number of the ARKs minted
+	// for data sets.  If empty, DefaultArkNAAN is used.
+	ArkNAAN string
+
+	// VocabularyPrefixes is a comma-separated list of metadata vocabulary
+	// prefixes and their namespaces, e.g. "ex=http://example.org/ns#",
+	// in addition to the default prefixes.
+	VocabularyPrefixes string
+
+	// VocabularyClosed is a comma-separated list of prefixes with which
+	// only the terms defined in VocabularyFiles are accepted.  If empty,
+	// only dc is closed.
+	VocabularyClosed string
+
+	// VocabularyFiles is a comma-separated list of files defining
+	// metadata terms, in CSV or SKOS RDF/XML format.
+	VocabularyFiles string
+
 	serverLog
 
 	StaticDir string
@@ -61,6 +122,13 @@ type Server struct {
 
 	StorageModule string
 	storage       Storage
+
+	authenticators []Authenticator
+	ipThrottle     ipThrottle
+	uploadMu       sync.Mutex
+	uploadLocks    map[string]*uploadLock
+	vocab          *vocabulary
+	index          *searchIndex
 }
 
 func (srv *Server) setupCORS(h http.Handler) http.Handler {
@@ -97,6 +165,11 @@ func (srv *Server) handleMain(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if strings.HasPrefix(r.URL.Path, "/ark:") {
+		srv.handleArk(w, r)
+		return
+	}
+
 	if strings.HasPrefix(r.URL.Path, "/datasets/") {
 		if r.Method == "GET" && acceptsHtml(r) {
 			srv.datasetsHandler(w, r)
@@ -146,8 +219,20 @@ func (srv *Server) setupHandlers() http.Handler {
 			false)))
 
 	// Old server handlers
-	mux.HandleFunc("/login", srv.handleLogin)
-	mux.HandleFunc("/account/password", srv.handleChangePassword)
+	mux.HandleFunc("/login", srv.audit(AuditLogin, srv.handleLogin))
+	mux.HandleFunc("/logout", srv.audit(AuditLogout, srv.handleLogout))
+	mux.HandleFunc("/account/password",
+		srv.audit(AuditPassword, srv.handleChangePassword))
+	mux.HandleFunc("/account/password/reset",
+		srv.audit(AuditPasswordReset, srv.handlePasswordReset))
+	mux.HandleFunc("/admin/audit", srv.handleAudit)
+	mux.HandleFunc("/uploads", srv.handleUploads)
+	mux.HandleFunc("/uploads/", srv.handleUploads)
+	mux.HandleFunc("/terms", srv.handleTerms)
+	mux.HandleFunc("/terms/", srv.handleTerms)
+	mux.HandleFunc("/catalog", srv.handleCatalog)
+	mux.HandleFunc("/catalog.ttl", srv.handleCatalog)
+	mux.HandleFunc("/search", srv.handleSearch)
 	mux.HandleFunc("/plot-time-series", handlePlot)
 
 	if !srv.DisableCORS {
@@ -156,6 +241,32 @@ func (srv *Server) setupHandlers() http.Handler {
 	return mux
 }
 
+// reservedUsernames lists the top-level paths that the server handles
+// itself.  Data sets are served under /{user}/, so an account with one of
+// these names would be hidden by the handler.
+var reservedUsernames = []string{
+	"about",
+	"account",
+	"admin",
+	"assets",
+	"catalog",
+	"catalog.ttl",
+	"login",
+	"logout",
+	"plot-time-series",
+	"resources",
+	"search",
+	"stripesassets",
+	"terms",
+	"uploads",
+}
+
+// ReservedUsername returns true if username is the name of a top-level path
+// of the server, which may not be used for an account.
+func ReservedUsername(username string) bool {
+	return indexOf(reservedUsernames, username) != -1
+}
+
 func composeURL(scheme, host, port string) string {
 
 	if (port == "80" && scheme == "http") || (port == "443" && scheme == "https") {
@@ -230,6 +341,10 @@ func (srv *Server) ListenAndServe() error {
 
 	srv.log("Starting server")
 
+	if srv.PasswordPolicy != nil {
+		SetPasswordPolicy(srv.PasswordPolicy)
+	}
+
 	if srv.Debug {
 		srv.log("Setting up storage access")
 	}
@@ -239,6 +354,49 @@ func (srv *Server) ListenAndServe() error {
 		return err
 	}
 	defer srv.storage.Close()
+	if err := srv.addMissingRevisions(); err != nil {
+		err = fmt.Errorf("Error minting ARKs: %v", err)
+		srv.logExitError(err.Error())
+		return err
+	}
+
+	if srv.Debug {
+		srv.log("Building search index")
+	}
+	if err := srv.setupSearch(); err != nil {
+		err = fmt.Errorf("Error building search index: %v", err)
+		srv.logExitError(err.Error())
+		return err
+	}
+
+	if srv.Debug {
+		srv.log("Setting up authentication")
+	}
+	if err := srv.setupAuth(); err != nil {
+		err = fmt.Errorf("Error setting up authentication: %v", err)
+		srv.logExitError(err.Error())
+		return err
+	}
+
+	if srv.Debug {
+		srv.log("Loading metadata vocabularies")
+	}
+	var err error
+	srv.vocab, err = newVocabulary(srv.VocabularyPrefixes,
+		srv.VocabularyClosed, srv.VocabularyFiles)
+	if err != nil {
+		err = fmt.Errorf("Error loading vocabulary: %v", err)
+		srv.logExitError(err.Error())
+		return err
+	}
+
+	if srv.CACertFile != "" {
+		if fetchClient, err = newFetchClient(srv.CACertFile); err != nil {
+			err = fmt.Errorf("Error reading CA certificates: %v", err)
+			srv.logExitError(err.Error())
+			return err
+		}
+	}
 
 	if srv.Debug {
 		srv.log("Ensuring data directory \"%s\" exists", srv.DataDir)
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"time"
+)
+
+// sessionLifetime is how long a session token issued by /login remains
+// valid.
+const sessionLifetime = 30 * 24 * time.Hour
+
+// newSessionToken creates a session token for a user and stores its hash.
+// Only the hash is stored, so the token cannot be recovered from the
+// database.
+func newSessionToken(storage Storage, username string) (string, time.Time,
+	error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b[:])
+	expires := time.Now().Add(sessionLifetime)
+	err := storage.AddSession(username, hashToken(token), expires)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// sessionAuthenticator verifies bearer tokens issued by /login.  It does not
+// verify passwords.
+type sessionAuthenticator struct {
+	storage Storage
+}
+
+func (a *sessionAuthenticator) Name() string {
+	return "session"
+}
+
+func (a *sessionAuthenticator) Authenticate(username, password string) (
+	Identity, bool, error) {
+	return Identity{}, false, nil
+}
+
+func (a *sessionAuthenticator) AuthenticateToken(token string) (Identity,
+	bool, error) {
+	username, err := a.storage.LookupSession(hashToken(token))
+	if err == sql.ErrNoRows {
+		return Identity{}, false, nil
+	}
+	if err != nil {
+		return Identity{}, false, err
+	}
+	return Identity{Username: username}, true, nil
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sessionStorage is a personStorage that also keeps sessions and login
+// failures.
+type sessionStorage struct {
+	personStorage
+	mu       sync.Mutex
+	sessions map[string]string
+	failures map[string]int
+}
+
+func (s *sessionStorage) AddSession(username, tokenHash string,
+	expires time.Time) error {
+	s.sessions[tokenHash] = username
+	return nil
+}
+
+func (s *sessionStorage) LookupSession(tokenHash string) (string, error) {
+	username, ok := s.sessions[tokenHash]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return username, nil
+}
+
+func (s *sessionStorage) DeleteSession(tokenHash string) error {
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+func (s *sessionStorage) ChangePassword(username, password string) error {
+	s.people[username].password = password
+	for h, u := range s.sessions {
+		if u == username {
+			delete(s.sessions, h)
+		}
+	}
+	return nil
+}
+
+func (s *sessionStorage) LookupAccountDisabled(username string) (bool,
+	error) {
+	return false, nil
+}
+
+func (s *sessionStorage) LookupLoginFailures(username string) (int,
+	time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures[username], time.Now(), nil
+}
+
+func (s *sessionStorage) RecordLoginFailure(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[username]++
+	return nil
+}
+
+func (s *sessionStorage) ResetLoginFailures(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, username)
+	return nil
+}
+
+func (s *sessionStorage) AddAuditEvent(e *AuditEvent) error {
+	return nil
+}
+
+func newSessionServer(t *testing.T) (*Server, *sessionStorage, string) {
+	st := &sessionStorage{
+		personStorage: personStorage{people: map[string]*testPerson{
+			"alice": {password: "secret"},
+		}},
+		sessions: map[string]string{},
+		failures: map[string]int{},
+	}
+	srv := &Server{storage: st}
+	srv.authenticators = []Authenticator{
+		&sessionAuthenticator{storage: st},
+		&passwordAuthenticator{storage: st},
+	}
+	token, _, err := newSessionToken(st, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, st, token
+}
+
+func TestChangePasswordWithToken(t *testing.T) {
+	srv, st, token := newSessionServer(t)
+	for _, c := range []struct {
+		body     string
+		code     int
+		failures int
+	}{
+		{`{"password":"new password"}`, http.StatusForbidden, 0},
+		{`{"password":"new password","currentPassword":"wrong"}`,
+			http.StatusForbidden, 1},
+		{`{"password":"new password","currentPassword":"secret"}`,
+			http.StatusCreated, 0},
+	} {
+		r := httptest.NewRequest("POST", "/account/password",
+			strings.NewReader(c.body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		srv.handleChangePassword(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s: status %d, want %d", c.body, w.Code, c.code)
+		}
+		if st.failures["alice"] != c.failures {
+			t.Errorf("%s: %d failures, want %d", c.body,
+				st.failures["alice"], c.failures)
+		}
+	}
+	if st.people["alice"].password != "new password" {
+		t.Errorf("password not changed")
+	}
+	if len(st.sessions) != 0 {
+		t.Errorf("sessions not revoked: %v", st.sessions)
+	}
+}
+
+func TestChangePasswordWithBasicAuth(t *testing.T) {
+	srv, st, _ := newSessionServer(t)
+	r := httptest.NewRequest("POST", "/account/password",
+		strings.NewReader(`{"password":"new password"}`))
+	r.SetBasicAuth("alice", "secret")
+	w := httptest.NewRecorder()
+	srv.handleChangePassword(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if st.people["alice"].password != "new password" {
+		t.Errorf("password not changed")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	srv, st, token := newSessionServer(t)
+	other, _, err := newSessionToken(st, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusBadRequest},
+		{"Bearer " + token, http.StatusNoContent},
+		{"Bearer " + token, http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("POST", "/logout", nil)
+		if c.auth != "" {
+			r.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		srv.handleLogout(w, r)
+		if w.Code != c.code {
+			t.Errorf("%q: status %d, want %d", c.auth, w.Code, c.code)
+		}
+	}
+	if _, err = st.LookupSession(hashToken(other)); err != nil {
+		t.Errorf("other session revoked")
+	}
+}
+
+// tokenAuthenticator accepts one bearer token for an external identity.
+type tokenAuthenticator struct {
+	stubAuthenticator
+	token string
+}
+
+func (a *tokenAuthenticator) AuthenticateToken(token string) (Identity,
+	bool, error) {
+	return a.id, token == a.token, nil
+}
+
+func TestLoginRejectsSessionToken(t *testing.T) {
+	srv, st, token := newSessionServer(t)
+	srv.authenticators = append(srv.authenticators, &tokenAuthenticator{
+		stubAuthenticator: stubAuthenticator{name: "oidc",
+			id: Identity{Username: "bob", Subject: "s-bob"}},
+		token: "external",
+	})
+	for _, c := range []struct {
+		user, password, bearer string
+		code                   int
+	}{
+		// A session token cannot be renewed by logging in with it.
+		{"", "", token, http.StatusUnauthorized},
+		{"alice", "secret", "", http.StatusCreated},
+		{"", "", "external", http.StatusCreated},
+	} {
+		r := httptest.NewRequest("POST", "/login",
+			strings.NewReader(`{}`))
+		if c.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+c.bearer)
+		} else {
+			r.SetBasicAuth(c.user, c.password)
+		}
+		w := httptest.NewRecorder()
+		srv.handleLogin(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s%s: status %d, want %d", c.user, c.bearer,
+				w.Code, c.code)
+		}
+	}
+	if len(st.sessions) != 3 {
+		t.Errorf("%d sessions, want 3", len(st.sessions))
+	}
+	// The session token is still accepted elsewhere.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if user, ok := srv.handleBasicAuth(httptest.NewRecorder(), r); !ok ||
+		user != "alice" {
+		t.Errorf("session token rejected: %q", user)
+	}
+}
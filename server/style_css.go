@@ -33,6 +33,33 @@ h1
     margin-bottom: 1.5em;
 }
 
+div.metadata
+{
+    font-family: sans-serif, "Times New Roman", "Roman", serif;
+    max-width: 7in;
+    margin-bottom: 1.5em;
+}
+
+div.metadata h2
+{
+    color: #458;
+    font-size: 16px;
+    font-weight: 500;
+}
+
+div.metadata dt
+{
+    float: left;
+    clear: left;
+    width: 11em;
+    color: #458;
+}
+
+div.metadata dd
+{
+    margin-left: 11em;
+}
+
 th#sc:hover
 {
     cursor: pointer;
@@ -138,5 +165,25 @@ input
 a {
     text-decoration: none;
 }
+
+p.tabs a
+{
+    font-family: sans-serif, "Times New Roman", "Roman", serif;
+    color: #458;
+    border: 1px solid #458;
+    padding: 4px 10px;
+    margin-right: 4px;
+}
+
+p.tabs a.current
+{
+    background-color: #458;
+    color: white;
+}
+
+table.dict td
+{
+    white-space: normal;
+}
 `
 }
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Failed logins are throttled per username and per client IP address.  After
+// backoffThreshold consecutive failures, each further attempt must wait twice
+// as long as the previous one, up to backoffMax.  After lockoutThreshold
+// failures, further attempts are refused until lockoutDuration has passed
+// since the last failure, or until an administrator unlocks the account.
+const (
+	userBackoffThreshold = 3
+	userLockoutThreshold = 10
+	ipBackoffThreshold   = 10
+	ipLockoutThreshold   = 50
+	backoffMax           = time.Minute
+	lockoutDuration      = 15 * time.Minute
+)
+
+// loginDelay returns how long a client must wait after failures consecutive
+// failed logins, the last of which occurred at last.  locked is true if the
+// wait is due to a lockout rather than backoff.
+func loginDelay(failures int, last time.Time, backoffThreshold,
+	lockoutThreshold int) (wait time.Duration, locked bool) {
+
+	if failures < backoffThreshold {
+		return 0, false
+	}
+	var d time.Duration
+	if failures >= lockoutThreshold {
+		d = lockoutDuration
+		locked = true
+	} else {
+		// Clamp the exponent so that the shift cannot overflow.
+		d = backoffMax
+		if n := failures - backoffThreshold; n < 16 {
+			d = time.Second << uint(n)
+		}
+		if d > backoffMax {
+			d = backoffMax
+		}
+	}
+	wait = time.Until(last.Add(d))
+	if wait <= 0 {
+		return 0, false
+	}
+	return wait, locked
+}
+
+type ipFailures struct {
+	failures int
+	last     time.Time
+}
+
+// ipThrottle records failed logins per client IP address.  Unlike per-user
+// failures, these are kept in memory only.
+type ipThrottle struct {
+	mu sync.Mutex
+	m  map[string]*ipFailures
+}
+
+func (t *ipThrottle) delay(ip string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var f = t.m[ip]
+	if f == nil {
+		return 0, false
+	}
+	return loginDelay(f.failures, f.last, ipBackoffThreshold,
+		ipLockoutThreshold)
+}
+
+func (t *ipThrottle) fail(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var now = time.Now()
+	if t.m == nil {
+		t.m = make(map[string]*ipFailures)
+	}
+	// Forget addresses that have not failed recently.
+	if len(t.m) > 10000 {
+		for k, f := range t.m {
+			if now.Sub(f.last) > lockoutDuration {
+				delete(t.m, k)
+			}
+		}
+	}
+	var f = t.m[ip]
+	if f == nil {
+		f = &ipFailures{}
+		t.m[ip] = f
+	}
+	f.failures++
+	f.last = now
+}
+
+func (t *ipThrottle) reset(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.m, ip)
+}
+
+// unlock forgets the failures from ip that occurred before unlocked, the time
+// an administrator unlocked the address.
+func (t *ipThrottle) unlock(ip string, unlocked time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f := t.m[ip]; f != nil && !f.last.After(unlocked) {
+		delete(t.m, ip)
+	}
+}
+
+// remoteIP returns the IP address of the client that sent r.
+func remoteIP(r *http.Request) string {
+	var host, _, err = net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ipDelay returns how long a request from ip must wait after failed logins
+// or other failed attempts from that address.  Failures are counted in
+// memory, so an address unlocked by glintserver, which runs in another
+// process, is looked up in storage when the address is throttled.
+func (srv *Server) ipDelay(ip string) (time.Duration, bool) {
+	var wait, locked = srv.ipThrottle.delay(ip)
+	if wait == 0 {
+		return wait, locked
+	}
+	var unlocked, err = srv.storage.LookupAddressUnlock(ip)
+	if err != nil {
+		srv.log("Error looking up address unlock: %v", err)
+		return wait, locked
+	}
+	if unlocked.IsZero() {
+		return wait, locked
+	}
+	srv.ipThrottle.unlock(ip, unlocked)
+	return srv.ipThrottle.delay(ip)
+}
+
+// loginWait returns how long a login attempt for username from ip must wait
+// before it will be considered.
+func (srv *Server) loginWait(username, ip string) (time.Duration, bool) {
+	var wait, locked = srv.ipDelay(ip)
+	if username == "" {
+		return wait, locked
+	}
+	var failures, last, err = srv.storage.LookupLoginFailures(username)
+	if err != nil {
+		srv.log("Error looking up login failures: %v", err)
+		return wait, locked
+	}
+	var uwait, ulocked = loginDelay(failures, last, userBackoffThreshold,
+		userLockoutThreshold)
+	if uwait > wait {
+		return uwait, ulocked
+	}
+	return wait, locked
+}
+
+// loginFailed records a failed login for username from ip.  Failures are
+// recorded per username only for existing accounts; other usernames are
+// throttled by address.
+func (srv *Server) loginFailed(username, ip string) {
+	srv.ipThrottle.fail(ip)
+	if username == "" {
+		return
+	}
+	if err := srv.storage.RecordLoginFailure(username); err != nil {
+		srv.log("Error recording login failure: %v", err)
+	}
+}
+
+// loginSucceeded clears the failed logins for username and ip.
+func (srv *Server) loginSucceeded(username, ip string) {
+	srv.ipThrottle.reset(ip)
+	if err := srv.storage.ResetLoginFailures(username); err != nil {
+		srv.log("Error resetting login failures: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	last := time.Now()
+	for _, c := range []struct {
+		failures int
+		min, max time.Duration
+		locked   bool
+	}{
+		{0, 0, 0, false},
+		{2, 0, 0, false},
+		{3, 0, time.Second, false},
+		{4, time.Second, 2 * time.Second, false},
+		{9, 32 * time.Second, backoffMax, false},
+		{10, lockoutDuration - time.Minute, lockoutDuration, true},
+	} {
+		wait, locked := loginDelay(c.failures, last,
+			userBackoffThreshold, userLockoutThreshold)
+		if wait < c.min || wait > c.max || locked != c.locked {
+			t.Errorf("%d failures: wait %v, locked %v", c.failures,
+				wait, locked)
+		}
+	}
+	// Shifts past the width of a Duration must not wrap around to a
+	// short or negative delay.
+	for _, failures := range []int{20, 40, 64, 70, 100} {
+		wait, _ := loginDelay(failures, last, 3, 1000)
+		if wait < backoffMax-time.Second || wait > backoffMax {
+			t.Errorf("%d failures: wait %v", failures, wait)
+		}
+	}
+	if wait, _ := loginDelay(5, last.Add(-time.Hour), 3, 10); wait != 0 {
+		t.Errorf("expired backoff: wait %v", wait)
+	}
+}
+
+func TestIPThrottleUnlock(t *testing.T) {
+	var th ipThrottle
+	for i := 0; i < ipLockoutThreshold; i++ {
+		th.fail("192.0.2.1")
+		th.fail("192.0.2.2")
+	}
+	if _, locked := th.delay("192.0.2.1"); !locked {
+		t.Fatalf("address not locked")
+	}
+	// An unlock before the last failure does not apply.
+	th.unlock("192.0.2.1", time.Now().Add(-time.Hour))
+	if _, locked := th.delay("192.0.2.1"); !locked {
+		t.Errorf("address unlocked by an earlier unlock")
+	}
+	th.unlock("192.0.2.1", time.Now())
+	if wait, _ := th.delay("192.0.2.1"); wait != 0 {
+		t.Errorf("address still throttled after unlock: %v", wait)
+	}
+	if _, locked := th.delay("192.0.2.2"); !locked {
+		t.Errorf("other address unlocked")
+	}
+}
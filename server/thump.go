@@ -2,70 +2,277 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
 // ParseBasic makes a very rudimentary parse of a thump command sequence.
+// Arguments are percent-decoded after they are split, so that they may
+// contain escaped commas and parentheses.
 func thumpParseBasic(r *http.Request) map[string][]string {
-	var cmdlist []string = strings.Split(r.URL.RawQuery, ")")
+	return thumpParse(r.URL.RawQuery)
+}
+
+// thumpParse parses a thump command sequence such as
+// "where(a>1)show(a,b)", as in the query of a request URL.
+func thumpParse(query string) map[string][]string {
+	var cmdlist []string = strings.Split(query, ")")
 	var m = make(map[string][]string)
 	var x int
 	for x = range cmdlist {
 		if cmdlist[x] != "" {
-			var cmd_args []string = strings.Split(cmdlist[x], "(")
-			m[cmd_args[0]] = strings.Split(cmd_args[1], ",")
+			var cmd_args []string = strings.SplitN(cmdlist[x], "(", 2)
+			if len(cmd_args) < 2 {
+				m[cmd_args[0]] = []string{}
+				continue
+			}
+			var args []string = strings.Split(cmd_args[1], ",")
+			var y int
+			for y = range args {
+				var a string
+				var err error
+				a, err = url.PathUnescape(args[y])
+				if err == nil {
+					args[y] = a
+				}
+			}
+			m[cmd_args[0]] = args
 		}
 	}
 	return m
 }
 
-// ShowBasic writes columnar data, selecting only columns specified by show.
-func thumpShowBasic(data string, show []string) string {
-	var out bytes.Buffer
-	var show_n []int
-	var rows []string = strings.Split(data, "\n")
+// thumpCondition is a comparison in a where command.
+type thumpCondition struct {
+	attr  string
+	op    string
+	value string
+}
+
+// thumpOperators lists comparison operators, with two-character operators
+// first so that they are matched before their prefixes.
+var thumpOperators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+func thumpParseCondition(s string) (thumpCondition, error) {
+	for _, op := range thumpOperators {
+		var i int = strings.Index(s, op)
+		if i > 0 {
+			return thumpCondition{
+				attr:  strings.TrimSpace(s[:i]),
+				op:    op,
+				value: strings.TrimSpace(s[i+len(op):]),
+			}, nil
+		}
+	}
+	return thumpCondition{}, fmt.Errorf("Invalid condition: %s", s)
+}
+
+// match compares a value with the condition.  Values are compared as
+// numbers if both can be parsed as numbers, and otherwise as strings.
+func (c thumpCondition) match(v string) bool {
+	var cmp int
+	x, errx := strconv.ParseFloat(v, 64)
+	y, erry := strconv.ParseFloat(c.value, 64)
+	if errx == nil && erry == nil {
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(v, c.value)
+	}
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// thumpApply selects the rows and columns of data specified by the where
+// and show commands in thp, and converts units as specified by the units
+// command.  Rows are selected before units are converted, so conditions
+// are in the units of the data set.  The unit of each attribute is
+// returned by unitOf.
+func thumpApply(data string, thp map[string][]string,
+	unitOf func(attr string) string) (string, error) {
+	var err error
+	if thp["where"] != nil {
+		data, err = thumpWhereBasic(data, thp["where"])
+		if err != nil {
+			return "", err
+		}
+	}
+	if thp["units"] != nil {
+		var units map[string]string
+		units, err = thumpParseUnits(thp["units"])
+		if err != nil {
+			return "", err
+		}
+		data, err = thumpUnits(data, units, unitOf)
+		if err != nil {
+			return "", err
+		}
+	}
+	if thp["show"] != nil {
+		data, err = thumpShowBasic(data, thp["show"])
+		if err != nil {
+			return "", err
+		}
+	}
+	return data, nil
+}
+
+// WhereBasic writes columnar data, selecting only rows that satisfy all of
+// the conditions specified by where.
+func thumpWhereBasic(data string, where []string) (string, error) {
+	var conds []thumpCondition
 	var x int
-	for x = range rows {
-		if rows[x] == "" {
-			continue
+	for x = range where {
+		var c thumpCondition
+		var err error
+		c, err = thumpParseCondition(where[x])
+		if err != nil {
+			return "", err
 		}
-		var d []string = strings.Split(rows[x], ",")
-		if x == 0 {
-			var first bool = true
-			var y int
-			for y = range d {
-				var z int
-				for z = range show {
-					if d[y] == show[z] {
-						if first {
-							first = false
-						} else {
-							out.WriteString(",")
-						}
-						out.WriteString(show[z])
-						show_n = append(show_n, y)
-					}
-				}
+		conds = append(conds, c)
+	}
+	var records [][]string
+	var err error
+	records, err = readCSV(data)
+	if err != nil || len(records) == 0 {
+		return data, err
+	}
+	var out = [][]string{records[0]}
+	var cols []int
+	for x = range conds {
+		var n int = indexOf(records[0], conds[x].attr)
+		if n == -1 {
+			return "", fmt.Errorf("Attribute not found: %s",
+				conds[x].attr)
+		}
+		cols = append(cols, n)
+	}
+	for _, d := range records[1:] {
+		var ok bool = true
+		var y int
+		for y = range conds {
+			if cols[y] >= len(d) || !conds[y].match(d[cols[y]]) {
+				ok = false
+				break
 			}
-		} else {
-			var first bool = true
-			var y int
-			for y = range d {
-				var z int
-				for z = range show_n {
-					if y == show_n[z] {
-						if first {
-							first = false
-						} else {
-							out.WriteString(",")
-						}
-						out.WriteString(d[y])
-					}
-				}
+		}
+		if ok {
+			out = append(out, d)
+		}
+	}
+	return writeCSV(out)
+}
+
+func indexOf(s []string, v string) int {
+	var x int
+	for x = range s {
+		if s[x] == v {
+			return x
+		}
+	}
+	return -1
+}
+
+// AsJSON converts columnar data to a JSON array with one object per row.
+// Values that are numbers are written as JSON numbers, and empty values as
+// null.
+func thumpAsJSON(data string) ([]byte, error) {
+	var records [][]string
+	var err error
+	records, err = readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	var out = []json.RawMessage{}
+	if len(records) == 0 {
+		return json.Marshal(out)
+	}
+	var header []string = records[0]
+	for _, d := range records[1:] {
+		var b bytes.Buffer
+		b.WriteString("{")
+		var y int
+		for y = range header {
+			if y > 0 {
+				b.WriteString(",")
+			}
+			var k []byte
+			k, _ = json.Marshal(header[y])
+			b.Write(k)
+			b.WriteString(":")
+			var v string
+			if y < len(d) {
+				v = d[y]
+			}
+			var f float64
+			var err error
+			f, err = strconv.ParseFloat(v, 64)
+			switch {
+			case v == "":
+				b.WriteString("null")
+			case err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) &&
+				json.Valid([]byte(v)):
+				b.WriteString(v)
+			default:
+				var s []byte
+				s, _ = json.Marshal(v)
+				b.Write(s)
+			}
+		}
+		b.WriteString("}")
+		out = append(out, b.Bytes())
+	}
+	return json.Marshal(out)
+}
+
+// ShowBasic writes columnar data, selecting only columns specified by show.
+// The columns remain in the order of the data.
+func thumpShowBasic(data string, show []string) (string, error) {
+	var records [][]string
+	var err error
+	records, err = readCSV(data)
+	if err != nil || len(records) == 0 {
+		return data, err
+	}
+	var show_n []int
+	var y int
+	for y = range records[0] {
+		if indexOf(show, records[0][y]) != -1 {
+			show_n = append(show_n, y)
+		}
+	}
+	var out = make([][]string, len(records))
+	var x int
+	for x = range records {
+		out[x] = make([]string, 0, len(show_n))
+		for _, y = range show_n {
+			if y < len(records[x]) {
+				out[x] = append(out[x], records[x][y])
+			} else {
+				out[x] = append(out[x], "")
 			}
 		}
-		out.WriteString("\n")
 	}
-	return out.String()
+	return writeCSV(out)
 }
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestThumpParse(t *testing.T) {
+	for _, c := range []struct {
+		query string
+		want  map[string][]string
+	}{
+		{"", map[string][]string{}},
+		{"where(a>1)show(a,b)", map[string][]string{
+			"where": {"a>1"},
+			"show":  {"a", "b"},
+		}},
+		{"where(name=a%2Cb%29)", map[string][]string{
+			"where": {"name=a,b)"},
+		}},
+		{"where(x=%zz)", map[string][]string{"where": {"x=%zz"}}},
+	} {
+		if got := thumpParse(c.query); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("thumpParse(%q) = %v, want %v", c.query, got,
+				c.want)
+		}
+	}
+}
+
+func TestThumpApply(t *testing.T) {
+	data := "name,t,p\nx,10,1000\ny,20,1013.25\nz,,990\n"
+	for _, c := range []struct {
+		query, want string
+	}{
+		{"where(t>=15)", "name,t,p\ny,20,1013.25\n"},
+		{"where(name!=y)show(p,name)", "name,p\nx,1000\nz,990\n"},
+	} {
+		got, err := thumpApply(data, thumpParse(c.query), nil)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.query, got, c.want)
+		}
+	}
+	for _, q := range []string{"where(q>1)", "where(t)"} {
+		if _, err := thumpApply(data, thumpParse(q), nil); err == nil {
+			t.Errorf("%s: no error", q)
+		}
+	}
+}
+
+func TestThumpQuotedValues(t *testing.T) {
+	data := "name,note,v\n\"Smith, J\",\"said \"\"hi\"\"\n twice\",1\n" +
+		"Jones,,2\n"
+	got, err := thumpApply(data, thumpParse("where(v>1)show(name,v)"),
+		nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name,v\nJones,2\n"; got != want {
+		t.Errorf("where: got %q, want %q", got, want)
+	}
+	got, err = thumpApply(data, thumpParse("where(name=Smith%2C J)"+
+		"show(note)"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "note\n\"said \"\"hi\"\"\n twice\"\n"; got != want {
+		t.Errorf("show: got %q, want %q", got, want)
+	}
+	b, err := thumpAsJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"Smith, J","note":"said \"hi\"\n twice","v":1},` +
+		`{"name":"Jones","note":null,"v":2}]`
+	if string(b) != want {
+		t.Errorf("json: got %s, want %s", b, want)
+	}
+}
@@ -0,0 +1,430 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Dimensions of UCUM base units, which index a unit's dimension vector.
+const (
+	dimLength = iota
+	dimMass
+	dimTime
+	dimTemperature
+	dimAngle
+	dimCharge
+	dimAmount
+	dimLuminosity
+	numDimensions
+)
+
+// unit is a unit of measure, defined by its dimensions and the factor and
+// offset that convert a value to the base units: base = value*factor +
+// offset.  Only temperature scales such as Cel have an offset.
+type unit struct {
+	dims   [numDimensions]int
+	factor float64
+	offset float64
+}
+
+// unitDef defines a unit in terms of a UCUM expression.  Metric units may
+// be used with prefixes.
+type unitDef struct {
+	expr   string
+	factor float64
+	offset float64
+	metric bool
+}
+
+// baseUnits are the UCUM base units.
+var baseUnits = map[string]int{
+	"m":   dimLength,
+	"g":   dimMass,
+	"s":   dimTime,
+	"K":   dimTemperature,
+	"rad": dimAngle,
+	"C":   dimCharge,
+	"mol": dimAmount,
+	"cd":  dimLuminosity,
+}
+
+// unitTable is the built-in table of units, a subset of UCUM covering the
+// units commonly used in environmental and physical data.  Each unit is
+// defined as a factor times an expression in other units of the table or
+// base units.
+var unitTable = map[string]unitDef{
+	// Dimensionless
+	"1":      {"1", 1, 0, false},
+	"%":      {"1", 0.01, 0, false},
+	"[ppth]": {"1", 1e-3, 0, false},
+	"[ppm]":  {"1", 1e-6, 0, false},
+	"[ppb]":  {"1", 1e-9, 0, false},
+
+	// Length
+	"[in_i]":  {"m", 0.0254, 0, false},
+	"[ft_i]":  {"m", 0.3048, 0, false},
+	"[yd_i]":  {"m", 0.9144, 0, false},
+	"[mi_i]":  {"m", 1609.344, 0, false},
+	"[nmi_i]": {"m", 1852, 0, false},
+	"Ao":      {"m", 1e-10, 0, false},
+
+	// Area and volume
+	"ar":       {"m2", 100, 0, true},
+	"[acr_i]":  {"m2", 4046.8564224, 0, false},
+	"L":        {"m3", 1e-3, 0, true},
+	"l":        {"m3", 1e-3, 0, true},
+	"[gal_us]": {"m3", 3.785411784e-3, 0, false},
+
+	// Mass
+	"t":       {"g", 1e6, 0, true},
+	"[lb_av]": {"g", 453.59237, 0, false},
+	"[oz_av]": {"g", 28.349523125, 0, false},
+
+	// Time
+	"min": {"s", 60, 0, false},
+	"h":   {"s", 3600, 0, false},
+	"d":   {"s", 86400, 0, false},
+	"wk":  {"s", 604800, 0, false},
+	"a":   {"s", 31557600, 0, false},
+	"Hz":  {"s-1", 1, 0, true},
+
+	// Temperature
+	"Cel":    {"K", 1, 273.15, false},
+	"[degF]": {"K", 5.0 / 9, 459.67 * 5 / 9, false},
+	"[degR]": {"K", 5.0 / 9, 0, false},
+
+	// Angle
+	"deg": {"rad", math.Pi / 180, 0, false},
+	"'":   {"rad", math.Pi / 180 / 60, 0, false},
+	"''":  {"rad", math.Pi / 180 / 3600, 0, false},
+	"gon": {"rad", math.Pi / 200, 0, false},
+
+	// Speed
+	"[kn_i]": {"m/s", 1852.0 / 3600, 0, false},
+
+	// Force, pressure, energy, and power
+	"N":         {"kg.m/s2", 1, 0, true},
+	"Pa":        {"N/m2", 1, 0, true},
+	"bar":       {"Pa", 1e5, 0, true},
+	"atm":       {"Pa", 101325, 0, false},
+	"m[Hg]":     {"Pa", 133322, 0, true},
+	"m[H2O]":    {"Pa", 9806.65, 0, true},
+	"[in_i'Hg]": {"Pa", 3386.38815789, 0, false},
+	"[psi]":     {"Pa", 6894.75729317, 0, false},
+	"J":         {"N.m", 1, 0, true},
+	"cal":       {"J", 4.184, 0, true},
+	"W":         {"J/s", 1, 0, true},
+
+	// Electricity and light
+	"A":  {"C/s", 1, 0, true},
+	"V":  {"J/C", 1, 0, true},
+	"S":  {"A/V", 1, 0, true},
+	"lx": {"cd/m2", 1, 0, true},
+}
+
+// unitPrefixes are the UCUM metric prefixes, with "da" before "d" so that
+// it is matched first.
+var unitPrefixes = []struct {
+	symbol string
+	factor float64
+}{
+	{"Y", 1e24}, {"Z", 1e21}, {"E", 1e18}, {"P", 1e15}, {"T", 1e12},
+	{"G", 1e9}, {"M", 1e6}, {"k", 1e3}, {"h", 1e2}, {"da", 1e1},
+	{"d", 1e-1}, {"c", 1e-2}, {"m", 1e-3}, {"u", 1e-6}, {"n", 1e-9},
+	{"p", 1e-12}, {"f", 1e-15}, {"a", 1e-18}, {"z", 1e-21}, {"y", 1e-24},
+}
+
+// parseUnit parses a UCUM unit expression, such as "Cel", "hPa", "m/s", or
+// "kg.m-2".  Units with an offset, such as Cel, cannot be combined with
+// other units.  Annotations in braces, e.g. "{rain}", are ignored.
+func parseUnit(expr string) (*unit, error) {
+	var p = unitParser{s: expr}
+	var u, err = p.term()
+	if err == nil && p.x < len(p.s) {
+		err = fmt.Errorf("unexpected '%c'", p.s[p.x])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unknown unit '%s': %s", expr, err)
+	}
+	return u, nil
+}
+
+// unitParser parses a UCUM expression.
+type unitParser struct {
+	s string
+	x int
+}
+
+// term parses components joined by "." (multiplication) or "/"
+// (division).  A term may begin with "/".
+func (p *unitParser) term() (*unit, error) {
+	var u = &unit{factor: 1}
+	var op byte = '.'
+	if p.x < len(p.s) && p.s[p.x] == '/' {
+		op = '/'
+		p.x++
+	}
+	var n int
+	for {
+		var c, err = p.component()
+		if err != nil {
+			return nil, err
+		}
+		n++
+		if c.offset != 0 && (n > 1 || op != '.') {
+			return nil, fmt.Errorf("a unit with an offset cannot " +
+				"be combined with other units")
+		}
+		if op == '/' {
+			c = c.pow(-1)
+		}
+		if u.offset != 0 {
+			return nil, fmt.Errorf("a unit with an offset cannot " +
+				"be combined with other units")
+		}
+		u = u.mul(c)
+		if p.x >= len(p.s) || (p.s[p.x] != '.' && p.s[p.x] != '/') {
+			return u, nil
+		}
+		op = p.s[p.x]
+		p.x++
+	}
+}
+
+// component parses a unit symbol with an optional exponent, a term in
+// parentheses, a number, or an annotation.
+func (p *unitParser) component() (*unit, error) {
+	if p.x >= len(p.s) {
+		return nil, fmt.Errorf("unit expected")
+	}
+	switch {
+	case p.s[p.x] == '(':
+		p.x++
+		var u, err = p.term()
+		if err != nil {
+			return nil, err
+		}
+		if p.x >= len(p.s) || p.s[p.x] != ')' {
+			return nil, fmt.Errorf("')' expected")
+		}
+		p.x++
+		return u, nil
+	case p.s[p.x] == '{':
+		if err := p.annotation(); err != nil {
+			return nil, err
+		}
+		return &unit{factor: 1}, nil
+	}
+	var start int = p.x
+	for p.x < len(p.s) && !strings.ContainsRune(".()/{", rune(p.s[p.x])) {
+		if p.s[p.x] == '[' {
+			var end int = strings.IndexByte(p.s[p.x:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("']' expected")
+			}
+			p.x += end
+		}
+		p.x++
+	}
+	var symbol string = p.s[start:p.x]
+	if p.x < len(p.s) && p.s[p.x] == '{' {
+		if err := p.annotation(); err != nil {
+			return nil, err
+		}
+	}
+	if symbol == "" {
+		return nil, fmt.Errorf("unit expected")
+	}
+	if n, err := strconv.Atoi(symbol); err == nil {
+		return &unit{factor: float64(n)}, nil
+	}
+	// An exponent is a trailing integer, e.g. "m2" or "s-1".
+	var e int = len(symbol)
+	for e > 0 && symbol[e-1] >= '0' && symbol[e-1] <= '9' {
+		e--
+	}
+	if e > 0 && e < len(symbol) && (symbol[e-1] == '-' ||
+		symbol[e-1] == '+') {
+		e--
+	}
+	var exp int = 1
+	if e > 0 && e < len(symbol) {
+		exp, _ = strconv.Atoi(symbol[e:])
+		symbol = symbol[:e]
+	}
+	var u, err = lookupUnit(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if exp != 1 {
+		if u.offset != 0 {
+			return nil, fmt.Errorf("a unit with an offset cannot " +
+				"have an exponent")
+		}
+		u = u.pow(exp)
+	}
+	return u, nil
+}
+
+// annotation skips an annotation in braces.
+func (p *unitParser) annotation() error {
+	var end int = strings.IndexByte(p.s[p.x:], '}')
+	if end < 0 {
+		return fmt.Errorf("'}' expected")
+	}
+	p.x += end + 1
+	return nil
+}
+
+// lookupUnit returns the unit with a symbol, which may have a metric
+// prefix.
+func lookupUnit(symbol string) (*unit, error) {
+	if d, ok := baseUnits[symbol]; ok {
+		var u = &unit{factor: 1}
+		u.dims[d] = 1
+		return u, nil
+	}
+	if def, ok := unitTable[symbol]; ok {
+		return defineUnit(&def)
+	}
+	for _, prefix := range unitPrefixes {
+		if !strings.HasPrefix(symbol, prefix.symbol) ||
+			symbol == prefix.symbol {
+			continue
+		}
+		var rest string = symbol[len(prefix.symbol):]
+		var u *unit
+		if d, ok := baseUnits[rest]; ok {
+			u = &unit{factor: 1}
+			u.dims[d] = 1
+		} else if def, ok := unitTable[rest]; ok && def.metric {
+			var err error
+			if u, err = defineUnit(&def); err != nil {
+				return nil, err
+			}
+		} else {
+			continue
+		}
+		return &unit{dims: u.dims, factor: u.factor * prefix.factor},
+			nil
+	}
+	return nil, fmt.Errorf("unknown symbol '%s'", symbol)
+}
+
+// defineUnit returns the unit defined by def.
+func defineUnit(def *unitDef) (*unit, error) {
+	var p = unitParser{s: def.expr}
+	var u, err = p.term()
+	if err != nil {
+		return nil, err
+	}
+	return &unit{dims: u.dims, factor: u.factor * def.factor,
+		offset: def.offset}, nil
+}
+
+// mul returns the product of two units without offsets.
+func (u *unit) mul(v *unit) *unit {
+	var w = &unit{factor: u.factor * v.factor, offset: v.offset}
+	for x := range w.dims {
+		w.dims[x] = u.dims[x] + v.dims[x]
+	}
+	return w
+}
+
+// pow returns a unit without an offset raised to a power.
+func (u *unit) pow(n int) *unit {
+	var w = &unit{factor: math.Pow(u.factor, float64(n))}
+	for x := range w.dims {
+		w.dims[x] = u.dims[x] * n
+	}
+	return w
+}
+
+// unitConverter returns a function that converts values from one unit to
+// another, or an error if the units are not compatible.
+func unitConverter(from, to string) (func(float64) float64, error) {
+	var f, t *unit
+	var err error
+	if f, err = parseUnit(from); err != nil {
+		return nil, err
+	}
+	if t, err = parseUnit(to); err != nil {
+		return nil, err
+	}
+	if f.dims != t.dims {
+		return nil, fmt.Errorf("Cannot convert %s to %s: the units "+
+			"measure different quantities", from, to)
+	}
+	return func(v float64) float64 {
+		return (v*f.factor + f.offset - t.offset) / t.factor
+	}, nil
+}
+
+// formatConverted formats a converted value, rounded to 12 significant
+// digits so that errors in floating point arithmetic are not shown.
+func formatConverted(v float64) string {
+	var r, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+	return strconv.FormatFloat(r, 'f', -1, 64)
+}
+
+// thumpParseUnits parses the arguments of a units command, each of the form
+// "attribute:unit", into a map from attribute to unit.
+func thumpParseUnits(args []string) (map[string]string, error) {
+	var units = make(map[string]string)
+	for _, a := range args {
+		var sp []string = strings.SplitN(a, ":", 2)
+		if len(sp) != 2 || strings.TrimSpace(sp[0]) == "" ||
+			strings.TrimSpace(sp[1]) == "" {
+			return nil, fmt.Errorf("Invalid unit conversion: %s "+
+				"(expected attribute:unit)", a)
+		}
+		units[strings.TrimSpace(sp[0])] = strings.TrimSpace(sp[1])
+	}
+	return units, nil
+}
+
+// thumpUnits converts the values of attributes to the units given in
+// units, a map from attribute to unit.  The current unit of each attribute
+// is returned by unitOf.  Values that are empty or not numbers are left as
+// they are.
+func thumpUnits(data string, units map[string]string,
+	unitOf func(attr string) string) (string, error) {
+	var records [][]string
+	var err error
+	records, err = readCSV(data)
+	if err != nil || len(records) == 0 {
+		return data, err
+	}
+	var convert = make(map[int]func(float64) float64)
+	for attr, to := range units {
+		var n int = indexOf(records[0], attr)
+		if n == -1 {
+			return "", fmt.Errorf("Attribute not found: %s", attr)
+		}
+		var from string = unitOf(attr)
+		if from == "" {
+			return "", fmt.Errorf("Attribute %s has no unit in its "+
+				"metadata", attr)
+		}
+		var f, err = unitConverter(from, to)
+		if err != nil {
+			return "", fmt.Errorf("%s (attribute %s)", err, attr)
+		}
+		convert[n] = f
+	}
+	for _, d := range records[1:] {
+		for n, f := range convert {
+			if n >= len(d) {
+				continue
+			}
+			var v, err = strconv.ParseFloat(strings.TrimSpace(d[n]), 64)
+			if err != nil {
+				continue
+			}
+			d[n] = formatConverted(f(v))
+		}
+	}
+	return writeCSV(records)
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+func TestParseUnit(t *testing.T) {
+	for _, c := range []struct {
+		expr   string
+		factor float64
+		offset float64
+		dims   map[int]int
+	}{
+		{"m", 1, 0, map[int]int{dimLength: 1}},
+		{"km", 1e3, 0, map[int]int{dimLength: 1}},
+		{"hPa", 1e5, 0, map[int]int{dimMass: 1, dimLength: -1,
+			dimTime: -2}},
+		{"m/s", 1, 0, map[int]int{dimLength: 1, dimTime: -1}},
+		{"kg.m-2", 1e3, 0, map[int]int{dimMass: 1, dimLength: -2}},
+		{"/s", 1, 0, map[int]int{dimTime: -1}},
+		{"m2", 1, 0, map[int]int{dimLength: 2}},
+		{"mm{rain}", 1e-3, 0, map[int]int{dimLength: 1}},
+		{"{count}", 1, 0, nil},
+		{"%", 0.01, 0, nil},
+		{"Cel", 1, 273.15, map[int]int{dimTemperature: 1}},
+		{"[degF]", 5.0 / 9, 459.67 * 5 / 9,
+			map[int]int{dimTemperature: 1}},
+		{"[in_i]", 0.0254, 0, map[int]int{dimLength: 1}},
+		{"dam", 10, 0, map[int]int{dimLength: 1}},
+		{"mL", 1e-6, 0, map[int]int{dimLength: 3}},
+		{"(m.s)/s", 1, 0, map[int]int{dimLength: 1}},
+		{"10.m", 10, 0, map[int]int{dimLength: 1}},
+	} {
+		u, err := parseUnit(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		var dims [numDimensions]int
+		for d, n := range c.dims {
+			dims[d] = n
+		}
+		if math.Abs(u.factor-c.factor) > 1e-12*c.factor ||
+			math.Abs(u.offset-c.offset) > 1e-9 || u.dims != dims {
+			t.Errorf("%s: got %+v", c.expr, *u)
+		}
+	}
+}
+
+func TestParseUnitErrors(t *testing.T) {
+	for _, expr := range []string{"", "furlong", "m/", "(m", "m)",
+		"[in_i", "{rain", "Cel/s", "m.Cel", "Cel2", "kin_i", "k[in_i]",
+		"m..s"} {
+		if _, err := parseUnit(expr); err == nil {
+			t.Errorf("%q: no error", expr)
+		}
+	}
+}
+
+func TestUnitConverter(t *testing.T) {
+	for _, c := range []struct {
+		from, to string
+		v, want  float64
+	}{
+		{"Cel", "[degF]", 100, 212},
+		{"[degF]", "K", 32, 273.15},
+		{"km/h", "m/s", 36, 10},
+		{"hPa", "bar", 1013.25, 1.01325},
+		{"%", "1", 50, 0.5},
+	} {
+		f, err := unitConverter(c.from, c.to)
+		if err != nil {
+			t.Errorf("%s to %s: %v", c.from, c.to, err)
+			continue
+		}
+		if got := formatConverted(f(c.v)); got !=
+			formatConverted(c.want) {
+			t.Errorf("%v %s to %s = %s, want %v", c.v, c.from, c.to,
+				got, c.want)
+		}
+	}
+	if _, err := unitConverter("m", "s"); err == nil {
+		t.Errorf("m to s: no error")
+	}
+}
+
+func TestThumpParseUnits(t *testing.T) {
+	if got := thumpParse("units(t:Cel,p:hPa)as(json)"); !reflect.DeepEqual(
+		got, map[string][]string{
+			"units": {"t:Cel", "p:hPa"},
+			"as":    {"json"},
+		}) {
+		t.Errorf("thumpParse = %v", got)
+	}
+	units, err := thumpParseUnits([]string{"t:Cel", " p : hPa ",
+		"r:m/s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"t": "Cel", "p": "hPa", "r": "m/s"}
+	if !reflect.DeepEqual(units, want) {
+		t.Errorf("got %v, want %v", units, want)
+	}
+	for _, arg := range []string{"t", "t:", ":K", " : "} {
+		if _, err := thumpParseUnits([]string{arg}); err == nil {
+			t.Errorf("%q: no error", arg)
+		}
+	}
+}
+
+func TestThumpUnits(t *testing.T) {
+	data := "name,t,p\nx,10,1000\ny,20,1013.25\nz,,990\nw,n/a,-\n"
+	unitOf := func(attr string) string {
+		return map[string]string{"t": "Cel", "p": "hPa"}[attr]
+	}
+	for _, c := range []struct {
+		units map[string]string
+		want  string
+	}{
+		{nil, data},
+		// Empty values and values that are not numbers are kept.
+		{map[string]string{"t": "K"},
+			"name,t,p\nx,283.15,1000\ny,293.15,1013.25\nz,,990\n" +
+				"w,n/a,-\n"},
+		{map[string]string{"t": "[degF]", "p": "kPa"},
+			"name,t,p\nx,50,100\ny,68,101.325\nz,,99\nw,n/a,-\n"},
+	} {
+		got, err := thumpUnits(data, c.units, unitOf)
+		if err != nil {
+			t.Errorf("%v: %v", c.units, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%v: got %q, want %q", c.units, got, c.want)
+		}
+	}
+	for _, units := range []map[string]string{
+		{"q": "K"},       // no such attribute
+		{"name": "K"},    // no unit in its metadata
+		{"t": "m"},       // not comparable
+		{"t": "furlong"}, // not a unit
+	} {
+		if _, err := thumpUnits(data, units, unitOf); err == nil {
+			t.Errorf("%v: no error", units)
+		}
+	}
+}
+
+func TestThumpApplyUnits(t *testing.T) {
+	data := "name,t,p\nx,10,1000\ny,20,1013.25\nz,,990\n"
+	unitOf := func(attr string) string {
+		return map[string]string{"t": "Cel", "p": "hPa"}[attr]
+	}
+	for _, c := range []struct {
+		query, want string
+	}{
+		{"where(t=10)units(t:K)", "name,t,p\nx,283.15,1000\n"},
+		{"units(p:kPa)show(p)", "p\n100\n101.325\n99\n"},
+	} {
+		got, err := thumpApply(data, thumpParse(c.query), unitOf)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.query, got, c.want)
+		}
+	}
+	for _, q := range []string{"units(q:K)", "units(name:K)",
+		"units(t:m)", "units(t)"} {
+		if _, err := thumpApply(data, thumpParse(q), unitOf); err == nil {
+			t.Errorf("%s: no error", q)
+		}
+	}
+}
+
+func TestSetMetadataUnit(t *testing.T) {
+	md := api.AttributeMetadata{Unit: "Cel"}
+	if err := setMetadata(&md, map[string]string{"unit": " km/h "}); err !=
+		nil || md.Unit != "km/h" {
+		t.Errorf("unit %q: %v", md.Unit, err)
+	}
+	if err := setMetadata(&md, map[string]string{"unit": ""}); err !=
+		nil || md.Unit != "" {
+		t.Errorf("unit %q not removed: %v", md.Unit, err)
+	}
+	md.Unit = "Cel"
+	if err := setMetadata(&md, map[string]string{"unit": "furlong"}); err ==
+		nil {
+		t.Errorf("furlong: no error")
+	}
+	if md.Unit != "Cel" {
+		t.Errorf("invalid unit stored: %q", md.Unit)
+	}
+}
@@ -0,0 +1,418 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// Large files can be posted in chunks using an upload session, in the spirit
+// of the tus protocol (https://tus.io):
+//
+//	POST   /uploads       creates a session from an api.UploadRequest
+//	HEAD   /uploads/{id}  returns the current offset in Upload-Offset
+//	GET    /uploads/{id}  returns the session as an api.UploadStatus
+//	PUT    /uploads/{id}  writes the request body at Upload-Offset
+//	POST   /uploads/{id}  verifies the checksum and stores the data set
+//	DELETE /uploads/{id}  abandons the session
+//
+// A session is kept in the data directory as a file of the bytes received so
+// far and a JSON file describing the upload.  The data set does not exist
+// until the session is finalized.
+
+// uploadLifetime is how long an upload session can be resumed.
+const uploadLifetime = 24 * time.Hour
+
+// maxUploadChunk is the largest chunk accepted in one request.
+const maxUploadChunk = 64 << 20
+
+// uploadSession describes an upload in progress.
+type uploadSession struct {
+	Id      string            `json:"id"`
+	User    string            `json:"user"`
+	Created time.Time         `json:"created"`
+	Request api.UploadRequest `json:"request"`
+}
+
+func (srv *Server) uploadDir() string {
+	return filepath.Join(srv.DataDir, "uploads")
+}
+
+func (srv *Server) uploadFile(id, ext string) string {
+	return filepath.Join(srv.uploadDir(), id+ext)
+}
+
+// validUploadId returns true if id has the form of a generated id, so that
+// it cannot refer to a file outside the upload directory.
+func validUploadId(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func newUploadId() (string, error) {
+	var b = make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// readUploadSession returns the session with the given id and the number of
+// bytes received.
+func (srv *Server) readUploadSession(id string) (*uploadSession, int64, error) {
+	var b []byte
+	var err error
+	b, err = ioutil.ReadFile(srv.uploadFile(id, ".json"))
+	if err != nil {
+		return nil, 0, err
+	}
+	var s uploadSession
+	if err = json.Unmarshal(b, &s); err != nil {
+		return nil, 0, err
+	}
+	var fi os.FileInfo
+	fi, err = os.Stat(srv.uploadFile(id, ".part"))
+	if err != nil {
+		return nil, 0, err
+	}
+	return &s, fi.Size(), nil
+}
+
+// uploadLock serializes writing to and finalizing an upload session.
+type uploadLock struct {
+	sync.Mutex
+	// n is the number of requests holding or waiting for the lock.
+	n int
+}
+
+// lockUpload waits until no other request is writing to or finalizing the
+// session id, and returns a function that releases it.  A request that
+// waited finds the session removed if the other request stored the data
+// set.  Requests for other sessions do not wait.
+func (srv *Server) lockUpload(id string) func() {
+	srv.uploadMu.Lock()
+	if srv.uploadLocks == nil {
+		srv.uploadLocks = make(map[string]*uploadLock)
+	}
+	var l = srv.uploadLocks[id]
+	if l == nil {
+		l = &uploadLock{}
+		srv.uploadLocks[id] = l
+	}
+	l.n++
+	srv.uploadMu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		srv.uploadMu.Lock()
+		l.n--
+		if l.n == 0 {
+			delete(srv.uploadLocks, id)
+		}
+		srv.uploadMu.Unlock()
+	}
+}
+
+func (srv *Server) removeUploadSession(id string) {
+	os.Remove(srv.uploadFile(id, ".part"))
+	os.Remove(srv.uploadFile(id, ".json"))
+}
+
+// removeExpiredUploads deletes sessions that can no longer be resumed.
+func (srv *Server) removeExpiredUploads() {
+	var files, _ = filepath.Glob(filepath.Join(srv.uploadDir(), "*.json"))
+	for _, f := range files {
+		var id = strings.TrimSuffix(filepath.Base(f), ".json")
+		var s, _, err = srv.readUploadSession(id)
+		if err != nil || time.Since(s.Created) > uploadLifetime {
+			srv.removeUploadSession(id)
+		}
+	}
+}
+
+func uploadStatus(s *uploadSession, offset int64) *api.UploadStatus {
+	return &api.UploadStatus{
+		Id:      s.Id,
+		Url:     joinURLPath(glintbaseurl, "uploads/"+s.Id),
+		Name:    s.Request.Name,
+		Size:    s.Request.Size,
+		Offset:  offset,
+		Expires: s.Created.Add(uploadLifetime),
+	}
+}
+
+// handleUploads routes requests for upload sessions.
+func (srv *Server) handleUploads(w http.ResponseWriter, r *http.Request) {
+	srv.logRequest(r, 0)
+	var id = strings.Trim(strings.TrimPrefix(r.URL.Path, "/uploads"), "/")
+	if id == "" {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, r, "POST")
+			return
+		}
+		srv.handleUploadCreate(w, r)
+		return
+	}
+	if !validUploadId(id) {
+		writeError(w, http.StatusNotFound, "Upload not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		srv.handleUploadStatus(w, r, id)
+	case http.MethodPut, http.MethodPatch:
+		srv.handleUploadChunk(w, r, id)
+	case http.MethodPost:
+		srv.audit(AuditPost, func(w http.ResponseWriter, r *http.Request) {
+			srv.handleUploadFinalize(w, r, id)
+		})(w, r)
+	case http.MethodDelete:
+		srv.handleUploadDelete(w, r, id)
+	default:
+		writeMethodNotAllowed(w, r, "GET, HEAD, PUT, PATCH, POST, DELETE")
+	}
+}
+
+func (srv *Server) handleUploadCreate(w http.ResponseWriter, r *http.Request) {
+	var user, ok = srv.handleBasicAuth(w, r)
+	if !ok {
+		return
+	}
+	var req api.UploadRequest
+	var err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || strings.ContainsAny(req.Name, "/.") {
+		writeError(w, http.StatusBadRequest, "Invalid data set name")
+		return
+	}
+	if req.Size < 0 {
+		writeError(w, http.StatusBadRequest, "Invalid size")
+		return
+	}
+	if !strings.HasPrefix(req.Checksum, "sha256:") {
+		writeError(w, http.StatusBadRequest,
+			"Checksum must have the form sha256:<hex>")
+		return
+	}
+	if req.Metadata != nil {
+		if err = validateDatasetMetadata(req.Metadata); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	srv.removeExpiredUploads()
+	if err = os.MkdirAll(srv.uploadDir(), fileModeRWX); err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var s = &uploadSession{User: user, Created: time.Now().UTC(),
+		Request: req}
+	s.Id, err = newUploadId()
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var b []byte
+	b, err = json.Marshal(s)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	err = ioutil.WriteFile(srv.uploadFile(s.Id, ".part"), nil, fileModeRW)
+	if err == nil {
+		err = ioutil.WriteFile(srv.uploadFile(s.Id, ".json"), b,
+			fileModeRW)
+	}
+	if err != nil {
+		srv.removeUploadSession(s.Id)
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var status = uploadStatus(s, 0)
+	w.Header().Set("Location", status.Url)
+	w.Header().Set("Upload-Offset", "0")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(status)
+}
+
+// lookupUploadSession reads a session and checks that it belongs to the
+// authenticated user, writing an error response if not.
+func (srv *Server) lookupUploadSession(w http.ResponseWriter, r *http.Request,
+	id string) (*uploadSession, int64, bool) {
+	var s, offset, err = srv.readUploadSession(id)
+	if err != nil {
+		if _, ok := srv.handleBasicAuth(w, r); ok {
+			writeError(w, http.StatusNotFound, "Upload not found")
+		}
+		return nil, 0, false
+	}
+	if _, ok := srv.requireUser(w, r, s.User); !ok {
+		return nil, 0, false
+	}
+	return s, offset, true
+}
+
+func (srv *Server) handleUploadStatus(w http.ResponseWriter, r *http.Request,
+	id string) {
+	var s, offset, ok = srv.lookupUploadSession(w, r, id)
+	if !ok {
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(s.Request.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	writeJSON(w, uploadStatus(s, offset))
+}
+
+// handleUploadChunk writes a chunk at the offset given in the Upload-Offset
+// header, which must be the number of bytes received so far.
+func (srv *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request,
+	id string) {
+	var s, _, ok = srv.lookupUploadSession(w, r, id)
+	if !ok {
+		return
+	}
+	var offset, err = strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest,
+			"Upload-Offset header missing or invalid")
+		return
+	}
+	// Read the whole chunk before writing it, so that an interrupted
+	// request leaves the file unchanged.
+	var chunk []byte
+	chunk, err = ioutil.ReadAll(io.LimitReader(r.Body, maxUploadChunk+1))
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+	if len(chunk) > maxUploadChunk {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(
+			"Chunk is larger than %d bytes", maxUploadChunk))
+		return
+	}
+
+	var unlock = srv.lockUpload(id)
+	defer unlock()
+	var f *os.File
+	f, err = os.OpenFile(srv.uploadFile(id, ".part"), os.O_WRONLY, 0)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Upload not found")
+		return
+	}
+	defer f.Close()
+	var fi os.FileInfo
+	fi, err = f.Stat()
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var current = fi.Size()
+	w.Header().Set("Upload-Offset", strconv.FormatInt(current, 10))
+	if offset != current {
+		writeError(w, http.StatusConflict, fmt.Sprintf(
+			"Upload-Offset is %d but %d bytes have been received",
+			offset, current))
+		return
+	}
+	if current+int64(len(chunk)) > s.Request.Size {
+		writeError(w, http.StatusRequestEntityTooLarge,
+			"Chunk extends beyond the size of the upload")
+		return
+	}
+	if _, err = f.WriteAt(chunk, current); err != nil {
+		// Discard a partial write so that the offset stays valid.
+		f.Truncate(current)
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Upload-Offset",
+		strconv.FormatInt(current+int64(len(chunk)), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUploadFinalize verifies that the upload is complete and matches its
+// checksum, and then stores it as a data set.  The session is removed only
+// if the data set is stored, so that a failed request can be repeated.
+func (srv *Server) handleUploadFinalize(w http.ResponseWriter, r *http.Request,
+	id string) {
+	var unlock = srv.lockUpload(id)
+	defer unlock()
+	var s, offset, ok = srv.lookupUploadSession(w, r, id)
+	if !ok {
+		return
+	}
+	setAuditActor(w, s.User)
+	if offset != s.Request.Size {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		writeError(w, http.StatusConflict, fmt.Sprintf(
+			"Upload is incomplete: %d of %d bytes received", offset,
+			s.Request.Size))
+		return
+	}
+	var raw, err = ioutil.ReadFile(srv.uploadFile(id, ".part"))
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var sum = sha256.Sum256(raw)
+	if "sha256:"+hex.EncodeToString(sum[:]) !=
+		strings.ToLower(s.Request.Checksum) {
+		srv.removeUploadSession(id)
+		writeError(w, http.StatusUnprocessableEntity,
+			"Checksum does not match the uploaded data")
+		return
+	}
+
+	var personId int64
+	personId, err = srv.storage.LookupPersonId(s.User)
+	if err != nil {
+		handleError(w, err, http.StatusInternalServerError)
+		return
+	}
+	var req = api.PostRequest{
+		Type:      s.Request.Type,
+		NoHeader:  s.Request.NoHeader,
+		Columns:   s.Request.Columns,
+		Overwrite: s.Request.Overwrite,
+		Metadata:  s.Request.Metadata,
+	}
+	if srv.storeData(w, s.User, personId, s.Request.Name, raw, &req, nil) {
+		srv.removeUploadSession(id)
+	}
+}
+
+func (srv *Server) handleUploadDelete(w http.ResponseWriter, r *http.Request,
+	id string) {
+	if _, _, ok := srv.lookupUploadSession(w, r, id); !ok {
+		return
+	}
+	srv.removeUploadSession(id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// uploadStorage is a sessionStorage that stores data sets in memory.  The
+// first fails stores fail.
+type uploadStorage struct {
+	*sessionStorage
+	files map[string]string
+	fails int
+}
+
+func (s *uploadStorage) LookupPersonId(username string) (int64, error) {
+	return 1, nil
+}
+
+func (s *uploadStorage) LookupFileId(personId int64, path string) (int64,
+	error) {
+	return 0, sql.ErrNoRows
+}
+
+func (s *uploadStorage) StoreFile(f *StoredFile) (int64, string, error) {
+	if s.fails > 0 {
+		s.fails--
+		return 0, "", errors.New("unavailable")
+	}
+	s.files[f.Path] = f.Data
+	return int64(len(s.files)), "ark:/99999/glint-test", nil
+}
+
+func TestUploadFinalize(t *testing.T) {
+	srv, st, _ := newSessionServer(t)
+	ust := &uploadStorage{sessionStorage: st, files: map[string]string{},
+		fails: 1}
+	srv.storage = ust
+	srv.DataDir = t.TempDir()
+	glintbaseurl = "https://glint.example.org/"
+	defer func() { glintbaseurl = "" }()
+	if err := os.MkdirAll(srv.uploadDir(), fileModeRWX); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("a,b\n1,2\n")
+	sum := sha256.Sum256(data)
+	s := &uploadSession{Id: "0123456789abcdef0123456789abcdef",
+		User: "alice", Created: time.Now(), Request: api.UploadRequest{
+			Name: "ocean", Size: int64(len(data)),
+			Checksum: "sha256:" + hex.EncodeToString(sum[:])}}
+	b, _ := json.Marshal(s)
+	ioutil.WriteFile(srv.uploadFile(s.Id, ".json"), b, fileModeRW)
+	ioutil.WriteFile(srv.uploadFile(s.Id, ".part"), data, fileModeRW)
+
+	finalize := func() int {
+		r := httptest.NewRequest("POST", "/uploads/"+s.Id, nil)
+		r.SetBasicAuth("alice", "secret")
+		w := httptest.NewRecorder()
+		srv.handleUploads(w, r)
+		return w.Code
+	}
+	// A failed request leaves the session to be finalized again.
+	if code := finalize(); code != http.StatusConflict {
+		t.Fatalf("status %d", code)
+	}
+	if _, _, err := srv.readUploadSession(s.Id); err != nil {
+		t.Fatalf("session removed after failure: %v", err)
+	}
+	// Concurrent requests store the data set once.
+	var wg sync.WaitGroup
+	codes := make([]int, 3)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = finalize()
+		}(i)
+	}
+	wg.Wait()
+	created := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusNotFound:
+		default:
+			t.Errorf("status %d", code)
+		}
+	}
+	if created != 1 || ust.files["ocean"] != string(data) {
+		t.Errorf("%d created: %q", created, ust.files["ocean"])
+	}
+	if len(srv.uploadLocks) != 0 {
+		t.Errorf("%d locks left", len(srv.uploadLocks))
+	}
+}
+
+func TestUploadChunkLocksSession(t *testing.T) {
+	srv, _, _ := newSessionServer(t)
+	srv.DataDir = t.TempDir()
+	if err := os.MkdirAll(srv.uploadDir(), fileModeRWX); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"0123456789abcdef0123456789abcdef",
+		"fedcba9876543210fedcba9876543210"}
+	for _, id := range ids {
+		s := &uploadSession{Id: id, User: "alice", Created: time.Now(),
+			Request: api.UploadRequest{Name: "ocean", Size: 4}}
+		b, _ := json.Marshal(s)
+		ioutil.WriteFile(srv.uploadFile(id, ".json"), b, fileModeRW)
+		ioutil.WriteFile(srv.uploadFile(id, ".part"), nil, fileModeRW)
+	}
+	chunk := func(id string) <-chan int {
+		done := make(chan int, 1)
+		go func() {
+			r := httptest.NewRequest("PATCH", "/uploads/"+id,
+				strings.NewReader("a,b\n"))
+			r.Header.Set("Upload-Offset", "0")
+			r.SetBasicAuth("alice", "secret")
+			w := httptest.NewRecorder()
+			srv.handleUploads(w, r)
+			done <- w.Code
+		}()
+		return done
+	}
+
+	unlock := srv.lockUpload(ids[0])
+	blocked := chunk(ids[0])
+	// A chunk for another session is written while the first session
+	// is locked.
+	select {
+	case code := <-chunk(ids[1]):
+		if code != http.StatusNoContent {
+			t.Errorf("status %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("chunk for another session waited")
+	}
+	select {
+	case <-blocked:
+		t.Fatal("chunk written to a locked session")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if code := <-blocked; code != http.StatusNoContent {
+		t.Errorf("status %d", code)
+	}
+	if len(srv.uploadLocks) != 0 {
+		t.Errorf("%d locks left", len(srv.uploadLocks))
+	}
+}
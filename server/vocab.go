@@ -0,0 +1,474 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/glintdb/glintweb/api"
+)
+
+// defaultPrefixes maps the vocabulary prefixes that are always known to
+// their namespaces.
+var defaultPrefixes = map[string]string{
+	"cf":      "http://vocab.nerc.ac.uk/standard_name/",
+	"dc":      "http://purl.org/dc/elements/1.1/",
+	"dcterms": "http://purl.org/dc/terms/",
+	"schema":  "https://schema.org/",
+	"skos":    "http://www.w3.org/2004/02/skos/core#",
+	"xsd":     "http://www.w3.org/2001/XMLSchema#",
+	"yamz":    "https://n2t.net/ark:/99152/",
+}
+
+// defaultClosed lists the prefixes that are closed unless configured
+// otherwise.  The Dublin Core elements are a fixed set.
+var defaultClosed = []string{"dc"}
+
+// dcElements are the Dublin Core elements.
+var dcElements = []api.Term{
+	{Id: "dc:contributor", Label: "Contributor", Definition: "An entity responsible for making contributions to the resource."},
+	{Id: "dc:coverage", Label: "Coverage", Definition: "The spatial or temporal topic of the resource, spatial applicability of the resource, or jurisdiction under which the resource is relevant."},
+	{Id: "dc:creator", Label: "Creator", Definition: "An entity primarily responsible for making the resource."},
+	{Id: "dc:date", Label: "Date", Definition: "A point or period of time associated with an event in the lifecycle of the resource."},
+	{Id: "dc:description", Label: "Description", Definition: "An account of the resource."},
+	{Id: "dc:format", Label: "Format", Definition: "The file format, physical medium, or dimensions of the resource."},
+	{Id: "dc:identifier", Label: "Identifier", Definition: "An unambiguous reference to the resource within a given context."},
+	{Id: "dc:language", Label: "Language", Definition: "A language of the resource."},
+	{Id: "dc:publisher", Label: "Publisher", Definition: "An entity responsible for making the resource available."},
+	{Id: "dc:relation", Label: "Relation", Definition: "A related resource."},
+	{Id: "dc:rights", Label: "Rights", Definition: "Information about rights held in and over the resource."},
+	{Id: "dc:source", Label: "Source", Definition: "A related resource from which the described resource is derived."},
+	{Id: "dc:subject", Label: "Subject", Definition: "The topic of the resource."},
+	{Id: "dc:title", Label: "Title", Definition: "A name given to the resource."},
+	{Id: "dc:type", Label: "Type", Definition: "The nature or genre of the resource."},
+}
+
+// vocabulary is a registry of metadata terms.  A term is identified by a
+// prefixed name such as "dc:date", which stands for the URI formed by
+// appending the name to the namespace of the prefix.  Only the defined
+// terms are accepted with a closed prefix; any name is accepted with an
+// open prefix, even if some terms have been defined for it.  A term
+// without a prefix is free text.
+type vocabulary struct {
+	prefixes map[string]string
+	closed   map[string]bool
+	terms    map[string]*api.Term
+	sorted   []*api.Term
+}
+
+// newVocabulary returns a vocabulary containing the default prefixes and
+// Dublin Core elements, the prefixes in the comma-separated list prefixes
+// (e.g. "ex=http://example.org/ns#"), and the terms defined in the
+// comma-separated list of files.  Files ending in ".csv" contain the
+// columns term, label, and definition with a header line; other files are
+// SKOS concept schemes in RDF/XML.  The prefixes in the comma-separated
+// list closed are closed; if it is empty, defaultClosed is used.
+func newVocabulary(prefixes string, closed string,
+	files string) (*vocabulary, error) {
+	var v = &vocabulary{
+		prefixes: make(map[string]string),
+		closed:   make(map[string]bool),
+		terms:    make(map[string]*api.Term),
+	}
+	for p, ns := range defaultPrefixes {
+		v.prefixes[p] = ns
+	}
+	for _, p := range splitList(prefixes) {
+		var kv []string = strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || !validPrefix(kv[0]) || kv[1] == "" {
+			return nil, fmt.Errorf("Invalid vocabulary prefix: %s", p)
+		}
+		v.prefixes[kv[0]] = kv[1]
+	}
+	for x := range dcElements {
+		var t = dcElements[x]
+		if err := v.add(&t); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range splitList(files) {
+		var err error
+		if strings.EqualFold(filepath.Ext(f), ".csv") {
+			err = v.loadCSV(f)
+		} else {
+			err = v.loadSKOS(f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+	}
+	var closedList = splitList(closed)
+	if len(closedList) == 0 {
+		closedList = defaultClosed
+	}
+	for _, p := range closedList {
+		if _, ok := v.prefixes[p]; !ok {
+			return nil, fmt.Errorf("Unknown closed vocabulary "+
+				"prefix: %s", p)
+		}
+		v.closed[p] = true
+	}
+	sort.Slice(v.sorted, func(i, j int) bool {
+		return v.sorted[i].Id < v.sorted[j].Id
+	})
+	return v, nil
+}
+
+// splitList splits a comma-separated list, omitting empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+func validPrefix(p string) bool {
+	if p == "" {
+		return false
+	}
+	for _, r := range p {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// isURI reports whether a term is given as an absolute URI rather than a
+// prefixed name.
+func isURI(term string) bool {
+	return strings.HasPrefix(term, "http://") ||
+		strings.HasPrefix(term, "https://") ||
+		strings.HasPrefix(term, "urn:")
+}
+
+// compact returns the prefixed name of a URI, using the longest matching
+// namespace, or the URI itself if no namespace matches.
+func (v *vocabulary) compact(uri string) string {
+	var prefix, ns string
+	for p, n := range v.prefixes {
+		if strings.HasPrefix(uri, n) && len(uri) > len(n) &&
+			len(n) > len(ns) {
+			prefix, ns = p, n
+		}
+	}
+	if ns == "" {
+		return uri
+	}
+	return prefix + ":" + uri[len(ns):]
+}
+
+// expand returns the URI of a term given as a prefixed name or URI, and
+// the term's prefix, which is "" for a URI outside the known namespaces.
+func (v *vocabulary) expand(term string) (string, string, error) {
+	if isURI(term) {
+		var id string = v.compact(term)
+		if id == term {
+			return term, "", nil
+		}
+		term = id
+	}
+	var i int = strings.IndexByte(term, ':')
+	if i <= 0 || i == len(term)-1 {
+		return "", "", fmt.Errorf("Term must be a URI or have the "+
+			"form prefix:name: %s", term)
+	}
+	var ns, ok = v.prefixes[term[:i]]
+	if !ok {
+		return "", "", fmt.Errorf("Unknown vocabulary prefix: %s",
+			term[:i])
+	}
+	return ns + term[i+1:], term[:i], nil
+}
+
+// add registers a term whose Id is a prefixed name or URI.
+func (v *vocabulary) add(t *api.Term) error {
+	var uri string
+	var err error
+	uri, _, err = v.expand(t.Id)
+	if err != nil {
+		return err
+	}
+	t.Uri = uri
+	t.Id = v.compact(uri)
+	if _, ok := v.terms[t.Id]; !ok {
+		v.sorted = append(v.sorted, t)
+	}
+	v.terms[t.Id] = t
+	return nil
+}
+
+// lookup returns a registered term, given as a prefixed name or URI, or
+// nil.
+func (v *vocabulary) lookup(term string) *api.Term {
+	var uri string
+	var err error
+	uri, _, err = v.expand(term)
+	if err != nil {
+		return nil
+	}
+	return v.terms[v.compact(uri)]
+}
+
+// isFreeText reports whether a term is text rather than a URI or a
+// prefixed name, which has a prefix and contains no spaces.
+func isFreeText(term string) bool {
+	if isURI(term) {
+		return false
+	}
+	var i int = strings.IndexByte(term, ':')
+	return i < 0 || !validPrefix(term[:i]) ||
+		strings.ContainsAny(term, " \t\n")
+}
+
+// validate checks that a term is acceptable and returns it in the form in
+// which it is stored, which is the prefixed name if there is one.  Free
+// text is accepted as it is.
+func (v *vocabulary) validate(term string) (string, error) {
+	if isFreeText(term) {
+		return term, nil
+	}
+	var uri, prefix string
+	var err error
+	uri, prefix, err = v.expand(term)
+	if err != nil {
+		return "", err
+	}
+	var id string = v.compact(uri)
+	if v.closed[prefix] && v.terms[id] == nil {
+		return "", fmt.Errorf("Unknown term in vocabulary '%s': %s",
+			prefix, id)
+	}
+	return id, nil
+}
+
+// complete returns up to limit terms whose prefixed names begin with q,
+// followed by terms whose labels contain q, ignoring case.
+func (v *vocabulary) complete(q string, limit int) []api.Term {
+	q = strings.ToLower(q)
+	var terms = []api.Term{}
+	var found = make(map[string]bool)
+	for _, t := range v.sorted {
+		if len(terms) >= limit {
+			return terms
+		}
+		if strings.HasPrefix(strings.ToLower(t.Id), q) {
+			terms = append(terms, *t)
+			found[t.Id] = true
+		}
+	}
+	for _, t := range v.sorted {
+		if len(terms) >= limit {
+			break
+		}
+		if !found[t.Id] &&
+			strings.Contains(strings.ToLower(t.Label), q) {
+			terms = append(terms, *t)
+		}
+	}
+	return terms
+}
+
+// loadCSV reads terms from a CSV file with a header line naming the
+// columns term, label, and definition.
+func (v *vocabulary) loadCSV(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r = csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	var header []string
+	header, err = r.Read()
+	if err != nil {
+		return err
+	}
+	var col = make(map[string]int)
+	for x, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = x
+	}
+	if _, ok := col["term"]; !ok {
+		return fmt.Errorf("No term column in header")
+	}
+	var field = func(rec []string, name string) string {
+		if x, ok := col[name]; ok && x < len(rec) {
+			return strings.TrimSpace(rec[x])
+		}
+		return ""
+	}
+	for {
+		var rec []string
+		rec, err = r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var t = &api.Term{
+			Id:         field(rec, "term"),
+			Label:      field(rec, "label"),
+			Definition: field(rec, "definition"),
+		}
+		if t.Id == "" {
+			continue
+		}
+		if err = v.add(t); err != nil {
+			line, _ := r.FieldPos(0)
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+}
+
+const (
+	rdfNamespace  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	skosNamespace = "http://www.w3.org/2004/02/skos/core#"
+	xmlNamespace  = "http://www.w3.org/XML/1998/namespace"
+)
+
+type skosLiteral struct {
+	Lang  string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+type skosConcept struct {
+	About       string        `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	PrefLabel   []skosLiteral `xml:"http://www.w3.org/2004/02/skos/core# prefLabel"`
+	Definition  []skosLiteral `xml:"http://www.w3.org/2004/02/skos/core# definition"`
+	Description []skosLiteral `xml:"http://purl.org/dc/terms/ description"`
+}
+
+// literal returns the English value of a literal, or the value without a
+// language, or the first value.
+func literal(values []skosLiteral) string {
+	var s string
+	for x, l := range values {
+		switch {
+		case strings.HasPrefix(strings.ToLower(l.Lang), "en"):
+			return strings.TrimSpace(l.Value)
+		case l.Lang == "" || x == 0:
+			s = strings.TrimSpace(l.Value)
+		}
+	}
+	return s
+}
+
+// loadSKOS reads the skos:Concept elements of an RDF/XML file.  Namespaces
+// declared on the root element are added as prefixes, unless the prefixes
+// are already defined.
+func (v *vocabulary) loadSKOS(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var d = xml.NewDecoder(f)
+	var root = true
+	for {
+		var tok xml.Token
+		tok, err = d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var se, ok = tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root {
+			root = false
+			for _, a := range se.Attr {
+				if a.Name.Space == "xmlns" && validPrefix(a.Name.Local) &&
+					v.prefixes[a.Name.Local] == "" &&
+					a.Value != rdfNamespace && a.Value != xmlNamespace {
+					v.prefixes[a.Name.Local] = a.Value
+				}
+			}
+			continue
+		}
+		if se.Name.Space != skosNamespace || se.Name.Local != "Concept" {
+			continue
+		}
+		var c skosConcept
+		if err = d.DecodeElement(&c, &se); err != nil {
+			return err
+		}
+		if c.About == "" {
+			continue
+		}
+		var def string = literal(c.Definition)
+		if def == "" {
+			def = literal(c.Description)
+		}
+		var t = &api.Term{
+			Id:         c.About,
+			Label:      literal(c.PrefLabel),
+			Definition: def,
+		}
+		if err = v.add(t); err != nil {
+			return err
+		}
+	}
+}
+
+// maxTermResults is the default and maximum number of terms returned by
+// an autocomplete request.
+const maxTermResults = 50
+
+// handleTerms looks up terms.  GET /terms?q=text returns terms beginning
+// with or whose labels contain the text, GET /terms returns the known
+// prefixes, and GET /terms/{term} returns one term.
+func (srv *Server) handleTerms(w http.ResponseWriter, r *http.Request) {
+	srv.logRequest(r, 0)
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeMethodNotAllowed(w, r, "GET, HEAD")
+		return
+	}
+	var id string = strings.TrimPrefix(r.URL.Path, "/terms")
+	id = strings.TrimPrefix(id, "/")
+	if id != "" {
+		var t *api.Term = srv.vocab.lookup(id)
+		if t == nil {
+			writeError(w, http.StatusNotFound, "Term not found: "+id)
+			return
+		}
+		writeJSON(w, t)
+		return
+	}
+	var q = r.URL.Query()
+	var list api.TermList
+	if _, ok := q["q"]; !ok {
+		list.Prefixes = srv.vocab.prefixes
+		list.Terms = []api.Term{}
+		writeJSON(w, &list)
+		return
+	}
+	var limit = maxTermResults
+	if s := q.Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid limit: "+s)
+			return
+		}
+		if limit > maxTermResults {
+			limit = maxTermResults
+		}
+	}
+	list.Terms = srv.vocab.complete(q.Get("q"), limit)
+	writeJSON(w, &list)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestVocabularyValidate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "terms.csv")
+	err := ioutil.WriteFile(file, []byte("term,label,definition\n"+
+		"ex:air_temp,Air temperature,Temperature of the air\n"+
+		"cf:sea_water_temperature,Sea water temperature,\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := newVocabulary("ex=http://example.org/ns#", "", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		term, id string
+		ok       bool
+	}{
+		{"dc:date", "dc:date", true},
+		{"http://purl.org/dc/elements/1.1/title", "dc:title", true},
+		{"dc:dated", "", false},
+		// Defining some terms does not close a prefix.
+		{"ex:air_temp", "ex:air_temp", true},
+		{"ex:water_temp", "ex:water_temp", true},
+		{"cf:air_temperature", "cf:air_temperature", true},
+		{"xx:date", "", false},
+		{"https://other.org/t", "https://other.org/t", true},
+		// Terms without a prefix are free text.
+		{"sea temperature", "sea temperature", true},
+		{"Note: measured at noon", "Note: measured at noon", true},
+		{"12:00 UTC", "12:00 UTC", true},
+	} {
+		id, err := v.validate(c.term)
+		if (err == nil) != c.ok || id != c.id {
+			t.Errorf("validate(%q) = %q, %v", c.term, id, err)
+		}
+	}
+
+	v, err = newVocabulary("ex=http://example.org/ns#", "ex", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.validate("ex:water_temp"); err == nil {
+		t.Errorf("closed prefix accepted an undefined term")
+	}
+	if _, err = v.validate("dc:dated"); err != nil {
+		t.Errorf("dc closed although not configured: %v", err)
+	}
+	if _, err = newVocabulary("", "ex", ""); err == nil {
+		t.Errorf("unknown closed prefix: no error")
+	}
+}